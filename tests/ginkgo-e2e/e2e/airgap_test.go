@@ -15,8 +15,12 @@ limitations under the License.
 package e2e_test
 
 import (
+	"context"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -24,62 +28,298 @@ import (
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/airgap"
+	"github.com/rancher/elemental/tests/e2e/helpers/certs"
+	"github.com/rancher/elemental/tests/e2e/helpers/cluster"
+	"github.com/rancher/elemental/tests/e2e/helpers/common"
+	"github.com/rancher/elemental/tests/e2e/helpers/diagnostics"
+	"github.com/rancher/elemental/tests/e2e/helpers/helm"
+	"github.com/rancher/elemental/tests/e2e/helpers/kubewarden"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+	"github.com/rancher/elemental/tests/e2e/helpers/vm"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// PolicyServer with a replica on each node of the airgap cluster
+	spreadPolicyServer = "airgap-spread"
+	// PolicyServer not trusting the CA of the TLS registry
+	untrustedPolicyServer = "airgap-untrusted"
+)
+
+// Error of a PolicyServer fetching a module of the TLS registry without its CA
+var untrustedRegistryError = regexp.MustCompile(`(?i)x509|certificate`)
+
+// AirgapRegistry is the mirror served by the rancher-manager VM
+type AirgapRegistry struct {
+	// host:port of the mirror
+	Host string
+	// Directory of the CA and of the certificate of the mirror, empty for plain HTTP
+	TLSDir string
+}
+
+/*
+Get the mirror of the airgap tests
+  - @returns The mirror, served over TLS if AIRGAP_REGISTRY_TLS is true
+*/
+func NewAirgapRegistry() *AirgapRegistry {
+	r := &AirgapRegistry{Host: airgap.Mirror}
+	if cfg.AirgapRegistryTLS == "true" {
+		// Kept with the archive, for the upgrade test
+		r.TLSDir = os.Getenv("HOME") + "/airgap_rancher/registry-tls"
+	}
+	return r
+}
+
+// TLS returns true if the mirror is served over TLS
+func (r *AirgapRegistry) TLS() bool {
+	return r.TLSDir != ""
+}
+
+// CAFile returns the path of the CA of the mirror
+func (r *AirgapRegistry) CAFile() string {
+	return filepath.Join(r.TLSDir, "ca.crt")
+}
+
+// CA returns the PEM encoded CA of the mirror
+func (r *AirgapRegistry) CA() []byte {
+	data, err := os.ReadFile(r.CAFile())
+	Expect(err).To(Not(HaveOccurred()))
+	return data
+}
+
+/*
+Generate a local CA and the certificate of the mirror, the way config/rancher-ssl is for Rancher
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func (r *AirgapRegistry) GenerateTLS() {
+	ca, err := certs.NewCA("kubewarden-e2e-airgap-registry")
+	Expect(err).To(Not(HaveOccurred()))
+	host, _, _ := strings.Cut(r.Host, ":")
+	cert, err := ca.Issue(host, RancherManagerVM().IP)
+	Expect(err).To(Not(HaveOccurred()))
+
+	_, _, err = cert.Write(r.TLSDir)
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(os.WriteFile(r.CAFile(), ca.CertPEM, 0644)).To(Succeed())
+}
+
+/*
+Send the TLS material to a node, in the k3s directory read by deploy-airgap
+  - @param cl SSH client of the node
+  - @param k3sDir k3s directory extracted from the store
+  - @param server Also send the certificate of the mirror, served by this node
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func (r *AirgapRegistry) SendTLS(cl *tools.Client, k3sDir string, server bool) {
+	files := map[string]string{r.CAFile(): "registry-ca.crt"}
+	if server {
+		files[filepath.Join(r.TLSDir, "tls.crt")] = "registry.crt"
+		files[filepath.Join(r.TLSDir, "tls.key")] = "registry.key"
+	}
+	for src, name := range files {
+		Expect(cl.SendFile(src, k3sDir+"/"+name, "0600")).To(Succeed())
+	}
+}
+
+// HelmOptions sets the access to the mirror of the chart and of the policy servers
+func (r *AirgapRegistry) HelmOptions(opts *helm.Options) {
+	if !r.TLS() {
+		host, _, _ := strings.Cut(r.Host, ":")
+		opts.PlainHTTP = true
+		opts.Set = append(opts.Set,
+			"policyServer.insecureSources[0]="+host,
+			"policyServer.insecureSources[1]="+r.Host,
+		)
+		return
+	}
+
+	opts.CAFile = r.CAFile()
+	opts.Set = append(opts.Set, "policyServer.sourceAuthorities[0].uri="+r.Host)
+	opts.SetFile = append(opts.SetFile, "policyServer.sourceAuthorities[0].certs[0]="+r.CAFile())
+}
+
+// ConfigurePolicyServer sets the access of a PolicyServer to the mirror
+func (r *AirgapRegistry) ConfigurePolicyServer(ps *unstructured.Unstructured) {
+	if !r.TLS() {
+		Expect(unstructured.SetNestedStringSlice(ps.Object, []string{r.Host}, "spec", "insecureSources")).To(Succeed())
+		return
+	}
+
+	Expect(unstructured.SetNestedField(ps.Object, map[string]any{
+		r.Host: []any{string(r.CA())},
+	}, "spec", "sourceAuthorities")).To(Succeed())
+}
+
+/*
+Delete Kubewarden resources of a spec once it is done, even if it fails
+  - @param objs Resources to delete in order, e.g. a policy before its PolicyServer
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func DeferDeleteKubewarden(objs ...client.Object) {
+	DeferCleanup(func(ctx SpecContext) {
+		kw := NewKubewardenClient()
+		for _, obj := range objs {
+			Expect(client.IgnoreNotFound(kw.Delete(ctx, obj))).To(Succeed())
+		}
+	})
+}
+
+/*
+Get the release installed in the airgap cluster
+  - @returns The release to start from with TEST_TYPE=upgrade, the target one otherwise
+*/
+func AirgapInstallRelease() *versions.Release {
+	from, to := SelectReleases()
+	if cfg.TestType == "upgrade" {
+		return from
+	}
+	return to
+}
+
+/*
+Create the builder of an airgap archive
+  - @param dir Directory of the Hauler manifest, store and archive
+  - @param release Release to store, see AirgapInstallRelease
+  - @returns The builder, storing the k3s artifacts and the deploy script too
+*/
+func NewAirgapBuilder(ctx context.Context, dir string, release *versions.Release) *airgap.Builder {
+	// Charts of a local checkout, or pulled from the Kubewarden repository
+	loader := func(_ context.Context, name, _ string) (string, error) {
+		return filepath.Join(cfg.AirgapChartsDir, name), nil
+	}
+	if cfg.AirgapChartsDir == "" {
+		Expect(NewHelmClient().AddRepo(ctx, "kubewarden", airgap.ChartsRepoURL)).To(Succeed())
+
+		chartsDir := GinkgoT().TempDir()
+		loader = func(ctx context.Context, name, version string) (string, error) {
+			return NewHelmClient().Pull(ctx, "kubewarden/"+name, version, filepath.Join(chartsDir, version))
+		}
+	}
+
+	registry := airgap.NewRegistry()
+	registry.RetryTimeout = tools.SetTimeout(5 * time.Minute)
+
+	return &airgap.Builder{
+		Dir:          dir,
+		Releases:     []*versions.Release{release},
+		Charts:       []string{"admission-controller"},
+		LoadChart:    loader,
+		K3s:          airgap.K3s{Version: cfg.K3sVersion},
+		K3sFiles:     map[string]string{"deploy-airgap": airgapDeployScript},
+		Registry:     registry,
+		Hauler:       common.Run,
+		HaulerBinary: airgapHaulerBinary,
+		Platform:     "linux/amd64",
+	}
+}
+
+/*
+Install the Hauler release of the airgap tests on the runner, it is also sent to the VM
+  - @param b Builder of the archive
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func InstallHauler(ctx context.Context, b *airgap.Builder) {
+	Expect(b.InstallHauler(ctx, airgapHaulerBinary)).To(Succeed())
+}
+
+/*
+Resolve the name of the mirror on the runner, the chart is pulled from it
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func AddAirgapHostsEntry() {
+	host, _, _ := strings.Cut(airgap.Mirror, ":")
+	entry := RancherManagerVM().IP + " " + host
+
+	data, err := os.ReadFile("/etc/hosts")
+	Expect(err).To(Not(HaveOccurred()))
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.Join(strings.Fields(line), " ") == entry {
+			return
+		}
+	}
+
+	out, err := exec.Command("sudo", "sh", "-c", "echo '"+entry+"' >> /etc/hosts").CombinedOutput()
+	Expect(err).To(Not(HaveOccurred()), string(out))
+}
+
+/*
+Get the options of the admission-controller chart of the mirror
+  - @param r Release to install, its images and policies are pinned
+  - @returns The options, with the access to the mirror
+*/
+func AirgapChartOptions(r *versions.Release) helm.Options {
+	opts := helm.Options{
+		Chart:           "oci://" + airgap.Mirror + "/hauler/admission-controller",
+		Version:         r.Charts.AdmissionController,
+		Namespace:       "kubewarden",
+		Install:         true,
+		CreateNamespace: true,
+		Wait:            true,
+		Devel:           true,
+		Set: []string{
+			"global.cattle.systemDefaultRegistry=" + airgap.Mirror,
+			"recommendedPolicies.enabled=true",
+			"recommendedPolicies.defaultPoliciesRegistry=" + airgap.Mirror,
+		},
+	}
+
+	// Only the images of the release are in the archive
+	for _, image := range []struct{ key, tag string }{
+		{"image.tag", r.Images.Controller},
+		{"auditScanner.image.tag", r.Images.AuditScanner},
+		{"policyServer.image.tag", r.Images.PolicyServer},
+	} {
+		if image.tag != "" {
+			opts.Set = append(opts.Set, image.key+"="+image.tag)
+		}
+	}
+	opts.Set = append(opts.Set, r.PolicyValues()...)
+
+	// Plain HTTP and insecure sources, or the CA of the registry
+	NewAirgapRegistry().HelmOptions(&opts)
+	return opts
+}
+
 var _ = Describe("E2E - Build the airgap archive", Label("prepare-archive"), func() {
-	It("Execute the script to build the archive", func() {
+	It("Build the Hauler store of the airgap archive", func(ctx SpecContext) {
+		b := NewAirgapBuilder(ctx, os.Getenv("HOME")+"/airgap_rancher", AirgapInstallRelease())
+		InstallHauler(ctx, b)
+
+		archive, err := b.Build(ctx)
+		Expect(err).To(Not(HaveOccurred()))
 
 		// Could be useful for manual debugging!
-		GinkgoWriter.Printf("Executed command: %s %s %s\n", airgapBuildScript, k3sVersion, testType)
-		out, err := exec.Command(airgapBuildScript, k3sVersion, testType).CombinedOutput()
-		Expect(err).To(Not(HaveOccurred()), string(out))
+		GinkgoWriter.Printf("Hauler archive: %s\n", archive)
 	})
 })
 
 var _ = Describe("E2E - Deploy K3S/Rancher in airgap environment", Label("airgap-rancher"), func() {
-	It("Create the rancher-manager machine", func() {
-		By("Updating the default network configuration", func() {
-			// Don't check return code, as the default network could be already removed
-			for _, c := range []string{"net-destroy", "net-undefine"} {
-				_ = exec.Command("sudo", "virsh", c, "default").Run()
-			}
-
-			// Wait a bit between virsh commands
-			time.Sleep(30 * time.Second)
-			err := exec.Command("sudo", "virsh", "net-create", netDefaultFileName).Run()
+	It("Create the rancher-manager machine", func(ctx SpecContext) {
+		By("Creating the airgap network and the Rancher Manager VM", func() {
+			p := vm.NewLibvirt(netDefaultAirgapXml, GinkgoT().TempDir())
+			p.SSHTimeout = tools.SetTimeout(10 * time.Minute)
+			_, err := vm.Deploy(ctx, p, AirgapNetwork(), AirgapVMs()...)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
-		By("Creating the Rancher Manager VM", func() {
-			err := exec.Command("sudo", "virt-install",
-				"--name", "rancher-manager",
-				"--memory", "16384",
-				"--vcpus", "4",
-				"--disk", "path="+os.Getenv("HOME")+"/rancher-image.qcow2,bus=sata",
-				"--import",
-				"--os-variant", "opensuse-unknown",
-				"--network=default,mac=52:54:00:00:00:10",
-				"--noautoconsole").Run()
-			Expect(err).To(Not(HaveOccurred()))
+		By("Resolving the name of the mirror on the runner", func() {
+			AddAirgapHostsEntry()
 		})
 	})
 
-	It("Install K3S/Rancher in the rancher-manager machine", func() {
+	It("Install K3S/Rancher in the rancher-manager machine", func(ctx SpecContext) {
 		airgapRepo := os.Getenv("HOME") + "/airgap_rancher"
-		archiveFile := "haul.tar.zst"
-		haulerBinary := "/usr/local/bin/hauler"
+		archiveFile := airgap.ArchiveName
+		haulerBinary := airgapHaulerBinary
 		optRancher := "/opt/rancher"
-		password := "root"
 		rancherManager := "rancher-manager.test"
-		repoServer := rancherManager + ":5000"
-		userName := "root"
+		repoServer := airgap.Mirror
+		registry := NewAirgapRegistry()
 
 		// For ssh access
-		client := &tools.Client{
-			Host:     "192.168.122.102:22",
-			Username: userName,
-			Password: password,
-		}
+		client := AirgapSSHClient()
 
 		// Create kubectl context
 		// Default timeout is too small, so New() cannot be used
@@ -89,6 +329,12 @@ var _ = Describe("E2E - Deploy K3S/Rancher in airgap environment", Label("airgap
 			PollInterval: 500 * time.Millisecond,
 		}
 
+		if registry.TLS() {
+			By("Generating the CA and the certificate of the registry", func() {
+				registry.GenerateTLS()
+			})
+		}
+
 		By("Sending the archive file into the rancher server", func() {
 			// Destination archive file
 			destFile := optRancher + "/" + archiveFile
@@ -114,10 +360,14 @@ var _ = Describe("E2E - Deploy K3S/Rancher in airgap environment", Label("airgap
 		})
 
 		By("Deploying airgap infrastructure by executing the deploy script", func() {
-			_, err := client.RunSSH("sudo sh -c \"" + haulerBinary + " store extract hauler/k3s -o " + optRancher + "\"")
+			_, err := client.RunSSH("sudo sh -c \"" + haulerBinary + " store extract hauler/k3s.tar.gz -o " + optRancher +
+				" && tar -xzf " + optRancher + "/k3s.tar.gz -C " + optRancher + "\"")
 			Expect(err).To(Not(HaveOccurred()))
+			if registry.TLS() {
+				registry.SendTLS(client, optRancher+"/k3s", true)
+			}
 
-			cmd := optRancher + "/k3s/deploy-airgap " + k3sVersion
+			cmd := optRancher + "/k3s/deploy-airgap " + cfg.K3sVersion
 
 			// Could be useful for manual debugging!
 			GinkgoWriter.Printf("Executed command: %s\n", cmd)
@@ -125,6 +375,27 @@ var _ = Describe("E2E - Deploy K3S/Rancher in airgap environment", Label("airgap
 			Expect(err).To(Not(HaveOccurred()), string(out))
 		})
 
+		By("Joining the agents with the k3s directory and token of the store", func() {
+			for _, agent := range AirgapVMs()[1:] {
+				agentClient := agent.SSHClient()
+				CheckSSH(agentClient)
+
+				// Served by the Hauler file server of rancher-manager
+				out, err := agentClient.RunSSH("mkdir -p " + optRancher + " && curl -sfL http://" + rancherManager +
+					":8080/k3s.tar.gz | tar -xzf - -C " + optRancher)
+				Expect(err).To(Not(HaveOccurred()), out)
+				if registry.TLS() {
+					registry.SendTLS(agentClient, optRancher+"/k3s", false)
+				}
+
+				cmd := "K3S_URL=https://" + RancherManagerVM().IP + ":6443 K3S_NODE_NAME=" + agent.Name + " " +
+					optRancher + "/k3s/deploy-airgap " + cfg.K3sVersion
+				GinkgoWriter.Printf("Executed command on %s: %s\n", agent.Name, cmd)
+				out, err = agentClient.RunSSH(cmd)
+				Expect(err).To(Not(HaveOccurred()), out)
+			}
+		})
+
 		By("Getting the kubeconfig file of the airgap cluster", func() {
 			// Define local Kubeconfig file
 			localKubeconfig := os.Getenv("HOME") + "/.kube/config"
@@ -154,38 +425,15 @@ var _ = Describe("E2E - Deploy K3S/Rancher in airgap environment", Label("airgap
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
-		By("Installing admission controller", func() {
-			// Set flags for admission controller installation
-			flags := []string{
-				"upgrade", "--install", "admission-controller", "oci://" + repoServer + "/hauler/admission-controller",
-				"--namespace", "kubewarden",
-				"--create-namespace",
-				"--plain-http",
-				"--set", "global.cattle.systemDefaultRegistry=" + repoServer,
-				"--set", "image.tag=" + admControllerVersion,
-				"--set", "auditScanner.image.tag=" + auditScannerVersion,
-				"--set", "policyServer.image.tag=" + policyServerVersion,
-				"--set", "policyServer.insecureSources[0]=" + rancherManager,
-				"--set", "policyServer.insecureSources[1]=" + repoServer,
-				"--set", "recommendedPolicies.enabled=true",
-				"--set", "recommendedPolicies.defaultPoliciesRegistry=" + repoServer,
-				"--wait", "--wait-for-jobs",
-				"--devel",
-			}
-
-			// Add policy versions only if not upgrade test
-			if testType != "upgrade" {
-				flags = append(flags,
-					"--set", "recommendedPolicies.allowPrivilegeEscalationPolicy.module.tag="+allowPrivilegeEscalationPolicyVersion,
-					"--set", "recommendedPolicies.hostNamespacePolicy.module.tag="+hostNamespacePolicyVersion,
-					"--set", "recommendedPolicies.podPrivilegedPolicy.module.tag="+podPrivilegedPolicyVersion,
-					"--set", "recommendedPolicies.userGroupPolicy.module.tag="+userGroupPolicyVersion,
-					"--set", "recommendedPolicies.hostPathsPolicy.module.tag="+hostPathsPolicyVersion,
-					"--set", "recommendedPolicies.capabilitiesPolicy.module.tag="+capabilitiesPolicyVersion,
-				)
-			}
+		By("Waiting for all the nodes of the cluster", func() {
+			err := cluster.WaitNodes(ctx, NewKubewardenClient().Client, len(AirgapVMs()), tools.SetTimeout(5*time.Minute), 10*time.Second)
+			Expect(err).To(Not(HaveOccurred()))
+		})
 
-			RunHelmCmdWithRetry(flags...)
+		By("Installing admission controller", func() {
+			opts := AirgapChartOptions(AirgapInstallRelease())
+			HelmUpgrade(ctx, "admission-controller", opts)
+			CheckReleaseValues(ctx, "admission-controller", opts)
 
 			// Wait for all pods to be started
 			checkList := [][]string{
@@ -196,13 +444,112 @@ var _ = Describe("E2E - Deploy K3S/Rancher in airgap environment", Label("airgap
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
-		// TODO: check all policies
-		By("Checking that one policy is in active state", func() {
-			Eventually(func() string {
-				out, _ := kubectl.RunWithoutErr("get", "cap", "do-not-run-as-root",
-					"-o", "jsonpath={.status.policyStatus}")
-				return out
-			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(ContainSubstring("active"))
+		By("Checking that all policies are active and uniquely reachable", func() {
+			kw := NewKubewardenClient()
+			Expect(kw.WaitPolicies(ctx, kubewarden.DefaultPolicyConditions)).To(Succeed())
+		})
+
+		By("Checking that a PolicyServer spread across the nodes pulls from the mirror", func() {
+			kw := NewKubewardenClient()
+			nodes := len(AirgapVMs())
+
+			defaultServer, err := kw.GetPolicyServer(ctx, "default")
+			Expect(err).To(Not(HaveOccurred()))
+			image, _, _ := unstructured.NestedString(defaultServer.Object, "spec", "image")
+
+			// Any recommended policy module is in the mirror
+			policies, err := kw.List(ctx, kubewarden.KindClusterAdmissionPolicy)
+			Expect(err).To(Not(HaveOccurred()))
+			module := ""
+			for _, p := range policies {
+				if m, _, _ := unstructured.NestedString(p.Object, "spec", "module"); strings.HasPrefix(m, "registry://"+repoServer+"/") {
+					module = m
+					break
+				}
+			}
+			Expect(module).To(Not(BeEmpty()), "no recommended policy pulled from "+repoServer)
+
+			// One replica per node, each one pulls the image and the module
+			ps := kubewarden.NewPolicyServer(spreadPolicyServer, image, int64(nodes))
+			Expect(kubewarden.SpreadAcrossNodes(ps)).To(Succeed())
+			registry.ConfigurePolicyServer(ps)
+			policy := kubewarden.NewPodClusterPolicy(spreadPolicyServer, spreadPolicyServer, module)
+			Expect(kw.Create(ctx, ps)).To(Succeed())
+			DeferDeleteKubewarden(policy, ps)
+			Expect(kw.Create(ctx, policy)).To(Succeed())
+
+			Expect(kw.WaitPolicyServerSpread(ctx, spreadPolicyServer, nodes)).To(Succeed())
+			Expect(kw.WaitPolicyActive(ctx, kubewarden.ClusterPolicy(spreadPolicyServer))).To(Succeed())
+		})
+
+		if registry.TLS() {
+			By("Checking that the policies are fetched over verified TLS", func() {
+				kw := NewKubewardenClient()
+
+				// The CA of the mirror is trusted, nothing is insecure
+				defaultServer, err := kw.GetPolicyServer(ctx, "default")
+				Expect(err).To(Not(HaveOccurred()))
+				_, found, _ := unstructured.NestedSlice(defaultServer.Object, "spec", "insecureSources")
+				Expect(found).To(BeFalse())
+				authorities, _, _ := unstructured.NestedMap(defaultServer.Object, "spec", "sourceAuthorities")
+				Expect(authorities).To(HaveKey(repoServer))
+
+				// The certificate of the mirror is valid for its name, with the CA only
+				policy, err := kw.GetPolicy(ctx, kubewarden.ClusterPolicy(spreadPolicyServer))
+				Expect(err).To(Not(HaveOccurred()))
+				module, _, _ := unstructured.NestedString(policy.Object, "spec", "module")
+				tlsRegistry, err := airgap.NewTLSRegistry(registry.CA())
+				Expect(err).To(Not(HaveOccurred()))
+				_, err = tlsRegistry.Resolve(ctx, strings.TrimPrefix(module, "registry://"))
+				Expect(err).To(Not(HaveOccurred()))
+
+				// Without the CA, the same module cannot be fetched
+				image, _, _ := unstructured.NestedString(defaultServer.Object, "spec", "image")
+				ps := kubewarden.NewPolicyServer(untrustedPolicyServer, image, 1)
+				untrusted := kubewarden.NewPodClusterPolicy(untrustedPolicyServer, untrustedPolicyServer, module)
+				Expect(kw.Create(ctx, ps)).To(Succeed())
+				DeferDeleteKubewarden(untrusted, ps)
+				Expect(kw.Create(ctx, untrusted)).To(Succeed())
+
+				// Failing for another reason, e.g. a missing module, would hide a trusted mirror
+				kw.Timeout = tools.SetTimeout(5 * time.Minute)
+				reported, err := kw.WaitPolicyServerError(ctx, untrustedPolicyServer, kubewarden.ClusterPolicy(untrustedPolicyServer), untrustedRegistryError)
+				Expect(err).To(Not(HaveOccurred()))
+				GinkgoWriter.Printf("Untrusted registry error: %s\n", reported)
+				policy, err = kw.GetPolicy(ctx, kubewarden.ClusterPolicy(untrustedPolicyServer))
+				Expect(err).To(Not(HaveOccurred()))
+				Expect(kubewarden.PolicyStatus(policy)).To(Not(Equal(kubewarden.PolicyStatusActive)))
+			})
+		}
+
+		By("Checking that every image and policy module comes from the mirror", func() {
+			// Images imported by k3s from its airgap tarball are allowed
+			allowed, err := airgap.ReadImageList(airgapRepo + "/k3s/k3s-images.txt")
+			Expect(err).To(Not(HaveOccurred()))
+
+			v := &airgap.Verifier{
+				Mirror:     repoServer,
+				Allowed:    allowed,
+				Kubewarden: NewKubewardenClient(),
+				Node:       diagnostics.SSHRunner{Client: client},
+			}
+			violations, err := v.Verify(ctx)
+			Expect(err).To(Not(HaveOccurred()))
+
+			// The pods of the agents are checked from the cluster, their image stores over SSH
+			for _, agent := range AirgapVMs()[1:] {
+				v.Node = diagnostics.SSHRunner{Client: agent.SSHClient()}
+				images, err := v.ContainerdImages(ctx)
+				Expect(err).To(Not(HaveOccurred()))
+				for _, i := range images {
+					i.Source = agent.Name + " " + i.Source
+					violations = append(violations, i)
+				}
+			}
+			if len(violations) > 0 {
+				AddReportEntry("References not pulled from "+repoServer, violations)
+			}
+			Expect(violations).To(BeEmpty())
 		})
 	})
 })
@@ -16,7 +16,7 @@ package e2e_test
 
 import (
 	"os"
-	"os/exec"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -24,35 +24,39 @@ import (
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/airgap"
+	"github.com/rancher/elemental/tests/e2e/helpers/kubewarden"
 )
 
 var _ = Describe("E2E - Build the airgap upgrade archive", Label("prepare-upgrade"), func() {
-	It("Execute the script to build the archive", func() {
+	It("Build the Hauler store of the upgrade archive", func(ctx SpecContext) {
+		_, to := SelectReleases()
+
+		// Only the target release, k3s and its deploy script are already on the VM
+		b := NewAirgapBuilder(ctx, os.Getenv("HOME")+"/airgap_upgrade", to)
+		b.K3s = airgap.K3s{}
+		b.K3sFiles = nil
+		InstallHauler(ctx, b)
+
+		archive, err := b.Build(ctx)
+		Expect(err).To(Not(HaveOccurred()))
 
 		// Could be useful for manual debugging!
-		GinkgoWriter.Printf("Executed command: %s %s %s\n", airgapUpgradeScript, "build")
-		out, err := exec.Command(airgapUpgradeScript, "build").CombinedOutput()
-		Expect(err).To(Not(HaveOccurred()), string(out))
+		GinkgoWriter.Printf("Upgrade archive: %s\n", archive)
 	})
 })
 
 var _ = Describe("E2E - Upgrade Kubewarden in airgap environment", Label("airgap-upgrade"), func() {
-	It("Upgrade Kubewarden stack in airgap environment", func() {
+	It("Upgrade Kubewarden stack in airgap environment", func(ctx SpecContext) {
 		airgapRepo := os.Getenv("HOME") + "/airgap_upgrade"
 		archiveFile := "haul_upgrade.tar.zst"
-		haulerBinary := "/usr/local/bin/hauler"
+		haulerBinary := airgapHaulerBinary
 		optRancher := "/opt/rancher"
-		password := "root"
-		rancherManager := "rancher-manager.test"
-		repoServer := rancherManager + ":5000"
-		userName := "root"
+		registry := NewAirgapRegistry()
+		_, to := SelectReleases()
 
 		// For ssh access
-		client := &tools.Client{
-			Host:     "192.168.122.102:22",
-			Username: userName,
-			Password: password,
-		}
+		client := AirgapSSHClient()
 
 		// Create kubectl context
 		// Default timeout is too small, so New() cannot be used
@@ -62,6 +66,10 @@ var _ = Describe("E2E - Upgrade Kubewarden in airgap environment", Label("airgap
 			PollInterval: 500 * time.Millisecond,
 		}
 
+		By("Resolving the name of the mirror on the runner", func() {
+			AddAirgapHostsEntry()
+		})
+
 		By("Sending the archive file into the rancher server", func() {
 			// Destination archive file
 			destFile := optRancher + "/" + archiveFile
@@ -70,48 +78,45 @@ var _ = Describe("E2E - Upgrade Kubewarden in airgap environment", Label("airgap
 			CheckSSH(client)
 
 			// Send the hauler archive
-			err := client.SendFile(airgapRepo+"/"+archiveFile, destFile, "0644")
+			err := client.SendFile(airgapRepo+"/"+airgap.ArchiveName, destFile, "0644")
 			Expect(err).To(Not(HaveOccurred()))
 
-			// Import the hauler store
-			_, err = client.RunSSH(haulerBinary + " store load --filename " + optRancher + "/" + archiveFile)
+			// Import the hauler store, next to the content of the installation
+			_, err = client.RunSSH(haulerBinary + " store load --filename " + destFile)
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
-		By("Pushing updated artifacts with deploy script", func() {
-			cmd := optRancher + "/k3s/upgrade-airgap deploy"
+		By("Serving the updated store from the registry", func() {
+			// The registry copies the store into its storage when it starts
+			out, err := client.RunSSH("sudo systemctl restart hauler-registry.service")
+			Expect(err).To(Not(HaveOccurred()), out)
+
+			// OCI tags cannot contain a '+'
+			scheme, curlOpts := "http", "-sf"
+			if registry.TLS() {
+				scheme, curlOpts = "https", "-sfk"
+			}
+			_, port, _ := strings.Cut(registry.Host, ":")
+			tag := strings.ReplaceAll(to.Charts.AdmissionController, "+", "_")
+			cmd := "curl " + curlOpts + " -o /dev/null -H 'Accept: application/vnd.oci.image.manifest.v1+json' " +
+				scheme + "://localhost:" + port + "/v2/hauler/admission-controller/manifests/" + tag
 
 			// Could be useful for manual debugging!
 			GinkgoWriter.Printf("Executed command: %s\n", cmd)
-			out, err := client.RunSSH(cmd)
-			Expect(err).To(Not(HaveOccurred()), string(out))
+			Eventually(func() error {
+				_, err := client.RunSSH(cmd)
+				return err
+			}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(Succeed())
 		})
 
 		By("Upgrading admission controller", func() {
-			// Set flags for admission controller installation
-			flags := []string{
-				"upgrade", "admission-controller", "oci://" + repoServer + "/hauler/admission-controller",
-				"--namespace", "kubewarden",
-				"--plain-http",
-				"--set", "global.cattle.systemDefaultRegistry=" + repoServer,
-				"--set", "image.tag=" + admControllerVersion,
-				"--set", "auditScanner.image.tag=" + auditScannerVersion,
-				"--set", "policyServer.image.tag=" + policyServerVersion,
-				"--set", "policyServer.insecureSources[0]=" + rancherManager,
-				"--set", "policyServer.insecureSources[1]=" + repoServer,
-				"--set", "recommendedPolicies.enabled=true",
-				"--set", "recommendedPolicies.defaultPoliciesRegistry=" + repoServer,
-				"--set", "recommendedPolicies.allowPrivilegeEscalationPolicy.module.tag=" + allowPrivilegeEscalationPolicyVersion,
-				"--set", "recommendedPolicies.hostNamespacePolicy.module.tag=" + hostNamespacePolicyVersion,
-				"--set", "recommendedPolicies.podPrivilegedPolicy.module.tag=" + podPrivilegedPolicyVersion,
-				"--set", "recommendedPolicies.userGroupPolicy.module.tag=" + userGroupPolicyVersion,
-				"--set", "recommendedPolicies.hostPathsPolicy.module.tag=" + hostPathsPolicyVersion,
-				"--set", "recommendedPolicies.capabilitiesPolicy.module.tag=" + capabilitiesPolicyVersion,
-				"--wait", "--wait-for-jobs",
-				"--devel",
-			}
+			// Same access to the mirror as for the installation
+			opts := AirgapChartOptions(to)
+			opts.Install = false
+			opts.CreateNamespace = false
 
-			RunHelmCmdWithRetry(flags...)
+			HelmUpgrade(ctx, "admission-controller", opts)
+			CheckReleaseValues(ctx, "admission-controller", opts)
 
 			// Wait for all pods to be started
 			checkList := [][]string{
@@ -122,13 +127,9 @@ var _ = Describe("E2E - Upgrade Kubewarden in airgap environment", Label("airgap
 			Expect(err).To(Not(HaveOccurred()))
 		})
 
-		// TODO: check all policies
-		By("Checking that one policy is in active state", func() {
-			Eventually(func() string {
-				out, _ := kubectl.RunWithoutErr("get", "cap", "do-not-run-as-root",
-					"-o", "jsonpath={.status.policyStatus}")
-				return out
-			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(ContainSubstring("active"))
+		By("Checking that all policies are active and uniquely reachable", func() {
+			kw := NewKubewardenClient()
+			Expect(kw.WaitPolicies(ctx, kubewarden.DefaultPolicyConditions)).To(Succeed())
 		})
 	})
 })
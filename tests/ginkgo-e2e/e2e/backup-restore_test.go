@@ -15,9 +15,9 @@ limitations under the License.
 package e2e_test
 
 import (
+	"context"
 	"os"
-	"os/exec"
-	"strings"
+	"path/filepath"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -25,46 +25,50 @@ import (
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+	"github.com/rancher/elemental/tests/e2e/helpers/backup"
+	"github.com/rancher/elemental/tests/e2e/helpers/kubewarden"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
 	backupResourceName  = "kubewarden-backup"
 	restoreResourceName = "kubewarden-restore"
+	// ResourceSet selecting the Kubewarden custom resources only
+	kubewardenResourceSet = "kubewarden-only"
 )
 
 var _ = Describe("E2E - Install K3S", Label("install-k3s"), func() {
-	// Create kubectl context
-	// Default timeout is too small, so New() cannot be used
-	k := &kubectl.Kubectl{
-		Namespace:    "",
-		PollTimeout:  tools.SetTimeout(300 * time.Second),
-		PollInterval: 500 * time.Millisecond,
-	}
-
 	// Define local Kubeconfig file
 	localKubeconfig := os.Getenv("HOME") + "/.kube/config"
 
-	It("Install K3S", func() {
-		By("Installing K3S", func() {
-			InstallK3s()
-		})
-
-		By("Starting K3s", func() {
-			StartK3s()
+	It("Install K3S", func(ctx SpecContext) {
+		provider := NewClusterProvider()
 
+		By("Creating the cluster", func() {
+			Expect(provider.Create(ctx)).To(Succeed())
 		})
-		By("Waiting for K3s to be started", func() {
-			WaitForK3s(k)
+
+		By("Waiting for the cluster to be ready", func() {
+			Expect(provider.WaitReady(ctx)).To(Succeed())
 		})
 
 		By("Configuring Kubeconfig file", func() {
-			// Copy K3s file in ~/.kube/config
-			// NOTE: don't check for error, as it will happen anyway
-			file, _ := exec.Command("bash", "-c", "ls /etc/rancher/k3s/k3s.yaml").Output()
-			Expect(file).To(Not(BeEmpty()))
-			err := tools.CopyFile(strings.Trim(string(file), "\n"), localKubeconfig)
+			kubeconfig, err := provider.Kubeconfig(ctx)
 			Expect(err).To(Not(HaveOccurred()))
 
+			// Copy the kubeconfig of the cluster in ~/.kube/config
+			if kubeconfig != localKubeconfig {
+				err = os.MkdirAll(filepath.Dir(localKubeconfig), 0755)
+				Expect(err).To(Not(HaveOccurred()))
+				err = tools.CopyFile(kubeconfig, localKubeconfig)
+				Expect(err).To(Not(HaveOccurred()))
+			}
+
 			err = os.Setenv("KUBECONFIG", localKubeconfig)
 			Expect(err).To(Not(HaveOccurred()))
 		})
@@ -80,41 +84,40 @@ var _ = Describe("E2E - Install Kubewarden", Label("install-kubewarden"), func()
 		PollInterval: 500 * time.Millisecond,
 	}
 
-	It("Install Kubewarden stack", func() {
+	It("Install Kubewarden stack", func(ctx SpecContext) {
 		By("Installing Kubewarden stack", func() {
-			InstallKubewarden(k)
+			InstallKubewarden(ctx, k, TargetRelease(kwRelease))
 		})
 		By("Deploying custom policy-server", func() {
 			// Get current version of policy-server
-			policyServerImage, _ := kubectl.Run("get", "deployment", "policy-server-default",
-				"-n", "kubewarden", "-o", "jsonpath={.spec.template.spec.containers[0].image}")
-			Expect(policyServerImage).To(Not(BeEmpty()))
-
-			// Set the policy server name and image in the policy-server.yaml file
-			err := tools.Sed("%POLICY_SERVER_NAME%", "production", policyServerYaml)
-			Expect(err).To(Not(HaveOccurred()))
-			err = tools.Sed("%POLICY_SERVER_IMAGE%", policyServerImage, policyServerYaml)
+			defaultPolicyServer, err := NewKubewardenClient().GetPolicyServer(ctx, "default")
 			Expect(err).To(Not(HaveOccurred()))
+			policyServerImage, _, _ := unstructured.NestedString(defaultPolicyServer.Object, "spec", "image")
+			Expect(policyServerImage).To(Not(BeEmpty()))
 
 			// Apply the policy server
-			err = kubectl.Apply("kubewarden", policyServerYaml)
-			Expect(err).To(Not(HaveOccurred()))
+			ApplyAsset(KubewardenNamespace(), policyServerYaml, assets.PolicyServer{
+				Name:            "production",
+				Image:           policyServerImage,
+				Replicas:        1,
+				ImagePullSecret: NewInstallMode().ImagePullSecret(),
+			})
 
 			// Wait for all pods to be started
 			checkList := [][]string{
-				{"kubewarden", "app.kubernetes.io/instance=policy-server-production"},
+				{KubewardenNamespace(), "app.kubernetes.io/instance=policy-server-production"},
 			}
 			err = rancher.CheckPod(k, checkList)
 			Expect(err).To(Not(HaveOccurred()))
 
 		})
 		By("Deploying policies in the custom policy-server", func() {
-			err := kubectl.Apply("kubewarden", podPrivilegedYaml)
+			err := kubectl.Apply(KubewardenNamespace(), podPrivilegedYaml)
 			Expect(err).To(Not(HaveOccurred()))
 
 			// Wait for all pods to be started
 			checkList := [][]string{
-				{"kubewarden", "app.kubernetes.io/instance=policy-server-production"},
+				{KubewardenNamespace(), "app.kubernetes.io/instance=policy-server-production"},
 			}
 			err = rancher.CheckPod(k, checkList)
 			Expect(err).To(Not(HaveOccurred()))
@@ -131,9 +134,9 @@ var _ = Describe("E2E - Install Backup/Restore Operator", Label("install-backup-
 		PollInterval: 500 * time.Millisecond,
 	}
 
-	It("Install Backup/Restore Operator", func() {
+	It("Install Backup/Restore Operator", func(ctx SpecContext) {
 		By("Installing rancher-backup-operator", func() {
-			InstallBackupOperator(k)
+			InstallBackupOperator(ctx, k)
 		})
 	})
 })
@@ -147,9 +150,12 @@ var _ = Describe("E2E - Test full Backup/Restore", Label("test-full-backup-resto
 		PollInterval: 500 * time.Millisecond,
 	}
 
-	var backupFile string
+	var backupFile, backupCopy string
+
+	It("Do a full backup/restore test", func(ctx SpecContext) {
+		// Do not leak the privileged pods in the next specs
+		SnapshotKubewarden(ctx)
 
-	It("Do a full backup/restore test", func() {
 		By("Creating a privileged pod to trigger a report", func() {
 			_, err := kubectl.Run("run", "pod-privileged", "--image=rancher/pause:3.2", "--privileged")
 			Expect(err).To(Not(HaveOccurred()))
@@ -166,8 +172,11 @@ var _ = Describe("E2E - Test full Backup/Restore", Label("test-full-backup-resto
 		})
 
 		By("Adding a backup resource", func() {
-			err := kubectl.Apply("kubewarden", backupYaml)
-			Expect(err).To(Not(HaveOccurred()))
+			ApplyAsset("kubewarden", backupYaml, assets.Backup{
+				Name:            backupResourceName,
+				ResourceSetName: "rancher-resource-set-full",
+				RetentionCount:  1,
+			})
 		})
 
 		By("Checking that the backup has been done", func() {
@@ -181,9 +190,6 @@ var _ = Describe("E2E - Test full Backup/Restore", Label("test-full-backup-resto
 		})
 
 		By("Copying the backup file", func() {
-			// Get local storage path
-			localPath := GetBackupDir()
-
 			// Get the backup file from the previous backup
 			file, err := kubectl.RunWithoutErr("get", "backup", backupResourceName, "-o", "jsonpath={.status.filename}")
 			Expect(err).To(Not(HaveOccurred()))
@@ -191,57 +197,29 @@ var _ = Describe("E2E - Test full Backup/Restore", Label("test-full-backup-resto
 			// Share the filename across other functions
 			backupFile = file
 
-			// Copy backup file
-			err = exec.Command("sudo", "cp", localPath+"/"+backupFile, ".").Run()
-			Expect(err).To(Not(HaveOccurred()))
-		})
-
-		By("Uninstalling K3s", func() {
-			out, err := exec.Command("k3s-uninstall.sh").CombinedOutput()
-			Expect(err).To(Not(HaveOccurred()), out)
+			// Copy backup file out of the storage of the cluster
+			backupCopy = FetchBackup(backupFile)
 		})
 
-		By("Installing K3s", func() {
-			InstallK3s()
-		})
-
-		// Use the new Kube config
-		err := os.Setenv("KUBECONFIG", "/etc/rancher/k3s/k3s.yaml")
-		Expect(err).To(Not(HaveOccurred()))
-
-		By("Starting K3s", func() {
-			StartK3s()
-		})
-
-		By("Waiting for K3s to be started", func() {
-			WaitForK3s(k)
+		By("Resetting the cluster", func() {
+			ResetCluster(ctx)
 		})
 
 		By("Installing rancher-backup-operator", func() {
-			InstallBackupOperator(k)
+			InstallBackupOperator(ctx, k)
 		})
 
 		By("Copying backup file to restore", func() {
-			// Get new local storage path
-			localPath := GetBackupDir()
-
-			// Copy backup file
-			err := exec.Command("sudo", "cp", backupFile, localPath).Run()
-			Expect(err).To(Not(HaveOccurred()))
+			PutBackup(backupCopy)
 		})
 
 		By("Adding a restore resource", func() {
-			// Set the backup file in the restore resource
-			err := tools.Sed("%BACKUP_FILE%", backupFile, restoreYaml)
-			Expect(err).To(Not(HaveOccurred()))
-
-			// "prune" option should be set to true here
-			err = tools.Sed("%PRUNE%", "false", restoreYaml)
-			Expect(err).To(Not(HaveOccurred()))
-
-			// And apply
-			err = kubectl.Apply("kubewarden", restoreYaml)
-			Expect(err).To(Not(HaveOccurred()))
+			// Nothing to prune in a new cluster, see the prune spec
+			ApplyAsset("kubewarden", restoreYaml, assets.Restore{
+				Name:       restoreResourceName,
+				BackupFile: backupFile,
+				Prune:      false,
+			})
 		})
 
 		By("Checking that the restore has been done", func() {
@@ -257,49 +235,40 @@ var _ = Describe("E2E - Test full Backup/Restore", Label("test-full-backup-resto
 		})
 
 		By("Checking Kubewarden resources after restore", func() {
+			kw := NewKubewardenClient()
+
 			// Check that Kubewarden policyservers are available
 			for _, policyServer := range []string{"default", "production"} {
-				Eventually(func() string {
-					out, _ := kubectl.RunWithoutErr("get", "policyserver", policyServer,
-						"-o", "jsonpath={.status.conditions[?(@.type==\"DeploymentReconciled\")].status}")
-					return out
-				}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(ContainSubstring("True"))
+				Expect(kw.WaitPolicyServerReconciled(ctx, policyServer)).To(Succeed())
 			}
 
 			// Check that few Kubewarden CAPs are available
 			for _, policy := range []string{"do-not-run-as-root", "no-host-namespace-sharing", "no-privileged-pod"} {
-				Eventually(func() string {
-					out, _ := kubectl.RunWithoutErr("get", "cap", policy,
-						"-o", "jsonpath={.status.policyStatus}")
-					return out
-				}, tools.SetTimeout(5*time.Minute), 25*time.Second).Should(ContainSubstring("active"))
+				Expect(kw.WaitPolicyActive(ctx, kubewarden.ClusterPolicy(policy))).To(Succeed())
 			}
 
+			// And that every restored policy is able to handle requests
+			Expect(kw.WaitPolicies(ctx, kubewarden.DefaultPolicyConditions)).To(Succeed())
+
 			// Make sure the custom policy is still available and attached to the production policy server
-			Eventually(func() string {
-				out, _ := kubectl.RunWithoutErr("get", "ap", "pod-privileged", "-n", "kubewarden",
-					"-o", "jsonpath={.status.policyStatus}")
-				return out
-			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(ContainSubstring("active"))
+			customPolicy := kubewarden.Policy(KubewardenNamespace(), "pod-privileged")
+			Expect(kw.WaitPolicyActive(ctx, customPolicy)).To(Succeed())
 
-			Eventually(func() string {
-				out, _ := kubectl.RunWithoutErr("get", "ap", "pod-privileged", "-n", "kubewarden",
-					"-o", "jsonpath={.spec.policyServer}")
-				return out
-			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(ContainSubstring("production"))
+			policy, err := kw.GetPolicy(ctx, customPolicy)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(policy.Object).To(HaveKeyWithValue("spec", HaveKeyWithValue("policyServer", "production")))
 
 			// Make sure we still have our settings for the custom policy
-			Eventually(func() string {
-				out, _ := kubectl.RunWithoutErr("get", "ap", "pod-privileged", "-n", "kubewarden",
-					"-o", "jsonpath={.spec.rules[0].operations[*]}")
-				return out
-			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(ContainSubstring("CREATE UPDATE"))
+			rules, _, err := unstructured.NestedSlice(policy.Object, "spec", "rules")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(rules).To(Not(BeEmpty()))
+			Expect(rules[0]).To(HaveKeyWithValue("operations", ConsistOf("CREATE", "UPDATE")))
 
 			// Check that few Kubewarden deployments are available
 			for _, deployment := range []string{"policy-reporter", "policy-reporter-ui"} {
 				Eventually(func() string {
 					out, _ := kubectl.RunWithoutErr("get", "deployment", deployment,
-						"-n", "kubewarden", "-o", "jsonpath={.status.availableReplicas}")
+						"-n", KubewardenNamespace(), "-o", "jsonpath={.status.availableReplicas}")
 					return out
 				}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(ContainSubstring("1"))
 			}
@@ -321,3 +290,163 @@ var _ = Describe("E2E - Test full Backup/Restore", Label("test-full-backup-resto
 		})
 	})
 })
+
+/*
+Delete a Backup and the Kubewarden-only resource set when the spec ends
+  - @param name Name of the Backup resource
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func DeferDeleteBackup(name string) {
+	// Do not leak the resources of the spec in the next ones, the resource set is shared by the backups of a spec
+	DeferCleanup(func(ctx SpecContext) {
+		b := NewBackupClient()
+		Expect(b.DeleteResource(ctx, backup.KindBackup, name)).To(Succeed())
+		Expect(b.DeleteResource(ctx, backup.KindResourceSet, kubewardenResourceSet)).To(Succeed())
+	})
+}
+
+/*
+Back the Kubewarden resources up with the Kubewarden-only resource set
+  - @param name Name of the Backup resource
+  - @returns The name of the backup file
+*/
+func BackupKubewarden(ctx context.Context, name string) string {
+	DeferDeleteBackup(name)
+
+	ApplyAsset("", resourceSetYaml, assets.ResourceSet{Name: kubewardenResourceSet})
+	ApplyAsset("", backupYaml, assets.Backup{
+		Name:            name,
+		ResourceSetName: kubewardenResourceSet,
+		RetentionCount:  1,
+	})
+
+	filename, err := NewBackupClient().WaitBackup(ctx, name)
+	Expect(err).To(Not(HaveOccurred()))
+	return filename
+}
+
+/*
+Restore a backup and wait for the restore to be done
+  - @param name Name of the Restore resource
+  - @param filename Name of the backup file
+  - @param prune Delete the resources of the resource set which are not in the backup
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func RestoreKubewarden(ctx context.Context, name, filename string, prune bool) {
+	DeferCleanup(func(ctx SpecContext) {
+		Expect(NewBackupClient().DeleteResource(ctx, backup.KindRestore, name)).To(Succeed())
+	})
+
+	ApplyAsset("", restoreYaml, assets.Restore{
+		Name:       name,
+		BackupFile: filename,
+		Prune:      prune,
+	})
+
+	Expect(NewBackupClient().WaitRestore(ctx, name)).To(Succeed())
+}
+
+var _ = Describe("E2E - Test Backup/Restore with prune", Label("test-prune-backup-restore"), func() {
+	const extraPolicy = "prune-not-in-backup"
+
+	It("Restore with prune into a cluster holding extra Kubewarden resources", func(ctx SpecContext) {
+		var filename string
+		kw := NewKubewardenClient()
+
+		SnapshotKubewarden(ctx)
+
+		By("Backing up the Kubewarden resources", func() {
+			filename = BackupKubewarden(ctx, "kubewarden-prune-backup")
+		})
+
+		By("Adding a policy which is not in the backup", func() {
+			Expect(kw.Create(ctx, kubewarden.NewPodClusterPolicy(extraPolicy, "default", podPrivilegedModule))).To(Succeed())
+			Expect(kw.WaitPolicyActive(ctx, kubewarden.ClusterPolicy(extraPolicy))).To(Succeed())
+		})
+
+		By("Restoring the backup with prune", func() {
+			RestoreKubewarden(ctx, "kubewarden-prune-restore", filename, true)
+		})
+
+		By("Checking that the policy not in the backup has been removed", func() {
+			Eventually(func() error {
+				_, err := kw.GetPolicy(ctx, kubewarden.ClusterPolicy(extraPolicy))
+				return err
+			}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(Satisfy(apierrors.IsNotFound))
+		})
+
+		By("Checking that the policies of the backup are still active", func() {
+			Expect(kw.WaitPolicyServerReconciled(ctx, "default")).To(Succeed())
+			Expect(kw.WaitPolicies(ctx, kubewarden.DefaultPolicyConditions)).To(Succeed())
+		})
+	})
+})
+
+var _ = Describe("E2E - Test Kubewarden-only Backup/Restore", Label("test-selective-backup-restore"), func() {
+	const (
+		policyName    = "selective-backup"
+		configMapName = "selective-backup-not-in-resource-set"
+	)
+
+	It("Back up and restore the Kubewarden resources only", func(ctx SpecContext) {
+		var filename string
+		kw := NewKubewardenClient()
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: KubewardenNamespace(), Name: configMapName},
+			Data:       map[string]string{"backup": "no"},
+		}
+
+		SnapshotKubewarden(ctx)
+
+		By("Creating a policy and a resource outside of the resource set", func() {
+			Expect(kw.Create(ctx, kubewarden.NewPodClusterPolicy(policyName, "default", podPrivilegedModule))).To(Succeed())
+			Expect(kw.WaitPolicyActive(ctx, kubewarden.ClusterPolicy(policyName))).To(Succeed())
+
+			Expect(kw.Create(ctx, configMap)).To(Succeed())
+			DeferCleanup(func(ctx SpecContext) {
+				Expect(client.IgnoreNotFound(kw.Delete(ctx, configMap))).To(Succeed())
+			})
+		})
+
+		By("Backing up the Kubewarden resources", func() {
+			filename = BackupKubewarden(ctx, "kubewarden-selective-backup")
+		})
+
+		By("Checking that the archive holds exactly the Kubewarden resources", func() {
+			archive, err := backup.ReadArchive(FetchBackup(filename))
+			Expect(err).To(Not(HaveOccurred()))
+
+			expected := []string{}
+			for _, kind := range append([]kubewarden.Kind{kubewarden.KindPolicyServer}, kubewarden.PolicyKinds...) {
+				objs, err := kw.List(ctx, kind)
+				Expect(err).To(Not(HaveOccurred()))
+
+				for _, obj := range objs {
+					entry := backup.Entry{Resource: kind.Resource(), Group: kubewarden.Group, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+					expected = append(expected, entry.String())
+				}
+			}
+
+			Expect(archive.Groups()).To(Equal([]string{kubewarden.Group}))
+			Expect(archive.Names()).To(ConsistOf(expected))
+		})
+
+		By("Deleting the policy and the resource outside of the resource set", func() {
+			policy, err := kw.GetPolicy(ctx, kubewarden.ClusterPolicy(policyName))
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(kw.Delete(ctx, policy)).To(Succeed())
+			Expect(kw.Delete(ctx, configMap)).To(Succeed())
+		})
+
+		By("Restoring the backup", func() {
+			RestoreKubewarden(ctx, "kubewarden-selective-restore", filename, false)
+		})
+
+		By("Checking that only the Kubewarden resources have been restored", func() {
+			Expect(kw.WaitPolicyActive(ctx, kubewarden.ClusterPolicy(policyName))).To(Succeed())
+
+			err := kw.Client.Get(ctx, client.ObjectKeyFromObject(configMap), &corev1.ConfigMap{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue(), "ConfigMap %s must not be restored: %v", configMapName, err)
+		})
+	})
+})
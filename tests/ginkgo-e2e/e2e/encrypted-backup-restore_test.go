@@ -0,0 +1,332 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+	"github.com/rancher/elemental/tests/e2e/helpers/backup"
+	"github.com/rancher/elemental/tests/e2e/helpers/certs"
+	"github.com/rancher/elemental/tests/e2e/helpers/common"
+	"github.com/rancher/elemental/tests/e2e/helpers/kubewarden"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Authenticated registry of resources/private-registry-deploy.yaml
+const (
+	registryUser     = "testuser"
+	registryPassword = "testpassword"
+	// htpasswd -Bbn testuser testpassword
+	registryHtpasswd = "testuser:$2y$05$bkWZdztgNvW.akipcacKb.nueDup8NGbcTtvqDKG.3keAgUDufapm"
+	registryNodePort = "30707"
+)
+
+// PrivateRegistry is the registry deployed in the cluster, with its TLS material
+type PrivateRegistry struct {
+	// host:port, as seen from the host and the cluster
+	Host string
+	CA   *certs.CA
+	Cert *certs.KeyPair
+}
+
+/*
+Create the TLS material of the private registry
+  - @returns The registry, reachable through the nip.io name of the control-plane node
+*/
+func NewPrivateRegistry(ctx context.Context) *PrivateRegistry {
+	fqdn := ControlPlaneIP(ctx) + ".nip.io"
+
+	ca, err := certs.NewCA("kubewarden-e2e-registry")
+	Expect(err).To(Not(HaveOccurred()))
+	cert, err := ca.Issue(fqdn)
+	Expect(err).To(Not(HaveOccurred()))
+
+	return &PrivateRegistry{Host: fqdn + ":" + registryNodePort, CA: ca, Cert: cert}
+}
+
+/*
+Get the internal IP of the control-plane node
+  - @returns The IP, the function will fail through Ginkgo in case of issue
+*/
+func ControlPlaneIP(ctx context.Context) string {
+	ip, err := common.ControlPlaneIP(ctx, NewKubewardenClient().Client)
+	Expect(err).To(Not(HaveOccurred()))
+	return ip
+}
+
+// DockerConfig returns the credentials of the registry, as in ~/.docker/config.json
+func (r *PrivateRegistry) DockerConfig() []byte {
+	auth := base64.StdEncoding.EncodeToString([]byte(registryUser + ":" + registryPassword))
+	data, err := json.Marshal(map[string]any{
+		"auths": map[string]any{
+			r.Host: map[string]string{"username": registryUser, "password": registryPassword, "auth": auth},
+		},
+	})
+	Expect(err).To(Not(HaveOccurred()))
+	return data
+}
+
+// Module returns the URL of a policy module pushed in the registry
+func (r *PrivateRegistry) Module(module string) string {
+	_, ref, _ := strings.Cut(strings.TrimPrefix(module, "registry://"), "/")
+	return "registry://" + r.Host + "/" + ref
+}
+
+/*
+Deploy the registry in the default namespace, it is removed when the spec ends
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func (r *PrivateRegistry) Deploy(ctx context.Context) {
+	kw := NewKubewardenClient()
+
+	auth := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "registry-auth"},
+		Data:       map[string]string{"htpasswd": registryHtpasswd},
+	}
+	cert := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "registry-cert"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: r.Cert.CertPEM, corev1.TLSPrivateKeyKey: r.Cert.KeyPEM},
+	}
+	for _, obj := range []client.Object{auth, cert} {
+		Expect(kw.Create(ctx, obj)).To(Succeed())
+	}
+	Expect(kubectl.Apply("default", privateRegistryYaml)).To(Succeed())
+
+	DeferCleanup(func(ctx SpecContext) {
+		// The client is created again, as KUBECONFIG can change during the spec
+		kw := NewKubewardenClient()
+
+		_, err := kubectl.RunWithoutErr("delete", "--namespace", "default", "--ignore-not-found", "-f", privateRegistryYaml)
+		Expect(err).To(Not(HaveOccurred()))
+		for _, obj := range []client.Object{auth, cert} {
+			Expect(client.IgnoreNotFound(kw.Delete(ctx, obj))).To(Succeed())
+		}
+	})
+
+	_, err := kubectl.RunWithoutErr("rollout", "status", "--namespace", "default", "--timeout=5m", "deploy/registry")
+	Expect(err).To(Not(HaveOccurred()))
+}
+
+/*
+Copy a policy module into the registry with kwctl
+  - @param module URL of the public policy module
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func (r *PrivateRegistry) Push(module string) {
+	dir := GinkgoT().TempDir()
+
+	caFile := filepath.Join(dir, "ca.crt")
+	Expect(os.WriteFile(caFile, r.CA.CertPEM, 0644)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(dir, "config.json"), r.DockerConfig(), 0600)).To(Succeed())
+
+	sources, err := json.Marshal(map[string]any{
+		"source_authorities": map[string]any{
+			r.Host: []any{map[string]string{"type": "Path", "path": caFile}},
+		},
+	})
+	Expect(err).To(Not(HaveOccurred()))
+	sourcesFile := filepath.Join(dir, "sources.json")
+	Expect(os.WriteFile(sourcesFile, sources, 0600)).To(Succeed())
+
+	for _, args := range [][]string{
+		{"pull", module},
+		{"push", module, r.Module(module), "--docker-config-json-path", dir, "--sources-path", sourcesFile},
+	} {
+		out, err := exec.Command("kwctl", args...).CombinedOutput()
+		Expect(err).To(Not(HaveOccurred()), string(out))
+	}
+}
+
+/*
+Build a PolicyServer fetching its policies from the registry
+  - @param name Name of the PolicyServer
+  - @param image policy-server image
+  - @param pullSecret Secret holding the credentials of the registry
+  - @returns The PolicyServer
+*/
+func (r *PrivateRegistry) PolicyServer(name, image, pullSecret string) *unstructured.Unstructured {
+	ps := kubewarden.NewPolicyServer(name, image, 1)
+	Expect(unstructured.SetNestedField(ps.Object, pullSecret, "spec", "imagePullSecret")).To(Succeed())
+	Expect(unstructured.SetNestedField(ps.Object, map[string]any{
+		r.Host: []any{string(r.CA.CertPEM)},
+	}, "spec", "sourceAuthorities")).To(Succeed())
+
+	return ps
+}
+
+var _ = Describe("E2E - Test encrypted Backup/Restore", Label("test-encrypted-backup-restore"), func() {
+	// Create kubectl context
+	// Default timeout is too small, so New() cannot be used
+	k := &kubectl.Kubectl{
+		Namespace:    "",
+		PollTimeout:  tools.SetTimeout(300 * time.Second),
+		PollInterval: 500 * time.Millisecond,
+	}
+
+	const (
+		encryptionSecret = "encryptionconfig"
+		pullSecret       = "secret-registry-docker"
+		policyServerName = "private-registry"
+		policyName       = "private-pod-privileged"
+	)
+
+	It("Restore Kubewarden resources depending on secrets from an encrypted backup", func(ctx SpecContext) {
+		if NewInstallMode().ImagePullSecret() != "" {
+			Skip("the policy-server image needs the pull secret of the install mode")
+		}
+
+		var (
+			registry          *PrivateRegistry
+			policyServerImage string
+			backupFile        string
+		)
+
+		// The same key is used to back up and to restore
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		Expect(err).To(Not(HaveOccurred()))
+		encryptionConfig, err := backup.NewEncryptionConfigSecret(encryptionSecret, key, "secrets")
+		Expect(err).To(Not(HaveOccurred()))
+
+		SnapshotKubewarden(ctx)
+
+		By("Deploying an authenticated registry", func() {
+			registry = NewPrivateRegistry(ctx)
+			registry.Deploy(ctx)
+			registry.Push(podPrivilegedModule)
+		})
+
+		By("Deploying a policy server pulling from the registry", func() {
+			kw := NewKubewardenClient()
+
+			defaultPolicyServer, err := kw.GetPolicyServer(ctx, "default")
+			Expect(err).To(Not(HaveOccurred()))
+			policyServerImage, _, _ = unstructured.NestedString(defaultPolicyServer.Object, "spec", "image")
+			Expect(policyServerImage).To(Not(BeEmpty()))
+
+			pull := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: KubewardenNamespace(), Name: pullSecret},
+				Type:       corev1.SecretTypeDockerConfigJson,
+				Data:       map[string][]byte{corev1.DockerConfigJsonKey: registry.DockerConfig()},
+			}
+			Expect(kw.Create(ctx, pull)).To(Succeed())
+			// Deleted by name, so the restored secret is removed too
+			DeferDeleteKubewarden(pull)
+			Expect(kw.Create(ctx, registry.PolicyServer(policyServerName, policyServerImage, pullSecret))).To(Succeed())
+			Expect(kw.WaitPolicyServerReconciled(ctx, policyServerName)).To(Succeed())
+
+			Expect(kw.Create(ctx, kubewarden.NewPodClusterPolicy(policyName, policyServerName, registry.Module(podPrivilegedModule)))).To(Succeed())
+			Expect(kw.WaitPolicyActive(ctx, kubewarden.ClusterPolicy(policyName))).To(Succeed())
+		})
+
+		By("Making an encrypted backup", func() {
+			Expect(NewKubewardenClient().Create(ctx, encryptionConfig.DeepCopy())).To(Succeed())
+			// Created again for the restore, with the same name
+			DeferDeleteKubewarden(encryptionConfig.DeepCopy())
+
+			DeferDeleteBackup("kubewarden-encrypted-backup")
+			ApplyAsset("", resourceSetYaml, assets.ResourceSet{
+				Name:             kubewardenResourceSet,
+				SecretsNamespace: KubewardenNamespace(),
+				Secrets:          []string{pullSecret},
+			})
+			ApplyAsset("", backupYaml, assets.Backup{
+				Name:                       "kubewarden-encrypted-backup",
+				ResourceSetName:            kubewardenResourceSet,
+				RetentionCount:             1,
+				EncryptionConfigSecretName: encryptionSecret,
+			})
+
+			filename, err := NewBackupClient().WaitBackup(ctx, "kubewarden-encrypted-backup")
+			Expect(err).To(Not(HaveOccurred()))
+			backupFile = FetchBackup(filename)
+		})
+
+		By("Checking that the secrets are encrypted in the backup", func() {
+			archive, err := backup.ReadArchive(backupFile)
+			Expect(err).To(Not(HaveOccurred()))
+
+			secret, found := archive.Find("secrets", KubewardenNamespace(), pullSecret)
+			Expect(found).To(BeTrue(), "%s not in %v", pullSecret, archive.Names())
+			Expect(secret.Encrypted()).To(BeTrue())
+			Expect(string(secret.Data)).To(Not(ContainSubstring(registry.Host)))
+
+			policyServer, found := archive.Find(kubewarden.KindPolicyServer.Resource()+"."+kubewarden.Group, "", policyServerName)
+			Expect(found).To(BeTrue(), "%s not in %v", policyServerName, archive.Names())
+			Expect(policyServer.Encrypted()).To(BeFalse())
+		})
+
+		By("Resetting the cluster", func() {
+			ResetCluster(ctx)
+		})
+
+		By("Installing Kubewarden and rancher-backup-operator", func() {
+			InstallKubewarden(ctx, k, TargetRelease(kwRelease))
+			InstallBackupOperator(ctx, k)
+		})
+
+		By("Deploying the registry again", func() {
+			// The certificate is only valid for the previous node address
+			Expect(registry.Host).To(HavePrefix(ControlPlaneIP(ctx) + ".nip.io:"))
+			registry.Deploy(ctx)
+			registry.Push(podPrivilegedModule)
+		})
+
+		By("Restoring the encrypted backup", func() {
+			Expect(NewKubewardenClient().Create(ctx, encryptionConfig.DeepCopy())).To(Succeed())
+			PutBackup(backupFile)
+
+			DeferCleanup(func(ctx SpecContext) {
+				Expect(NewBackupClient().DeleteResource(ctx, backup.KindRestore, "kubewarden-encrypted-restore")).To(Succeed())
+			})
+			ApplyAsset("", restoreYaml, assets.Restore{
+				Name:                       "kubewarden-encrypted-restore",
+				BackupFile:                 filepath.Base(backupFile),
+				EncryptionConfigSecretName: encryptionSecret,
+			})
+			Expect(NewBackupClient().WaitRestore(ctx, "kubewarden-encrypted-restore")).To(Succeed())
+		})
+
+		By("Checking that the policy server still pulls from the registry", func() {
+			kw := NewKubewardenClient()
+
+			// The secret is decrypted, not restored as is
+			secret := &corev1.Secret{}
+			Expect(kw.Client.Get(ctx, client.ObjectKey{Namespace: KubewardenNamespace(), Name: pullSecret}, secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKeyWithValue(corev1.DockerConfigJsonKey, MatchJSON(registry.DockerConfig())))
+
+			Expect(kw.WaitPolicyServerReconciled(ctx, policyServerName)).To(Succeed())
+			Expect(kw.WaitPolicyActive(ctx, kubewarden.ClusterPolicy(policyName))).To(Succeed())
+			Expect(kw.WaitPolicies(ctx, kubewarden.DefaultPolicyConditions)).To(Succeed())
+		})
+	})
+})
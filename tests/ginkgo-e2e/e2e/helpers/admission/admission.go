@@ -0,0 +1,320 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gomodules.xyz/jsonpatch/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/yaml"
+)
+
+// Message of the API server when a validating webhook rejects a request
+var denialRegexp = regexp.MustCompile(`admission webhook "([^"]+)" denied the request:?\s*(.*)`)
+
+// Decision is the outcome of an admission request
+type Decision struct {
+	Allowed bool
+	// Namespace of the submitted object, empty for a cluster-wide object
+	Namespace string
+	// Name of the webhook denying the request, empty if allowed
+	Webhook string
+	// Denial message
+	Message  string
+	Warnings []string
+	// Changes made by the webhooks, see Admitter.BaselineNamespace. Nil if they cannot be told
+	// apart from the defaults of the API server, HavePatchOperation then fails
+	Patch []jsonpatch.Operation
+	// Object as admitted by the API server, nil if denied
+	Object client.Object
+}
+
+func (d *Decision) String() string {
+	if d.Allowed {
+		return fmt.Sprintf("allowed (%d warnings, %d patch operations)", len(d.Warnings), len(d.Patch))
+	}
+	if d.Webhook != "" {
+		return fmt.Sprintf("denied by %s: %s", d.Webhook, d.Message)
+	}
+	return "denied: " + d.Message
+}
+
+// Admitter submits objects through server-side dry-run requests
+type Admitter struct {
+	Client client.Client
+	// Namespace where no policy applies, e.g. the one of Kubewarden. The created objects are
+	// also submitted there, so the patch only holds the changes of the webhooks and not the
+	// defaults of the API server. Without it, for cluster-wide objects and for updates, there
+	// is no such baseline and the patch is not computed.
+	BaselineNamespace string
+}
+
+// warningsKey is the context key of the warnings of a request
+type warningsKey struct{}
+
+// warnings collects the warnings of a request
+type warnings struct {
+	sync.Mutex
+	list []string
+}
+
+// warningHandler dispatches the warnings to the collector of the request context
+type warningHandler struct{}
+
+func (warningHandler) HandleWarningHeaderWithContext(ctx context.Context, _ int, _ string, text string) {
+	if w, ok := ctx.Value(warningsKey{}).(*warnings); ok {
+		w.Lock()
+		defer w.Unlock()
+		w.list = append(w.list, text)
+	}
+}
+
+/*
+Create an Admitter for the current kubeconfig, with warnings collection
+  - @returns The Admitter or an error
+*/
+func New() (*Admitter, error) {
+	restConfig, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	restConfig.WarningHandler = nil
+	restConfig.WarningHandlerWithContext = warningHandler{}
+
+	c, err := client.New(restConfig, client.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewForClient(c), nil
+}
+
+/*
+Create an Admitter on top of an existing controller-runtime client
+  - @param c controller-runtime client, can be a fake one
+  - @returns The Admitter, warnings are only collected if the client uses the handler set by New()
+*/
+func NewForClient(c client.Client) *Admitter {
+	return &Admitter{Client: c}
+}
+
+/*
+Submit the creation of an object
+  - @param obj Object to create, typed or unstructured, it is not modified
+  - @returns The admission decision, or an error if the request could not be evaluated
+*/
+func (a *Admitter) Admit(ctx context.Context, obj client.Object) (*Decision, error) {
+	create := func(ctx context.Context, o client.Object) error {
+		return a.Client.Create(ctx, o, client.DryRunAll)
+	}
+	return a.submit(ctx, obj, create, create)
+}
+
+/*
+Submit the update of an existing object
+  - @param obj New version of the object, it is not modified
+  - @returns The admission decision, or an error if the request could not be evaluated
+*/
+func (a *Admitter) AdmitUpdate(ctx context.Context, obj client.Object) (*Decision, error) {
+	return a.submit(ctx, obj, func(ctx context.Context, o client.Object) error {
+		return a.Client.Update(ctx, o, client.DryRunAll)
+	}, nil)
+}
+
+/*
+Submit the creation of the object described in a YAML file
+  - @param path YAML file with a single object, e.g. a file in assets/
+  - @returns The admission decision, or an error if the request could not be evaluated
+*/
+func (a *Admitter) AdmitFile(ctx context.Context, path string) (*Decision, error) {
+	obj, err := LoadObject(path)
+	if err != nil {
+		return nil, err
+	}
+	return a.Admit(ctx, obj)
+}
+
+// submit sends the request, and the baseline one if not nil, see BaselineNamespace
+func (a *Admitter) submit(ctx context.Context, obj client.Object, request, baseline func(context.Context, client.Object) error) (*Decision, error) {
+	submitted, ok := obj.DeepCopyObject().(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("cannot copy %T", obj)
+	}
+
+	w := &warnings{}
+	err := request(context.WithValue(ctx, warningsKey{}, w), submitted)
+
+	d := &Decision{Namespace: obj.GetNamespace(), Warnings: w.list}
+	if err != nil {
+		if !denied(err) {
+			return nil, fmt.Errorf("admission request for %s failed: %w", client.ObjectKeyFromObject(obj), err)
+		}
+		d.Webhook, d.Message = parseDenial(err)
+		return d, nil
+	}
+
+	d.Allowed = true
+	d.Object = submitted
+
+	switch {
+	case baseline == nil || a.BaselineNamespace == "" || obj.GetNamespace() == "":
+		// No request free of the policies, the patch is unknown
+	case obj.GetNamespace() == a.BaselineNamespace:
+		// The request is its own baseline
+		d.Patch = []jsonpatch.Operation{}
+	default:
+		base := obj.DeepCopyObject().(client.Object)
+		base.SetNamespace(a.BaselineNamespace)
+		if err := baseline(ctx, base); err != nil {
+			return nil, fmt.Errorf("baseline request for %s in %s failed: %w", client.ObjectKeyFromObject(obj), a.BaselineNamespace, err)
+		}
+		if d.Patch, err = diff(base, submitted); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// denied returns true if the error is the rejection of the request by an admission webhook,
+// RBAC and schema errors are not denials
+func denied(err error) bool {
+	return denialRegexp.MatchString(err.Error())
+}
+
+// parseDenial extracts the webhook name and the message of a denial
+func parseDenial(err error) (string, string) {
+	msg := err.Error()
+	if status, ok := err.(apierrors.APIStatus); ok && status.Status().Message != "" {
+		msg = status.Status().Message
+	}
+
+	if m := denialRegexp.FindStringSubmatch(msg); m != nil {
+		return m[1], strings.TrimSpace(m[2])
+	}
+	return "", msg
+}
+
+// Prefix of the service account token volume, its name is random for each pod
+const serviceAccountVolumePrefix = "kube-api-access-"
+
+// withoutServiceAccountVolume returns the JSON of an object, without the service account
+// token volume generated by the API server for each pod and its mounts
+func withoutServiceAccountVolume(obj client.Object) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	generated := func(item any) bool {
+		name, _, _ := unstructured.NestedString(map[string]any{"item": item}, "item", "name")
+		return strings.HasPrefix(name, serviceAccountVolumePrefix)
+	}
+	filter := func(obj map[string]any, fields ...string) {
+		items, found, _ := unstructured.NestedSlice(obj, fields...)
+		if !found {
+			return
+		}
+		kept := []any{}
+		for _, item := range items {
+			if !generated(item) {
+				kept = append(kept, item)
+			}
+		}
+		_ = unstructured.SetNestedSlice(obj, kept, fields...)
+	}
+
+	filter(m, "spec", "volumes")
+	for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		containers, _, _ := unstructured.NestedSlice(m, "spec", field)
+		for _, c := range containers {
+			if container, ok := c.(map[string]any); ok {
+				filter(container, "volumeMounts")
+			}
+		}
+		if len(containers) > 0 {
+			_ = unstructured.SetNestedSlice(m, containers, "spec", field)
+		}
+	}
+
+	return json.Marshal(m)
+}
+
+// diff returns the JSONPatch turning the baseline object into the admitted one
+func diff(baseline, admitted client.Object) ([]jsonpatch.Operation, error) {
+	before, err := withoutServiceAccountVolume(baseline)
+	if err != nil {
+		return nil, err
+	}
+	after, err := withoutServiceAccountVolume(admitted)
+	if err != nil {
+		return nil, err
+	}
+
+	ops, err := jsonpatch.CreatePatch(before, after)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compute admission patch: %w", err)
+	}
+
+	// Drop the fields managed by the API server itself
+	patch := []jsonpatch.Operation{}
+	for _, op := range ops {
+		if op.Path == "/kind" || op.Path == "/apiVersion" ||
+			op.Path == "/status" || strings.HasPrefix(op.Path, "/status/") ||
+			(strings.HasPrefix(op.Path, "/metadata") &&
+				!strings.HasPrefix(op.Path, "/metadata/labels") && !strings.HasPrefix(op.Path, "/metadata/annotations")) {
+			continue
+		}
+		patch = append(patch, op)
+	}
+
+	return patch, nil
+}
+
+/*
+Load an object from a YAML file
+  - @param path YAML file with a single object
+  - @returns The object or an error
+*/
+func LoadObject(path string) (*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	return obj, nil
+}
+
+// Ensure the warning handler matches the client-go interface
+var _ rest.WarningHandlerWithContext = warningHandler{}
@@ -0,0 +1,223 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func newPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "pause", Image: "rancher/pause:3.2"}},
+		},
+	}
+}
+
+func newAdmitter(create func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error) *Admitter {
+	return NewForClient(fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{Create: create}).Build())
+}
+
+func TestAdmitAllowed(t *testing.T) {
+	g := NewWithT(t)
+
+	a := newAdmitter(func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+		warningHandler{}.HandleWarningHeaderWithContext(ctx, 299, "", "image tag is not pinned")
+		if obj.GetNamespace() != "kubewarden" {
+			obj.SetLabels(map[string]string{"mutated": "true"})
+		}
+		return c.Create(ctx, obj, opts...)
+	})
+	a.BaselineNamespace = "kubewarden"
+
+	pod := newPod()
+	d, err := a.Admit(context.Background(), pod)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(d).To(BeAllowed())
+	g.Expect(d).To(Not(BeDenied()))
+	g.Expect(d).To(HaveWarning("not pinned"))
+	g.Expect(d.Patch).To(HaveLen(1))
+	g.Expect(d).To(HavePatchOperation("add", "/metadata/labels"))
+
+	// The submitted object is left untouched and nothing is persisted
+	g.Expect(pod.Labels).To(BeEmpty())
+	g.Expect(a.Client.Get(context.Background(), client.ObjectKeyFromObject(pod), &corev1.Pod{})).
+		To(WithTransform(apierrors.IsNotFound, BeTrue()))
+}
+
+func TestAdmitBaseline(t *testing.T) {
+	g := NewWithT(t)
+
+	// The API server defaults the restart policy everywhere, the webhook only mutates outside of kubewarden
+	a := newAdmitter(func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+		obj.(*corev1.Pod).Spec.RestartPolicy = corev1.RestartPolicyAlways
+		if obj.GetNamespace() != "kubewarden" {
+			obj.SetLabels(map[string]string{"mutated": "true"})
+		}
+		return c.Create(ctx, obj, opts...)
+	})
+
+	// Without baseline, the defaults cannot be told apart from the mutations
+	d, err := a.Admit(context.Background(), newPod())
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(d.Patch).To(BeNil())
+	g.Expect(HavePatchOperation("add", "/spec/restartPolicy").Match(d)).Error().To(MatchError(ContainSubstring("unknown")))
+	g.Expect(Not(HavePatchOperation("add", "/spec/restartPolicy")).Match(d)).Error().To(HaveOccurred())
+
+	a.BaselineNamespace = "kubewarden"
+	pod := newPod()
+	d, err = a.Admit(context.Background(), pod)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(d.Patch).To(HaveLen(1))
+	g.Expect(d).To(HavePatchOperation("add", "/metadata/labels"))
+	g.Expect(d).To(Not(HavePatchOperation("add", "/spec/restartPolicy")))
+	g.Expect(d.Object.GetNamespace()).To(Equal("default"))
+	g.Expect(pod.Namespace).To(Equal("default"))
+
+	// Objects of the baseline namespace are not mutated by the policies
+	pod = newPod()
+	pod.Namespace = "kubewarden"
+	d, err = a.Admit(context.Background(), pod)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(d.Patch).To(BeEmpty())
+	g.Expect(d).To(Not(HavePatchOperation("add", "/metadata/labels")))
+
+	// A failing baseline is an error, not a decision
+	a = newAdmitter(func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+		if obj.GetNamespace() == "kubewarden" {
+			return apierrors.NewForbidden(corev1.Resource("pods"), "pod", errors.New("cannot create pods in kubewarden"))
+		}
+		return c.Create(ctx, obj, opts...)
+	})
+	a.BaselineNamespace = "kubewarden"
+	_, err = a.Admit(context.Background(), newPod())
+	g.Expect(err).To(MatchError(ContainSubstring("baseline request for default/pod in kubewarden failed")))
+}
+
+func TestAdmitServiceAccountVolume(t *testing.T) {
+	g := NewWithT(t)
+
+	// The API server mounts a token volume with a random name in each pod
+	a := newAdmitter(func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+		pod := obj.(*corev1.Pod)
+		name := "kube-api-access-" + pod.Namespace
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{Name: name})
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{Name: name, MountPath: "/var/run/secrets/kubernetes.io/serviceaccount"})
+		if pod.Namespace != "kubewarden" {
+			pod.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{RunAsNonRoot: ptr(true)}
+		}
+		return c.Create(ctx, obj, opts...)
+	})
+	a.BaselineNamespace = "kubewarden"
+
+	pod := newPod()
+	pod.Spec.Volumes = []corev1.Volume{{Name: "data"}}
+	pod.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "data", MountPath: "/data"}}
+	d, err := a.Admit(context.Background(), pod)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(d.Patch).To(HaveLen(1), d.GomegaString())
+	g.Expect(d).To(HavePatchOperation("add", "/spec/containers/0/securityContext"))
+	g.Expect(d.Object.(*corev1.Pod).Spec.Volumes).To(HaveLen(2))
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestAdmitDenied(t *testing.T) {
+	g := NewWithT(t)
+
+	a := newAdmitter(func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error {
+		return apierrors.NewBadRequest(`admission webhook "clusterwide-no-privileged-pod.kubewarden.admission" denied the request: Privileged container is not allowed`)
+	})
+
+	d, err := a.Admit(context.Background(), newPod())
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(d).To(BeDenied())
+	g.Expect(d).To(BeDeniedBy("no-privileged-pod"))
+	g.Expect(d).To(BeDeniedBy("clusterwide-no-privileged-pod.kubewarden.admission"))
+	g.Expect(d).To(Not(BeDeniedBy("privileged-pod")))
+	g.Expect(d).To(HaveDenialMessage("^Privileged container"))
+	g.Expect(d.Object).To(BeNil())
+}
+
+func TestAdmitError(t *testing.T) {
+	g := NewWithT(t)
+
+	a := newAdmitter(func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error {
+		return errors.New("connection refused")
+	})
+
+	_, err := a.Admit(context.Background(), newPod())
+	g.Expect(err).To(MatchError(ContainSubstring("connection refused")))
+
+	// RBAC and schema errors are not denials of a webhook
+	for _, apiErr := range []error{
+		apierrors.NewForbidden(corev1.Resource("pods"), "pod", errors.New(`User "e2e" cannot create resource "pods"`)),
+		apierrors.NewInvalid(corev1.SchemeGroupVersion.WithKind("Pod").GroupKind(), "pod", nil),
+		apierrors.NewBadRequest("the server rejected our request for an unknown reason"),
+	} {
+		a = newAdmitter(func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error {
+			return apiErr
+		})
+		_, err = a.Admit(context.Background(), newPod())
+		g.Expect(err).To(MatchError(ContainSubstring("admission request for default/pod failed")), apiErr.Error())
+	}
+}
+
+func TestDeniedBy(t *testing.T) {
+	g := NewWithT(t)
+
+	for webhook, policy := range map[string]string{
+		"namespaced-default-pod-privileged.kubewarden.admission":  "pod-privileged",
+		"namespaced-group-default-safe-pods.kubewarden.admission": "safe-pods",
+		"clusterwide-group-safe-pods.kubewarden.admission":        "safe-pods",
+		"validate.gatekeeper.sh":                                  "validate.gatekeeper.sh",
+	} {
+		d := &Decision{Namespace: "default", Webhook: webhook}
+		g.Expect(d.DeniedBy(policy)).To(BeTrue(), webhook)
+	}
+
+	// The namespace of a namespaced policy is the one of the object
+	d := &Decision{Namespace: "default", Webhook: "namespaced-ns-foo-bar.kubewarden.admission"}
+	g.Expect(d.DeniedBy("bar")).To(BeFalse())
+	g.Expect(d.DeniedBy("foo-bar")).To(BeFalse())
+	d.Namespace = "ns-foo"
+	g.Expect(d.DeniedBy("bar")).To(BeTrue())
+	g.Expect((&Decision{Webhook: "namespaced-default-bar.kubewarden.admission"}).DeniedBy("bar")).To(BeFalse())
+
+	g.Expect((&Decision{Webhook: "other.example.com"}).DeniedBy("other")).To(BeFalse())
+	g.Expect((&Decision{Allowed: true}).DeniedBy("")).To(BeFalse())
+}
+
+func TestLoadObject(t *testing.T) {
+	g := NewWithT(t)
+
+	obj, err := LoadObject("../../../assets/pod-privileged.yaml")
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(obj.GetKind()).To(Equal("AdmissionPolicy"))
+	g.Expect(obj.GetName()).To(Equal("pod-privileged"))
+}
@@ -0,0 +1,134 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/gcustom"
+	"github.com/onsi/gomega/types"
+)
+
+// Suffix of the webhooks registered by the Kubewarden controller
+const kubewardenWebhookSuffix = ".kubewarden.admission"
+
+/*
+Check if the request was denied by a policy
+  - @param policy Name of the webhook, or of the Kubewarden policy (clusterwide-<name> webhooks, and namespaced-<ns>-<name> ones for the namespace of the object)
+  - @returns true if denied by this policy
+*/
+func (d *Decision) DeniedBy(policy string) bool {
+	if d.Allowed || d.Webhook == "" {
+		return false
+	}
+	if d.Webhook == policy {
+		return true
+	}
+
+	name, ok := strings.CutSuffix(d.Webhook, kubewardenWebhookSuffix)
+	if !ok {
+		return false
+	}
+	if name == "clusterwide-"+policy || name == "clusterwide-group-"+policy {
+		return true
+	}
+	return d.Namespace != "" && (name == "namespaced-"+d.Namespace+"-"+policy || name == "namespaced-group-"+d.Namespace+"-"+policy)
+}
+
+// GomegaString is used by Gomega to print the decision in failure messages
+func (d *Decision) GomegaString() string {
+	s := d.String()
+	for _, w := range d.Warnings {
+		s += "\n  warning: " + w
+	}
+	for _, op := range d.Patch {
+		s += fmt.Sprintf("\n  patch: %s %s", op.Operation, op.Path)
+	}
+	return s
+}
+
+// toMatcher uses strings as regular expressions, like the bats helpers do
+func toMatcher(expected any) types.GomegaMatcher {
+	if m, ok := expected.(types.GomegaMatcher); ok {
+		return m
+	}
+	return gomega.MatchRegexp(fmt.Sprint(expected))
+}
+
+// BeAllowed succeeds if the request was admitted
+func BeAllowed() types.GomegaMatcher {
+	return gcustom.MakeMatcher(func(d *Decision) (bool, error) {
+		return d.Allowed, nil
+	}).WithTemplate("Expected admission decision\n{{.FormattedActual}}\n{{.To}} be allowed")
+}
+
+// BeDenied succeeds if the request was rejected by an admission webhook, whatever the webhook
+func BeDenied() types.GomegaMatcher {
+	return gcustom.MakeMatcher(func(d *Decision) (bool, error) {
+		return !d.Allowed, nil
+	}).WithTemplate("Expected admission decision\n{{.FormattedActual}}\n{{.To}} be denied")
+}
+
+/*
+Match a request rejected by a given policy
+  - @param policy Name of the webhook or of the Kubewarden policy
+  - @returns The matcher
+*/
+func BeDeniedBy(policy string) types.GomegaMatcher {
+	return gcustom.MakeMatcher(func(d *Decision) (bool, error) {
+		return d.DeniedBy(policy), nil
+	}).WithTemplate("Expected admission decision\n{{.FormattedActual}}\n{{.To}} be denied by {{.Data}}", policy)
+}
+
+/*
+Match the denial message
+  - @param expected Regular expression or Gomega matcher
+  - @returns The matcher
+*/
+func HaveDenialMessage(expected any) types.GomegaMatcher {
+	return gomega.And(BeDenied(), gomega.WithTransform(func(d *Decision) string { return d.Message }, toMatcher(expected)))
+}
+
+/*
+Match one of the warnings returned with the decision
+  - @param expected Regular expression or Gomega matcher
+  - @returns The matcher
+*/
+func HaveWarning(expected any) types.GomegaMatcher {
+	return gomega.WithTransform(func(d *Decision) []string { return d.Warnings }, gomega.ContainElement(toMatcher(expected)))
+}
+
+/*
+Match a mutation of the admitted object
+  - @param op JSONPatch operation (add, replace, remove)
+  - @param path JSON pointer of the field, e.g. /spec/containers/0/securityContext
+  - @returns The matcher
+*/
+func HavePatchOperation(op, path string) types.GomegaMatcher {
+	return gcustom.MakeMatcher(func(d *Decision) (bool, error) {
+		// Not(HavePatchOperation(...)) must not succeed without a patch
+		if d.Allowed && d.Patch == nil {
+			return false, fmt.Errorf("the patch of the admitted object is unknown, see Admitter.BaselineNamespace")
+		}
+		for _, o := range d.Patch {
+			if o.Operation == op && o.Path == path {
+				return true, nil
+			}
+		}
+		return false, nil
+	}).WithTemplate("Expected admission decision\n{{.FormattedActual}}\n{{.To}} have a {{index .Data 0}} operation on {{index .Data 1}}", []string{op, path})
+}
@@ -0,0 +1,505 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/certs"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+	"gopkg.in/yaml.v3"
+)
+
+// fakeRegistry stands in for a registry:2 behind a token service, and for the k3s release server
+type fakeRegistry struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// Manifests keyed by "repository:tag"
+	manifests map[string]bool
+	// Number of 503 answers before a manifest is served
+	unavailable map[string]int
+	// Files keyed by URL path
+	files map[string][]byte
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	r := &fakeRegistry{manifests: map[string]bool{}, unavailable: map[string]int{}, files: map[string][]byte{}}
+	r.Server = httptest.NewTLSServer(r)
+	t.Cleanup(r.Close)
+	return r
+}
+
+// Host returns the host of the registry, as used in the references
+func (r *fakeRegistry) Host() string {
+	return strings.TrimPrefix(r.URL, "https://")
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.URL.Path == "/token" {
+		if !strings.HasPrefix(req.URL.Query().Get("scope"), "repository:") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"token": "anonymous"}`)
+		return
+	}
+
+	rest, found := strings.CutPrefix(req.URL.Path, "/v2/")
+	if !found {
+		data, ok := r.files[req.URL.EscapedPath()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+		return
+	}
+
+	if req.Header.Get("Authorization") != "Bearer anonymous" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, r.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	repository, tag, _ := strings.Cut(rest, "/manifests/")
+	key := repository + ":" + tag
+	if r.unavailable[key] > 0 {
+		r.unavailable[key]--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if !r.manifests[key] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", "sha256:"+strings.Repeat("0", 64))
+}
+
+func newTestRegistry(r *fakeRegistry) *Registry {
+	return &Registry{HTTPClient: r.Client(), RetryTimeout: time.Second, RetryInterval: 10 * time.Millisecond}
+}
+
+func TestParseReference(t *testing.T) {
+	g := NewWithT(t)
+
+	for ref, expected := range map[string]Reference{
+		"ghcr.io/kubewarden/policy-server:v1.33.0":    {Registry: "ghcr.io", Repository: "kubewarden/policy-server", Tag: "v1.33.0"},
+		"rancher-manager.test:5000/hauler/k3s:latest": {Registry: "rancher-manager.test:5000", Repository: "hauler/k3s", Tag: "latest"},
+		"busybox":                 {Registry: "docker.io", Repository: "library/busybox", Tag: "latest"},
+		"rancher/kubectl:v1.33.1": {Registry: "docker.io", Repository: "rancher/kubectl", Tag: "v1.33.1"},
+	} {
+		r, err := ParseReference(ref)
+		g.Expect(err).To(Not(HaveOccurred()), ref)
+		g.Expect(r).To(Equal(expected), ref)
+	}
+
+	_, err := ParseReference("ghcr.io/kubewarden/policy-server@sha256:1234")
+	g.Expect(err).To(MatchError(ContainSubstring("digest")))
+}
+
+func TestResolve(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	fake := newFakeRegistry(t)
+	fake.manifests["kubewarden/policy-server:v1.33.0"] = true
+	fake.unavailable["kubewarden/policy-server:v1.33.0"] = 2
+	r := newTestRegistry(fake)
+
+	// Retried until the registry is back
+	digest, err := r.Resolve(ctx, fake.Host()+"/kubewarden/policy-server:v1.33.0")
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(digest).To(HavePrefix("sha256:"))
+
+	// Not retried
+	start := time.Now()
+	_, err = r.Resolve(ctx, fake.Host()+"/kubewarden/policy-server:v0.0.0")
+	g.Expect(err).To(MatchError(ContainSubstring("registry returned 404")))
+	g.Expect(time.Since(start)).To(BeNumerically("<", r.RetryTimeout))
+}
+
+func TestTLSRegistry(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	fake := newFakeRegistry(t)
+	fake.manifests["kubewarden/policies/pod-privileged:v1.0.6"] = true
+	ref := fake.Host() + "/kubewarden/policies/pod-privileged:v1.0.6"
+
+	_, err := NewTLSRegistry([]byte("not a certificate"))
+	g.Expect(err).To(HaveOccurred())
+
+	// The test server certificate is self-signed
+	r, err := NewTLSRegistry(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: fake.Certificate().Raw}))
+	g.Expect(err).To(Not(HaveOccurred()))
+	_, err = r.Resolve(ctx, ref)
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	// Another CA is rejected at once
+	ca, err := certs.NewCA("other")
+	g.Expect(err).To(Not(HaveOccurred()))
+	r, err = NewTLSRegistry(ca.CertPEM)
+	g.Expect(err).To(Not(HaveOccurred()))
+	start := time.Now()
+	_, err = r.Resolve(ctx, ref)
+	g.Expect(err).To(MatchError(ContainSubstring("certificate")))
+	g.Expect(time.Since(start)).To(BeNumerically("<", r.RetryInterval))
+}
+
+// writeFiles writes files in a directory, their paths are relative to it
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// chartArchive packs chart files the way helm package does
+func chartArchive(t *testing.T, name string, files map[string]string) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for file, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name + "/" + file, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// writeChart writes an admission-controller chart using the registry, with a packaged and a disabled subchart
+func writeChart(t *testing.T, registry string) string {
+	dir := filepath.Join(t.TempDir(), "admission-controller")
+	writeFiles(t, dir, map[string]string{
+		"Chart.yaml": `
+apiVersion: v2
+name: admission-controller
+version: 5.3.0
+appVersion: v1.33.0
+dependencies:
+  - name: policy-reporter
+    version: 3.1.0
+    repository: https://kyverno.github.io/policy-reporter
+    condition: auditScanner.policyReporter
+  - name: telemetry
+    version: 0.1.0
+    repository: file://../telemetry
+    condition: telemetry.enabled
+`,
+		"values.yaml": fmt.Sprintf(`
+global:
+  cattle:
+    systemDefaultRegistry: %s
+image:
+  repository: kubewarden/kubewarden-controller
+  tag: v1.32.0
+auditScanner:
+  policyReporter: true
+  image:
+    repository: kubewarden/audit-scanner
+    tag: v1.32.0
+policyServer:
+  image:
+    repository: kubewarden/policy-server
+preDeleteJob:
+  image:
+    repository: rancher/kubectl
+    tag: v1.33.1
+recommendedPolicies:
+  enabled: false
+  defaultPoliciesRegistry: %s
+  podPrivilegedPolicy:
+    module:
+      repository: kubewarden/policies/pod-privileged
+      tag: v1.0.5
+telemetry:
+  enabled: false
+policy-reporter:
+  ui:
+    enabled: true
+`, registry, registry),
+		"charts/telemetry/Chart.yaml":  "name: telemetry\nversion: 0.1.0\n",
+		"charts/telemetry/values.yaml": "image:\n  repository: otel/opentelemetry-collector\n  tag: 0.100.0\n",
+		"charts/policy-reporter-3.1.0.tgz": chartArchive(t, "policy-reporter", map[string]string{
+			"Chart.yaml": "name: policy-reporter\nversion: 3.1.0\nappVersion: 3.1.0\n",
+			"values.yaml": `
+image:
+  registry: ghcr.io
+  repository: kyverno/policy-reporter
+  tag: ""
+ui:
+  enabled: false
+  image:
+    registry: ghcr.io
+    repository: kyverno/policy-reporter-ui
+    tag: 2.3.0
+`,
+		}),
+	})
+	return dir
+}
+
+var testRelease = &versions.Release{
+	Version: "1.33.0",
+	Charts:  versions.Charts{AdmissionController: "5.3.0"},
+	Images:  versions.Images{Controller: "v1.33.0", PolicyServer: "v1.33.0", AuditScanner: "v1.33.0"},
+	Policies: map[string]string{
+		"podPrivilegedPolicy": "v1.0.6",
+	},
+}
+
+func TestChartImages(t *testing.T) {
+	g := NewWithT(t)
+
+	chart, err := LoadChart(writeChart(t, "registry.test"))
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(chart.Name).To(Equal("admission-controller"))
+	g.Expect(chart.Subcharts).To(HaveLen(2))
+
+	images, err := chart.Images(testRelease)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(images.Images).To(Equal([]string{
+		"ghcr.io/kyverno/policy-reporter-ui:2.3.0",
+		// Default tag of the subchart
+		"ghcr.io/kyverno/policy-reporter:3.1.0",
+		// Tags of the release
+		"registry.test/kubewarden/audit-scanner:v1.33.0",
+		"registry.test/kubewarden/kubewarden-controller:v1.33.0",
+		"registry.test/kubewarden/policy-server:v1.33.0",
+		"registry.test/rancher/kubectl:v1.33.1",
+	}))
+	g.Expect(images.Policies).To(Equal([]string{"registry.test/kubewarden/policies/pod-privileged:v1.0.6"}))
+
+	// Without release, the chart defaults are used
+	images, err = chart.Images(nil)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(images.Images).To(ContainElements(
+		"registry.test/kubewarden/kubewarden-controller:v1.32.0",
+		"registry.test/kubewarden/policy-server:v1.33.0",
+	))
+	g.Expect(images.Policies).To(Equal([]string{"registry.test/kubewarden/policies/pod-privileged:v1.0.5"}))
+}
+
+func TestParseChecksums(t *testing.T) {
+	g := NewWithT(t)
+
+	sum := strings.Repeat("a", 64)
+	sums, err := ParseChecksums([]byte(sum + "  k3s\n" + sum + " *k3s-airgap-images-amd64.tar.zst\n\n"))
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(sums).To(Equal(map[string]string{"k3s": sum, "k3s-airgap-images-amd64.tar.zst": sum}))
+
+	_, err = ParseChecksums([]byte("1234 k3s\n"))
+	g.Expect(err).To(MatchError(ContainSubstring("invalid checksum line")))
+}
+
+func sha256sum(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestBuild(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	fake := newFakeRegistry(t)
+	for _, key := range []string{
+		"kubewarden/kubewarden-controller:v1.33.0",
+		"kubewarden/audit-scanner:v1.33.0",
+		"kubewarden/policy-server:v1.33.0",
+		"rancher/kubectl:v1.33.1",
+		"kubewarden/policies/pod-privileged:v1.0.6",
+	} {
+		fake.manifests[key] = true
+	}
+	fake.files["/k3s/v1.33.1%2Bk3s1/k3s"] = []byte("k3s binary")
+	fake.files["/k3s/v1.33.1%2Bk3s1/k3s-airgap-images-amd64.tar.zst"] = []byte("k3s images")
+	fake.files["/k3s/v1.33.1%2Bk3s1/k3s-images.txt"] = []byte("docker.io/rancher/mirrored-pause:3.6\n")
+	fake.files["/k3s/v1.33.1%2Bk3s1/sha256sum-amd64.txt"] = []byte(
+		sha256sum("k3s binary") + "  k3s\n" + sha256sum("k3s images") + "  k3s-airgap-images-amd64.tar.zst\n" +
+			sha256sum("docker.io/rancher/mirrored-pause:3.6\n") + "  k3s-images.txt\n")
+	fake.files["/install.sh"] = []byte("#!/bin/sh\n")
+
+	// The subchart images are public, and not on the registry stand-in
+	chartDir := writeChart(t, fake.Host())
+	values := filepath.Join(chartDir, "values.yaml")
+	data, err := os.ReadFile(values)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(os.WriteFile(values, []byte(strings.Replace(string(data), "policyReporter: true", "policyReporter: false", 1)), 0644)).To(Succeed())
+
+	deployScript := filepath.Join(t.TempDir(), "deploy-airgap")
+	g.Expect(os.WriteFile(deployScript, []byte("#!/bin/sh\n"), 0755)).To(Succeed())
+
+	calls := []string{}
+	b := &Builder{
+		Dir:      t.TempDir(),
+		Releases: []*versions.Release{testRelease},
+		Charts:   []string{"admission-controller"},
+		LoadChart: func(_ context.Context, name, version string) (string, error) {
+			return chartDir, nil
+		},
+		K3s: K3s{
+			Version:          "v1.33.1+k3s1",
+			ReleasesURL:      fake.URL + "/k3s",
+			InstallScriptURL: fake.URL + "/install.sh",
+		},
+		K3sFiles: map[string]string{"deploy-airgap": deployScript},
+		Registry: newTestRegistry(fake),
+		Hauler: func(_ context.Context, name string, args ...string) ([]byte, error) {
+			calls = append(calls, name+" "+strings.Join(args, " "))
+			return nil, nil
+		},
+		Platform: "linux/amd64",
+	}
+
+	archive, err := b.Build(ctx)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(archive).To(Equal(filepath.Join(b.Dir, ArchiveName)))
+
+	manifest := filepath.Join(b.Dir, ManifestName)
+	store := filepath.Join(b.Dir, StoreName)
+	g.Expect(calls).To(Equal([]string{
+		"hauler store sync --store " + store + " --filename " + manifest + " --platform linux/amd64",
+		"hauler store save --store " + store + " --filename " + archive,
+	}))
+
+	// One document per content kind
+	docs := map[string]map[string]any{}
+	dec := yaml.NewDecoder(bytes.NewReader(must(os.ReadFile(manifest))))
+	for {
+		doc := map[string]any{}
+		if dec.Decode(&doc) != nil {
+			break
+		}
+		g.Expect(doc).To(HaveKeyWithValue("apiVersion", haulerAPIVersion))
+		docs[doc["kind"].(string)] = doc["spec"].(map[string]any)
+	}
+	g.Expect(docs).To(HaveKeyWithValue("Charts", HaveKeyWithValue("charts", ConsistOf(
+		map[string]any{"name": "admission-controller", "repoURL": ChartsRepoURL, "version": "5.3.0"},
+	))))
+	g.Expect(docs).To(HaveKeyWithValue("Images", HaveKeyWithValue("images", HaveLen(5))))
+	g.Expect(docs).To(HaveKeyWithValue("Images", HaveKeyWithValue("images", ContainElement(
+		map[string]any{"name": fake.Host() + "/kubewarden/policies/pod-privileged:v1.0.6"},
+	))))
+	g.Expect(docs).To(HaveKeyWithValue("Files", HaveKeyWithValue("files", ConsistOf(
+		map[string]any{"name": "k3s.tar.gz", "path": filepath.Join(b.Dir, "k3s.tar.gz")},
+	))))
+
+	// The k3s directory holds the verified artifacts and the deploy script
+	entries, err := os.ReadDir(filepath.Join(b.Dir, "k3s"))
+	g.Expect(err).To(Not(HaveOccurred()))
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	g.Expect(names).To(ConsistOf("k3s", "k3s-airgap-images-amd64.tar.zst", "k3s-images.txt", "sha256sum-amd64.txt", "install.sh", "token", "deploy-airgap"))
+	token, err := os.ReadFile(filepath.Join(b.Dir, "k3s", K3sTokenName))
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(strings.TrimSpace(string(token))).To(HaveLen(64))
+
+	// Without k3s version, e.g. for the archive of an upgrade, only the charts and images are stored
+	upgrade := *b
+	upgrade.Dir = t.TempDir()
+	upgrade.K3s = K3s{}
+	_, err = upgrade.Build(ctx)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(os.ReadFile(filepath.Join(upgrade.Dir, ManifestName))).To(Not(ContainSubstring("kind: Files")))
+	g.Expect(filepath.Join(upgrade.Dir, "k3s.tar.gz")).To(Not(BeAnExistingFile()))
+
+	// A corrupted download fails the build
+	fake.files["/k3s/v1.33.1%2Bk3s1/k3s"] = []byte("truncated")
+	_, err = b.Build(ctx)
+	g.Expect(err).To(MatchError(ContainSubstring("checksum mismatch")))
+
+	// A missing policy module fails before any download
+	fake.manifests["kubewarden/policies/pod-privileged:v1.0.6"] = false
+	calls = nil
+	_, err = b.Build(ctx)
+	g.Expect(err).To(MatchError(ContainSubstring("pod-privileged:v1.0.6")))
+	g.Expect(calls).To(BeEmpty())
+}
+
+func TestInstallHauler(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	fake := newFakeRegistry(t)
+	script := "#!/bin/sh\necho hauler\n"
+	fake.files["/hauler/install.sh"] = []byte(script)
+
+	calls := []string{}
+	b := &Builder{
+		Registry:               newTestRegistry(fake),
+		HaulerInstallScriptURL: fake.URL + "/hauler/install.sh",
+		Hauler: func(_ context.Context, name string, args ...string) ([]byte, error) {
+			calls = append(calls, name+" "+strings.Join(args, " "))
+			return nil, nil
+		},
+	}
+
+	// The script is not run if its checksum is not the known one
+	err := b.InstallHauler(ctx, "/usr/local/bin/hauler")
+	g.Expect(err).To(MatchError(ContainSubstring("checksum mismatch")))
+	g.Expect(calls).To(BeEmpty())
+
+	known := haulerInstallScriptSHA256
+	haulerInstallScriptSHA256 = sha256sum(script)
+	defer func() { haulerInstallScriptSHA256 = known }()
+
+	g.Expect(b.InstallHauler(ctx, "/usr/local/bin/hauler")).To(Succeed())
+	g.Expect(calls).To(HaveLen(2))
+	g.Expect(calls[0]).To(MatchRegexp(`^env HAULER_VERSION=1\.4\.2 HAULER_INSTALL_DIR=(\S+) bash (\S+)/install\.sh$`))
+	g.Expect(calls[1]).To(MatchRegexp(`^sudo install -m 0755 \S+/hauler /usr/local/bin/hauler$`))
+}
+
+func must(data []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
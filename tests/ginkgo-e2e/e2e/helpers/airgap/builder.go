@@ -0,0 +1,181 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package airgap
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/common"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+)
+
+// Names of the files written by the builder
+const (
+	ManifestName = "hauler-manifest.yaml"
+	ArchiveName  = "haul.tar.zst"
+	StoreName    = "store"
+)
+
+// Repository of the Kubewarden charts
+const ChartsRepoURL = "https://charts.kubewarden.io"
+
+// ChartLoader returns the directory or the archive of a chart version, e.g. pulled with helm
+type ChartLoader func(ctx context.Context, name, version string) (string, error)
+
+// Builder builds the Hauler store of the airgap tests
+type Builder struct {
+	// Directory of the manifest, the downloads, the store and the archive
+	Dir string
+	// Releases to store, e.g. the from and to releases of an upgrade
+	Releases []*versions.Release
+	// Charts of each release, names of the version matrix charts
+	Charts []string
+	// Repository the charts are pulled from by Hauler, ChartsRepoURL by default
+	ChartsRepoURL string
+	LoadChart     ChartLoader
+	// k3s artifacts, not stored if the version is empty, e.g. in the archive of an upgrade
+	K3s K3s
+	// Other files of the k3s directory, keyed by name, e.g. the deploy script
+	K3sFiles map[string]string
+	// Checks the images and policy modules, and downloads the k3s artifacts
+	Registry *Registry
+	// Runs hauler, Platform selects the images to store
+	Hauler       common.Executor
+	HaulerBinary string
+	Platform     string
+	// Install script of Hauler, HaulerInstallScriptURL by default
+	HaulerInstallScriptURL string
+}
+
+// chartVersion returns the version of a chart in a release
+func chartVersion(r *versions.Release, name string) (string, error) {
+	versions := map[string]string{
+		"kubewarden-crds":       r.Charts.CRDs,
+		"kubewarden-controller": r.Charts.Controller,
+		"kubewarden-defaults":   r.Charts.Defaults,
+		"admission-controller":  r.Charts.AdmissionController,
+	}
+
+	v, found := versions[name]
+	if !found || v == "" {
+		return "", fmt.Errorf("no version of chart %s for release %s", name, r.Version)
+	}
+	return v, nil
+}
+
+/*
+Build the Hauler manifest of the releases, every image and policy module is checked against its registry
+  - @returns The manifest, without the k3s files, or an error
+*/
+func (b *Builder) Manifest(ctx context.Context) (*Manifest, error) {
+	repoURL := b.ChartsRepoURL
+	if repoURL == "" {
+		repoURL = ChartsRepoURL
+	}
+
+	m := &Manifest{}
+	for _, r := range b.Releases {
+		for _, name := range b.Charts {
+			version, err := chartVersion(r, name)
+			if err != nil {
+				return nil, err
+			}
+			m.Charts = append(m.Charts, ManifestChart{Name: name, RepoURL: repoURL, Version: version})
+
+			path, err := b.LoadChart(ctx, name, version)
+			if err != nil {
+				return nil, fmt.Errorf("cannot get chart %s %s: %w", name, version, err)
+			}
+			chart, err := LoadChart(path)
+			if err != nil {
+				return nil, err
+			}
+			if chart.Name != name || chart.Version != version {
+				return nil, fmt.Errorf("chart %s is %s %s, expected %s %s", path, chart.Name, chart.Version, name, version)
+			}
+
+			images, err := chart.Images(r)
+			if err != nil {
+				return nil, fmt.Errorf("cannot list images of chart %s %s: %w", name, version, err)
+			}
+			m.AddImages(images.Images...)
+			m.AddImages(images.Policies...)
+		}
+	}
+
+	// Fail early instead of in the middle of the store sync
+	for _, i := range m.Images {
+		if _, err := b.Registry.Resolve(ctx, i.Name); err != nil {
+			return nil, fmt.Errorf("cannot resolve %s: %w", i.Name, err)
+		}
+	}
+
+	return m, nil
+}
+
+/*
+Build the Hauler store and save it
+  - @returns The path of the archive or an error
+*/
+func (b *Builder) Build(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(b.Dir, 0755); err != nil {
+		return "", err
+	}
+
+	m, err := b.Manifest(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if b.K3s.Version != "" {
+		k3s, err := b.packK3s(ctx, b.Dir, b.K3sFiles)
+		if err != nil {
+			return "", err
+		}
+		m.Files = append(m.Files, *k3s)
+	}
+
+	data, err := m.YAML("kubewarden-airgap")
+	if err != nil {
+		return "", err
+	}
+	manifest := filepath.Join(b.Dir, ManifestName)
+	if err := os.WriteFile(manifest, data, 0644); err != nil {
+		return "", err
+	}
+
+	hauler := b.HaulerBinary
+	if hauler == "" {
+		hauler = "hauler"
+	}
+	store := filepath.Join(b.Dir, StoreName)
+	archive := filepath.Join(b.Dir, ArchiveName)
+
+	sync := []string{"store", "sync", "--store", store, "--filename", manifest}
+	if b.Platform != "" {
+		sync = append(sync, "--platform", b.Platform)
+	}
+	if _, err := b.Hauler(ctx, hauler, sync...); err != nil {
+		return "", err
+	}
+	if _, err := b.Hauler(ctx, hauler, "store", "save", "--store", store, "--filename", archive); err != nil {
+		return "", err
+	}
+
+	return archive, nil
+}
@@ -0,0 +1,372 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/helm"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+	"gopkg.in/yaml.v3"
+)
+
+// Dependency is a dependency declared in Chart.yaml
+type Dependency struct {
+	Name       string `yaml:"name"`
+	Version    string `yaml:"version"`
+	Repository string `yaml:"repository"`
+	Condition  string `yaml:"condition"`
+}
+
+// Chart is a chart with its default values and its subcharts
+type Chart struct {
+	Name         string       `yaml:"name"`
+	Version      string       `yaml:"version"`
+	AppVersion   string       `yaml:"appVersion"`
+	Dependencies []Dependency `yaml:"dependencies"`
+
+	Values    map[string]any `yaml:"-"`
+	Subcharts []*Chart       `yaml:"-"`
+}
+
+/*
+Load a chart
+  - @param path Chart directory or packaged chart (.tgz), e.g. extracted by helm pull
+  - @returns The chart with its subcharts or an error
+*/
+func LoadChart(path string) (*Chart, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read chart: %w", err)
+	}
+
+	if !info.IsDir() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read chart: %w", err)
+		}
+		return loadArchive(data)
+	}
+
+	files := map[string][]byte{}
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)], err = os.ReadFile(p)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read chart %s: %w", path, err)
+	}
+	return loadFiles(files)
+}
+
+// loadArchive loads a packaged chart, its files are in a directory named after the chart
+func loadArchive(data []byte) (*Chart, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read chart archive: %w", err)
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read chart archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		_, name, _ := strings.Cut(hdr.Name, "/")
+		if files[name], err = io.ReadAll(tr); err != nil {
+			return nil, fmt.Errorf("cannot read chart archive: %w", err)
+		}
+	}
+	return loadFiles(files)
+}
+
+// loadFiles loads a chart from its files, keyed by their path in the chart
+func loadFiles(files map[string][]byte) (*Chart, error) {
+	meta, found := files["Chart.yaml"]
+	if !found {
+		return nil, errors.New("no Chart.yaml in chart")
+	}
+
+	c := &Chart{Values: map[string]any{}}
+	if err := yaml.Unmarshal(meta, c); err != nil {
+		return nil, fmt.Errorf("cannot parse Chart.yaml: %w", err)
+	}
+	if err := yaml.Unmarshal(files["values.yaml"], &c.Values); err != nil {
+		return nil, fmt.Errorf("cannot parse values of chart %s: %w", c.Name, err)
+	}
+
+	// Subcharts are directories or archives of the charts directory
+	dirs := map[string]map[string][]byte{}
+	archives := []string{}
+	for name, data := range files {
+		rest, found := strings.CutPrefix(name, "charts/")
+		if !found {
+			continue
+		}
+		if dir, file, found := strings.Cut(rest, "/"); found {
+			if dirs[dir] == nil {
+				dirs[dir] = map[string][]byte{}
+			}
+			dirs[dir][file] = data
+		} else if strings.HasSuffix(rest, ".tgz") {
+			archives = append(archives, name)
+		}
+	}
+
+	for _, files := range dirs {
+		sub, err := loadFiles(files)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load subchart of %s: %w", c.Name, err)
+		}
+		c.Subcharts = append(c.Subcharts, sub)
+	}
+	for _, name := range archives {
+		sub, err := loadArchive(files[name])
+		if err != nil {
+			return nil, fmt.Errorf("cannot load subchart %s of %s: %w", name, c.Name, err)
+		}
+		c.Subcharts = append(c.Subcharts, sub)
+	}
+	sort.Slice(c.Subcharts, func(i, j int) bool { return c.Subcharts[i].Name < c.Subcharts[j].Name })
+
+	return c, nil
+}
+
+// Repositories of the Kubewarden images, the tags come from the version matrix
+const (
+	controllerRepository   = "kubewarden/kubewarden-controller"
+	policyServerRepository = "kubewarden/policy-server"
+	auditScannerRepository = "kubewarden/audit-scanner"
+)
+
+// Images are the images and policy modules of a chart
+type Images struct {
+	Images   []string
+	Policies []string
+}
+
+/*
+List the images and the recommended policy modules of a chart and of its enabled subcharts
+  - @param r Release giving the Kubewarden image and policy tags, the chart defaults are used if nil
+  - @returns The sorted references or an error if a tag is missing
+*/
+func (c *Chart) Images(r *versions.Release) (*Images, error) {
+	images := map[string]bool{}
+	policies := map[string]bool{}
+
+	if err := c.collect(c.Values, "", r, images, policies); err != nil {
+		return nil, err
+	}
+	return &Images{Images: sortedKeys(images), Policies: sortedKeys(policies)}, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// collect walks the values of a chart, then the ones of its enabled subcharts
+func (c *Chart) collect(values map[string]any, prefix string, r *versions.Release, images, policies map[string]bool) error {
+	registry := "docker.io"
+	if v, found := helm.Lookup(values, "global.cattle.systemDefaultRegistry"); found && v != "" && v != nil {
+		registry = fmt.Sprint(v)
+	}
+	policiesRegistry := registry
+	if v, found := helm.Lookup(values, "recommendedPolicies.defaultPoliciesRegistry"); found && v != "" && v != nil {
+		policiesRegistry = fmt.Sprint(v)
+	}
+
+	var walk func(v any, path string) error
+	walk = func(v any, path string) error {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+
+		if repository, ok := m["repository"].(string); ok && repository != "" {
+			policy := strings.HasPrefix(path, "recommendedPolicies.") && strings.HasSuffix(path, ".module")
+			ref, err := c.reference(m, path, policy, registry, policiesRegistry, r)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", prefix, path, err)
+			}
+			if policy {
+				policies[ref] = true
+			} else {
+				images[ref] = true
+			}
+			return nil
+		}
+
+		for k, child := range m {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			if err := walk(child, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Subcharts have their own walk
+	own := map[string]any{}
+	for k, v := range values {
+		if !c.isSubchart(k) {
+			own[k] = v
+		}
+	}
+	if err := walk(own, ""); err != nil {
+		return err
+	}
+
+	for _, sub := range c.Subcharts {
+		if !c.enabled(sub.Name, values) {
+			continue
+		}
+		subValues := mergeValues(sub.Values, values[sub.Name])
+		if global, ok := values["global"]; ok {
+			subValues["global"] = mergeValues(asMap(subValues["global"]), global)
+		}
+		if err := sub.collect(subValues, prefix+sub.Name+".", r, images, policies); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reference builds the reference of an image or policy module value
+func (c *Chart) reference(m map[string]any, path string, policy bool, registry, policiesRegistry string, r *versions.Release) (string, error) {
+	repository := m["repository"].(string)
+	tag, _ := m["tag"].(string)
+
+	if policy {
+		registry = policiesRegistry
+	}
+	if v, ok := m["registry"].(string); ok && v != "" {
+		registry = v
+	}
+
+	if r != nil {
+		switch {
+		case policy:
+			// recommendedPolicies.<name>.module
+			name := strings.TrimSuffix(strings.TrimPrefix(path, "recommendedPolicies."), ".module")
+			if t := r.Policies[name]; t != "" {
+				tag = t
+			}
+		case strings.HasSuffix(repository, controllerRepository) && r.Images.Controller != "":
+			tag = r.Images.Controller
+		case strings.HasSuffix(repository, policyServerRepository) && r.Images.PolicyServer != "":
+			tag = r.Images.PolicyServer
+		case strings.HasSuffix(repository, auditScannerRepository) && r.Images.AuditScanner != "":
+			tag = r.Images.AuditScanner
+		}
+	}
+
+	// Charts use the application version as default image tag
+	if tag == "" {
+		tag = c.AppVersion
+	}
+	if tag == "" {
+		return "", fmt.Errorf("no tag for %s", repository)
+	}
+
+	// A registry in the repository takes precedence
+	if host, _, found := strings.Cut(repository, "/"); found && strings.ContainsAny(host, ".:") {
+		return repository + ":" + tag, nil
+	}
+	return registry + "/" + repository + ":" + tag, nil
+}
+
+func (c *Chart) isSubchart(name string) bool {
+	for _, sub := range c.Subcharts {
+		if sub.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// enabled evaluates the condition of a dependency, dependencies without condition are enabled
+func (c *Chart) enabled(name string, values map[string]any) bool {
+	for _, d := range c.Dependencies {
+		if d.Name != name || d.Condition == "" {
+			continue
+		}
+		// The first condition found in the values wins
+		for _, cond := range strings.Split(d.Condition, ",") {
+			if v, found := helm.Lookup(values, strings.TrimSpace(cond)); found {
+				enabled, ok := v.(bool)
+				return !ok || enabled
+			}
+		}
+	}
+	return true
+}
+
+func asMap(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+// mergeValues returns a copy of the default values with the overrides applied
+func mergeValues(defaults map[string]any, overrides any) map[string]any {
+	merged := map[string]any{}
+	for k, v := range defaults {
+		merged[k] = v
+	}
+
+	for k, v := range asMap(overrides) {
+		if d, ok := merged[k].(map[string]any); ok {
+			if o, ok := v.(map[string]any); ok {
+				merged[k] = mergeValues(d, o)
+				continue
+			}
+		}
+		merged[k] = v
+	}
+	return merged
+}
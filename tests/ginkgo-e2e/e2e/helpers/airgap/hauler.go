@@ -0,0 +1,58 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package airgap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// Hauler release of the airgap tests, installed with its install script
+const (
+	HaulerVersion          = "1.4.2"
+	HaulerInstallScriptURL = "https://raw.githubusercontent.com/hauler-dev/hauler/v" + HaulerVersion + "/install.sh"
+)
+
+// SHA256 of the install script of HaulerVersion
+var haulerInstallScriptSHA256 = "8089730ce8384dc0d520c67f539ceaaba1243078b2ceacd0deb44fea23628466"
+
+/*
+Install Hauler with its install script, checked against its known checksum
+  - @param dest Path of the installed binary, e.g. /usr/local/bin/hauler, written with sudo
+  - @returns Nothing or an error
+*/
+func (b *Builder) InstallHauler(ctx context.Context, dest string) error {
+	dir, err := os.MkdirTemp("", "hauler-install")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	scriptURL := b.HaulerInstallScriptURL
+	if scriptURL == "" {
+		scriptURL = HaulerInstallScriptURL
+	}
+	script := filepath.Join(dir, "install.sh")
+	if _, err := b.download(ctx, scriptURL, script, haulerInstallScriptSHA256); err != nil {
+		return err
+	}
+
+	if _, err := b.Hauler(ctx, "env", "HAULER_VERSION="+HaulerVersion, "HAULER_INSTALL_DIR="+dir, "bash", script); err != nil {
+		return err
+	}
+	_, err = b.Hauler(ctx, "sudo", "install", "-m", "0755", filepath.Join(dir, "hauler"), dest)
+	return err
+}
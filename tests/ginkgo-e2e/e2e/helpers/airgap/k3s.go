@@ -0,0 +1,279 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package airgap
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Default locations of the k3s artifacts
+const (
+	K3sReleasesURL      = "https://github.com/k3s-io/k3s/releases/download"
+	K3sInstallScriptURL = "https://get.k3s.io"
+)
+
+// Name of the file holding the token shared by the server and the agents
+const K3sTokenName = "token"
+
+// K3s are the artifacts of an airgap k3s install
+type K3s struct {
+	// Release, e.g. v1.33.1+k3s1
+	Version string
+	// Architecture, amd64 by default
+	Arch string
+	// Base URL of the releases and URL of the install script, the public ones by default
+	ReleasesURL      string
+	InstallScriptURL string
+}
+
+func (k K3s) arch() string {
+	if k.Arch == "" {
+		return "amd64"
+	}
+	return k.Arch
+}
+
+// Binary returns the name of the k3s binary of the architecture
+func (k K3s) Binary() string {
+	if k.arch() == "amd64" {
+		return "k3s"
+	}
+	return "k3s-" + k.arch()
+}
+
+// Artifacts returns the files of the release needed for an airgap install, the image list is used by the Verifier
+func (k K3s) Artifacts() []string {
+	return []string{k.Binary(), "k3s-airgap-images-" + k.arch() + ".tar.zst", "k3s-images.txt"}
+}
+
+// releaseURL returns the URL of a file of the release, "+" must be escaped
+func (k K3s) releaseURL(file string) string {
+	base := k.ReleasesURL
+	if base == "" {
+		base = K3sReleasesURL
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.ReplaceAll(k.Version, "+", "%2B") + "/" + file
+}
+
+/*
+Parse a sha256sum file
+  - @param data Lines of "<checksum>  <file>"
+  - @returns The checksums keyed by file name or an error
+*/
+func ParseChecksums(data []byte) (map[string]string, error) {
+	sums := map[string]string{}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid checksum line %q", s.Text())
+		}
+		// sha256sum marks binary files with a star
+		sums[strings.TrimPrefix(fields[1], "*")] = fields[0]
+	}
+	return sums, s.Err()
+}
+
+/*
+Download a file, the transient errors are retried
+  - @param url URL of the file
+  - @param dest Destination file
+  - @param sum Expected SHA256, not checked if empty
+  - @returns The SHA256 of the file or an error
+*/
+func (b *Builder) download(ctx context.Context, url, dest, sum string) (string, error) {
+	var data []byte
+	var last error
+
+	err := wait.PollUntilContextTimeout(ctx, b.Registry.RetryInterval, b.Registry.RetryTimeout, true, func(ctx context.Context) (bool, error) {
+		data, last = b.get(ctx, url)
+		if last != nil && !transient(last) {
+			return false, last
+		}
+		return last == nil, nil
+	})
+	if err != nil {
+		if last != nil {
+			return "", last
+		}
+		return "", err
+	}
+
+	digest := sha256.Sum256(data)
+	got := hex.EncodeToString(digest[:])
+	if sum != "" && got != sum {
+		return "", fmt.Errorf("checksum mismatch for %s: got %s, expected %s", url, got, sum)
+	}
+	return got, os.WriteFile(dest, data, 0755)
+}
+
+func (b *Builder) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := b.Registry.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &RegistryError{Reference: url, StatusCode: resp.StatusCode}
+	}
+	return io.ReadAll(resp.Body)
+}
+
+/*
+Download the k3s artifacts, check them against the checksums of the release and pack them
+  - @param dir Directory receiving the k3s directory and its archive
+  - @param extra Other files of the k3s directory, e.g. the deploy script, keyed by name
+  - @returns The archive of the k3s directory, as a Hauler file, or an error
+*/
+func (b *Builder) packK3s(ctx context.Context, dir string, extra map[string]string) (*ManifestFile, error) {
+	k := b.K3s
+	k3sDir := filepath.Join(dir, "k3s")
+	if err := os.MkdirAll(k3sDir, 0755); err != nil {
+		return nil, err
+	}
+
+	sumsFile := "sha256sum-" + k.arch() + ".txt"
+	if _, err := b.download(ctx, k.releaseURL(sumsFile), filepath.Join(k3sDir, sumsFile), ""); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(k3sDir, sumsFile))
+	if err != nil {
+		return nil, err
+	}
+	sums, err := ParseChecksums(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", sumsFile, err)
+	}
+
+	for _, file := range k.Artifacts() {
+		if sums[file] == "" {
+			return nil, fmt.Errorf("no checksum for %s in %s", file, sumsFile)
+		}
+		if _, err := b.download(ctx, k.releaseURL(file), filepath.Join(k3sDir, file), sums[file]); err != nil {
+			return nil, err
+		}
+	}
+
+	// The install script is not part of the release, hence has no checksum
+	installScript := k.InstallScriptURL
+	if installScript == "" {
+		installScript = K3sInstallScriptURL
+	}
+	if _, err := b.download(ctx, installScript, filepath.Join(k3sDir, "install.sh"), ""); err != nil {
+		return nil, err
+	}
+
+	// The agents join the server with the token of the store
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(k3sDir, K3sTokenName), []byte(hex.EncodeToString(token)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+
+	for name, src := range extra {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(k3sDir, name), data, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	archive := filepath.Join(dir, "k3s.tar.gz")
+	sum, err := tarGz(k3sDir, archive)
+	if err != nil {
+		return nil, fmt.Errorf("cannot pack %s: %w", k3sDir, err)
+	}
+	return &ManifestFile{Path: archive, Name: filepath.Base(archive), SHA256: sum}, nil
+}
+
+/*
+Pack a directory, its files are in a directory of the same name in the archive
+  - @param dir Directory without subdirectories
+  - @param archive Destination file
+  - @returns The SHA256 of the archive or an error
+*/
+func tarGz(dir, archive string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	names := []string{}
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		hdr := &tar.Header{Name: filepath.Base(dir) + "/" + name, Mode: 0755, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:]), os.WriteFile(archive, buf.Bytes(), 0644)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package airgap
+
+import (
+	"bytes"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// API version of the Hauler content manifests
+const haulerAPIVersion = "content.hauler.cattle.io/v1"
+
+// ManifestChart is a chart to store, pulled from a Helm repository
+type ManifestChart struct {
+	Name    string `yaml:"name"`
+	RepoURL string `yaml:"repoURL"`
+	Version string `yaml:"version"`
+}
+
+// ManifestImage is an image or a policy module to store
+type ManifestImage struct {
+	Name string `yaml:"name"`
+}
+
+// ManifestFile is a file to store, extracted with "hauler store extract hauler/<name>"
+type ManifestFile struct {
+	Path string `yaml:"path"`
+	Name string `yaml:"name"`
+	// Checksum verified when the file was fetched, not part of the Hauler manifest
+	SHA256 string `yaml:"-"`
+}
+
+// Manifest is the content of the airgap store
+type Manifest struct {
+	Charts []ManifestChart
+	Images []ManifestImage
+	Files  []ManifestFile
+}
+
+// AddImages adds images, the duplicates are ignored
+func (m *Manifest) AddImages(refs ...string) {
+	for _, ref := range refs {
+		found := false
+		for _, i := range m.Images {
+			found = found || i.Name == ref
+		}
+		if !found {
+			m.Images = append(m.Images, ManifestImage{Name: ref})
+		}
+	}
+	sort.Slice(m.Images, func(i, j int) bool { return m.Images[i].Name < m.Images[j].Name })
+}
+
+type haulerDocument struct {
+	APIVersion string         `yaml:"apiVersion"`
+	Kind       string         `yaml:"kind"`
+	Metadata   map[string]any `yaml:"metadata"`
+	Spec       map[string]any `yaml:"spec"`
+}
+
+/*
+Render the Hauler manifest, one document per content kind
+  - @param name Prefix of the names of the documents
+  - @returns The YAML manifest, as given to "hauler store sync --filename"
+*/
+func (m *Manifest) YAML(name string) ([]byte, error) {
+	docs := []haulerDocument{}
+	if len(m.Charts) > 0 {
+		docs = append(docs, haulerDocument{Kind: "Charts", Metadata: map[string]any{"name": name + "-charts"}, Spec: map[string]any{"charts": m.Charts}})
+	}
+	if len(m.Images) > 0 {
+		docs = append(docs, haulerDocument{Kind: "Images", Metadata: map[string]any{"name": name + "-images"}, Spec: map[string]any{"images": m.Images}})
+	}
+	if len(m.Files) > 0 {
+		docs = append(docs, haulerDocument{Kind: "Files", Metadata: map[string]any{"name": name + "-files"}, Spec: map[string]any{"files": m.Files}})
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	for _, d := range docs {
+		d.APIVersion = haulerAPIVersion
+		if err := enc.Encode(d); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,281 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package airgap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Reference is a parsed image or policy module reference
+type Reference struct {
+	// Registry host, with the port if any
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+func (r Reference) String() string {
+	return r.Registry + "/" + r.Repository + ":" + r.Tag
+}
+
+/*
+Parse an image reference, the Docker Hub defaults are applied
+  - @param ref Reference, e.g. ghcr.io/kubewarden/policy-server:v1.33.0 or busybox
+  - @returns The reference or an error, digests are not supported
+*/
+func ParseReference(ref string) (Reference, error) {
+	if strings.Contains(ref, "@") {
+		return Reference{}, fmt.Errorf("digest references are not supported: %s", ref)
+	}
+
+	r := Reference{Registry: "docker.io", Repository: ref, Tag: "latest"}
+
+	// The first component is a registry if it looks like a host
+	if host, rest, found := strings.Cut(ref, "/"); found && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		r.Registry, r.Repository = host, rest
+	}
+	if i := strings.LastIndex(r.Repository, ":"); i >= 0 {
+		r.Repository, r.Tag = r.Repository[:i], r.Repository[i+1:]
+	}
+	if r.Registry == "docker.io" && !strings.Contains(r.Repository, "/") {
+		r.Repository = "library/" + r.Repository
+	}
+
+	if r.Repository == "" || r.Tag == "" {
+		return Reference{}, fmt.Errorf("invalid reference %q", ref)
+	}
+	return r, nil
+}
+
+// Media types accepted for the manifests, images and policy modules
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Registry checks the references against their registry, anonymously
+type Registry struct {
+	HTTPClient *http.Client
+	// Time during which the transient errors are retried
+	RetryTimeout  time.Duration
+	RetryInterval time.Duration
+}
+
+// NewRegistry returns a registry client with the default retry timings
+func NewRegistry() *Registry {
+	return &Registry{
+		HTTPClient:    http.DefaultClient,
+		RetryTimeout:  2 * time.Minute,
+		RetryInterval: 10 * time.Second,
+	}
+}
+
+/*
+Create a registry client trusting a private CA only, e.g. the one of the airgap registry
+  - @param caPEM PEM encoded CA certificate
+  - @returns The client with the default retry timings, or an error if the CA cannot be parsed
+*/
+func NewTLSRegistry(caPEM []byte) (*Registry, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no certificate found in the CA")
+	}
+
+	r := NewRegistry()
+	r.HTTPClient = &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}}
+	return r, nil
+}
+
+// RegistryError is an unexpected response of a registry
+type RegistryError struct {
+	Reference  string
+	StatusCode int
+}
+
+func (e *RegistryError) Error() string {
+	return fmt.Sprintf("%s: registry returned %d", e.Reference, e.StatusCode)
+}
+
+// transient returns true for the errors worth a retry
+func transient(err error) bool {
+	var e *RegistryError
+	if errors.As(err, &e) {
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+	}
+	// An untrusted certificate does not get trusted by retrying
+	var verify *tls.CertificateVerificationError
+	if errors.As(err, &verify) {
+		return false
+	}
+	// Network errors
+	return err != nil
+}
+
+/*
+Resolve a reference to the digest of its manifest, the transient errors are retried
+  - @param ref Image or policy module reference
+  - @returns The digest or an error, RegistryError with 404 if the reference does not exist
+*/
+func (r *Registry) Resolve(ctx context.Context, ref string) (string, error) {
+	parsed, err := ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+
+	var digest string
+	var last error
+
+	err = wait.PollUntilContextTimeout(ctx, r.RetryInterval, r.RetryTimeout, true, func(ctx context.Context) (bool, error) {
+		digest, last = r.head(ctx, parsed)
+		if last != nil && !transient(last) {
+			return false, last
+		}
+		return last == nil, nil
+	})
+	if err != nil {
+		if last != nil {
+			return "", last
+		}
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// registryHost returns the API host of a registry
+func registryHost(registry string) string {
+	if registry == "docker.io" {
+		return "registry-1.docker.io"
+	}
+	return registry
+}
+
+// head requests the manifest of a reference, with an anonymous token if asked for
+func (r *Registry) head(ctx context.Context, ref Reference) (string, error) {
+	u := "https://" + registryHost(ref.Registry) + "/v2/" + ref.Repository + "/manifests/" + ref.Tag
+
+	resp, err := r.send(ctx, http.MethodHead, u, "")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := r.token(ctx, resp.Header.Get("WWW-Authenticate"), ref)
+		if err != nil {
+			return "", err
+		}
+		if resp, err = r.send(ctx, http.MethodHead, u, token); err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &RegistryError{Reference: ref.String(), StatusCode: resp.StatusCode}
+	}
+	return resp.Header.Get("Docker-Content-Digest"), nil
+}
+
+func (r *Registry) send(ctx context.Context, method, u, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	httpClient := r.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+/*
+Get an anonymous pull token
+  - @param challenge WWW-Authenticate header, e.g. Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:kubewarden/policy-server:pull"
+  - @param ref Reference to pull, gives the scope if the challenge has none
+  - @returns The token or an error
+*/
+func (r *Registry) token(ctx context.Context, challenge string, ref Reference) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("%s: unsupported authentication %q", ref, challenge)
+	}
+
+	attrs := map[string]string{}
+	for _, p := range strings.Split(params, ",") {
+		if k, v, found := strings.Cut(strings.TrimSpace(p), "="); found {
+			attrs[k] = strings.Trim(v, `"`)
+		}
+	}
+	if attrs["realm"] == "" {
+		return "", fmt.Errorf("%s: no realm in %q", ref, challenge)
+	}
+	if attrs["scope"] == "" {
+		attrs["scope"] = "repository:" + ref.Repository + ":pull"
+	}
+
+	query := url.Values{"scope": {attrs["scope"]}}
+	if attrs["service"] != "" {
+		query.Set("service", attrs["service"])
+	}
+	resp, err := r.send(ctx, http.MethodGet, attrs["realm"]+"?"+query.Encode(), "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &RegistryError{Reference: ref.String(), StatusCode: resp.StatusCode}
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	// Docker Hub returns both fields, other registries one of them
+	t := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return "", fmt.Errorf("%s: cannot parse token: %w", ref, err)
+	}
+	if t.Token == "" {
+		t.Token = t.AccessToken
+	}
+	return t.Token, nil
+}
@@ -0,0 +1,277 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package airgap
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/diagnostics"
+	"github.com/rancher/elemental/tests/e2e/helpers/kubewarden"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Mirror is the registry serving the Hauler store on the airgap VM
+const Mirror = "rancher-manager.test:5000"
+
+// Violation is a reference which does not come from the mirror
+type Violation struct {
+	// Where the reference was found, e.g. "pod kube-system/coredns-5d8f container coredns"
+	Source    string
+	Reference string
+}
+
+func (v Violation) String() string {
+	return v.Source + ": " + v.Reference
+}
+
+// Verifier checks that nothing in the cluster was fetched from outside the mirror
+type Verifier struct {
+	// Registry host, Mirror by default
+	Mirror string
+	// Images imported from the k3s airgap tarball, allowed without the mirror, see ReadImageList
+	Allowed []string
+	// Client of the airgap cluster
+	Kubewarden *kubewarden.Client
+	// Runs commands on the node, containerd is not checked if nil
+	Node diagnostics.Runner
+}
+
+func (v *Verifier) mirror() string {
+	if v.Mirror == "" {
+		return Mirror
+	}
+	return v.Mirror
+}
+
+/*
+Read the list of the images of the k3s airgap tarball
+  - @param file k3s-images.txt of the k3s release
+  - @returns The image references or an error
+*/
+func ReadImageList(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image list: %w", err)
+	}
+
+	images := []string{}
+	s := bufio.NewScanner(strings.NewReader(string(data)))
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			images = append(images, line)
+		}
+	}
+	return images, s.Err()
+}
+
+// normalize returns the full form of a reference, e.g. docker.io/library/busybox:latest for busybox
+func normalize(ref string) string {
+	// Keep the digest references as they are
+	if r, err := ParseReference(ref); err == nil {
+		return r.String()
+	}
+	return ref
+}
+
+// fromMirror returns true if the reference is on the mirror
+func (v *Verifier) fromMirror(ref string) bool {
+	return strings.HasPrefix(ref, v.mirror()+"/")
+}
+
+// allowed returns true if the reference is on the mirror or imported by k3s
+func (v *Verifier) allowed(ref string) bool {
+	if v.fromMirror(ref) {
+		return true
+	}
+	for _, a := range v.Allowed {
+		if normalize(a) == normalize(ref) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Check the images of the running pods and of the PolicyServers
+  - @returns The references which are neither on the mirror nor imported by k3s, or an error
+*/
+func (v *Verifier) PodImages(ctx context.Context) ([]Violation, error) {
+	violations := []Violation{}
+
+	pods := &corev1.PodList{}
+	if err := v.Kubewarden.Client.List(ctx, pods); err != nil {
+		return nil, err
+	}
+	for _, p := range pods.Items {
+		containers := append(append([]corev1.Container{}, p.Spec.InitContainers...), p.Spec.Containers...)
+		for _, c := range p.Spec.EphemeralContainers {
+			containers = append(containers, corev1.Container(c.EphemeralContainerCommon))
+		}
+		for _, c := range containers {
+			if !v.allowed(c.Image) {
+				violations = append(violations, Violation{
+					Source:    fmt.Sprintf("pod %s/%s container %s", p.Namespace, p.Name, c.Name),
+					Reference: c.Image,
+				})
+			}
+		}
+	}
+
+	servers, err := v.Kubewarden.List(ctx, kubewarden.KindPolicyServer)
+	if err != nil {
+		return nil, err
+	}
+	for _, ps := range servers {
+		image, _, _ := unstructured.NestedString(ps.Object, "spec", "image")
+		if !v.allowed(image) {
+			violations = append(violations, Violation{Source: "PolicyServer " + ps.GetName(), Reference: image})
+		}
+	}
+
+	return violations, nil
+}
+
+// policyModules returns the modules of a policy, the ones of its members for a group
+func policyModules(obj *unstructured.Unstructured) map[string]string {
+	modules := map[string]string{}
+
+	if module, found, _ := unstructured.NestedString(obj.Object, "spec", "module"); found {
+		modules[""] = module
+	}
+	members, _, _ := unstructured.NestedMap(obj.Object, "spec", "policies")
+	for name, m := range members {
+		if module, ok := asMap(m)["module"].(string); ok {
+			modules[name] = module
+		}
+	}
+	return modules
+}
+
+/*
+Check the module URLs of the policies and of the policy group members
+  - @returns The modules which are not pulled from the mirror, or an error
+*/
+func (v *Verifier) PolicyModules(ctx context.Context) ([]Violation, error) {
+	violations := []Violation{}
+
+	for _, kind := range kubewarden.PolicyKinds {
+		policies, err := v.Kubewarden.List(ctx, kind)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range policies {
+			source := string(kind) + " " + policies[i].GetName()
+			if ns := policies[i].GetNamespace(); ns != "" {
+				source = string(kind) + " " + ns + "/" + policies[i].GetName()
+			}
+
+			for member, module := range policyModules(&policies[i]) {
+				// Other schemes (https, file) never use the mirror
+				ref, isRegistry := strings.CutPrefix(module, "registry://")
+				if isRegistry && v.fromMirror(ref) {
+					continue
+				}
+				s := source
+				if member != "" {
+					s += " member " + member
+				}
+				violations = append(violations, Violation{Source: s, Reference: module})
+			}
+		}
+	}
+
+	sort.Slice(violations, func(i, j int) bool { return violations[i].String() < violations[j].String() })
+	return violations, nil
+}
+
+/*
+Parse the output of "ctr images ls"
+  - @param out Output with its header, the columns are REF TYPE DIGEST SIZE PLATFORMS LABELS
+  - @returns The references of the images
+*/
+func ParseContainerdImages(out string) []string {
+	images := []string{}
+
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || fields[0] == "REF" {
+			continue
+		}
+		images = append(images, fields[0])
+	}
+	return images
+}
+
+/*
+Check the containerd store of the node
+  - @returns The images neither on the mirror nor in Allowed, pinned ones included, or an error
+*/
+func (v *Verifier) ContainerdImages(ctx context.Context) ([]Violation, error) {
+	// The command of the node cannot be cancelled, do not start it for nothing
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	out, err := v.Node.Run("sudo k3s ctr -n k8s.io images ls")
+	if err != nil {
+		return nil, fmt.Errorf("cannot list containerd images: %w: %s", err, out)
+	}
+
+	violations := []Violation{}
+	for _, ref := range ParseContainerdImages(out) {
+		// Each image is also listed by digest. The pinned label of k3s is not enough,
+		// any image can be imported from a tarball: it must be in its image list too
+		if strings.HasPrefix(ref, "sha256:") || v.allowed(ref) {
+			continue
+		}
+		violations = append(violations, Violation{Source: "containerd", Reference: ref})
+	}
+	return violations, nil
+}
+
+/*
+Run all the checks
+  - @returns Every violation found, or an error if a check cannot run
+*/
+func (v *Verifier) Verify(ctx context.Context) ([]Violation, error) {
+	violations, err := v.PodImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	modules, err := v.PolicyModules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	violations = append(violations, modules...)
+
+	if v.Node != nil {
+		images, err := v.ContainerdImages(ctx)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, images...)
+	}
+
+	return violations, nil
+}
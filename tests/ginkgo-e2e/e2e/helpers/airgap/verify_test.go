@@ -0,0 +1,148 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package airgap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/kubewarden"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeNode struct {
+	out string
+	cmd string
+}
+
+func (n *fakeNode) Ready() error { return nil }
+
+func (n *fakeNode) Run(cmd string) (string, error) {
+	n.cmd = cmd
+	return n.out, nil
+}
+
+func newPolicy(kind kubewarden.Kind, namespace, name string, spec map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	obj.SetGroupVersionKind(kind.GroupVersionKind())
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func newPod(namespace, name string, images ...string) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	for i, image := range images {
+		c := corev1.Container{Name: name + "-" + string(rune('a'+i)), Image: image}
+		if i == 0 {
+			pod.Spec.InitContainers = append(pod.Spec.InitContainers, c)
+			continue
+		}
+		pod.Spec.Containers = append(pod.Spec.Containers, c)
+	}
+	return pod
+}
+
+func TestReadImageList(t *testing.T) {
+	g := NewWithT(t)
+
+	file := filepath.Join(t.TempDir(), "k3s-images.txt")
+	g.Expect(os.WriteFile(file, []byte("docker.io/rancher/mirrored-coredns-coredns:1.12.1\n\n# comment\n docker.io/rancher/klipper-helm:v0.9.5 \n"), 0644)).To(Succeed())
+
+	images, err := ReadImageList(file)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(images).To(Equal([]string{"docker.io/rancher/mirrored-coredns-coredns:1.12.1", "docker.io/rancher/klipper-helm:v0.9.5"}))
+}
+
+func TestParseContainerdImages(t *testing.T) {
+	g := NewWithT(t)
+
+	out := `REF                                                   TYPE                                      DIGEST        SIZE     PLATFORMS   LABELS
+docker.io/rancher/mirrored-pause:3.6                  application/vnd.oci.image.index.v1+json   sha256:74bf   294.7 KiB linux/amd64 io.cattle.k3s.pinned=pinned,io.cri-containerd.image=managed,io.cri-containerd.pinned=pinned
+rancher-manager.test:5000/kubewarden/policy-server:v1.33.0 application/vnd.oci.image.index.v1+json sha256:a1b2 12.3 MiB linux/amd64 io.cri-containerd.image=managed
+sha256:74bf                                           application/vnd.oci.image.index.v1+json   sha256:74bf   294.7 KiB linux/amd64 -
+`
+	g.Expect(ParseContainerdImages(out)).To(Equal([]string{
+		"docker.io/rancher/mirrored-pause:3.6",
+		"rancher-manager.test:5000/kubewarden/policy-server:v1.33.0",
+		"sha256:74bf",
+	}))
+}
+
+func TestVerify(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	objs := []client.Object{
+		newPod("kube-system", "coredns", "rancher/mirrored-coredns-coredns:1.12.1"),
+		newPod("kubewarden", "controller", Mirror+"/kubewarden/kubewarden-controller:v1.33.0", "ghcr.io/kubewarden/kubewarden-controller:v1.33.0"),
+		newPolicy(kubewarden.KindPolicyServer, "", "default", map[string]any{"image": Mirror + "/kubewarden/policy-server:v1.33.0"}),
+		newPolicy(kubewarden.KindPolicyServer, "", "public", map[string]any{"image": "ghcr.io/kubewarden/policy-server:v1.33.0"}),
+		newPolicy(kubewarden.KindClusterAdmissionPolicy, "", "mirrored", map[string]any{"module": "registry://" + Mirror + "/kubewarden/policies/pod-privileged:v1.0.6"}),
+		newPolicy(kubewarden.KindAdmissionPolicy, "default", "public", map[string]any{"module": "registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.6"}),
+		newPolicy(kubewarden.KindClusterAdmissionPolicyGroup, "", "group", map[string]any{"policies": map[string]any{
+			"mirrored": map[string]any{"module": "registry://" + Mirror + "/kubewarden/policies/safe-labels:v1.0.0"},
+			"https":    map[string]any{"module": "https://github.com/kubewarden/policy.wasm"},
+		}}),
+	}
+
+	node := &fakeNode{out: `REF TYPE DIGEST SIZE PLATFORMS LABELS
+docker.io/rancher/mirrored-pause:3.6 application/vnd.oci.image.index.v1+json sha256:74bf 294.7 KiB linux/amd64 io.cattle.k3s.pinned=pinned
+docker.io/rancher/mirrored-coredns-coredns:1.12.1 application/vnd.oci.image.index.v1+json sha256:c3d4 20.1 MiB linux/amd64 io.cri-containerd.image=managed
+ghcr.io/kubewarden/kubewarden-controller:v1.33.0 application/vnd.oci.image.index.v1+json sha256:e5f6 30.2 MiB linux/amd64 io.cri-containerd.image=managed
+` + Mirror + `/kubewarden/policy-server:v1.33.0 application/vnd.oci.image.index.v1+json sha256:a1b2 12.3 MiB linux/amd64 io.cri-containerd.image=managed
+sha256:e5f6 application/vnd.oci.image.index.v1+json sha256:e5f6 30.2 MiB linux/amd64 io.cri-containerd.image=managed
+`}
+
+	v := &Verifier{
+		Allowed:    []string{"docker.io/rancher/mirrored-coredns-coredns:1.12.1"},
+		Kubewarden: kubewarden.NewForClient(fake.NewClientBuilder().WithObjects(objs...).Build()),
+		Node:       node,
+	}
+
+	violations, err := v.Verify(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(node.cmd).To(ContainSubstring("ctr -n k8s.io images ls"))
+	g.Expect(violations).To(ConsistOf(
+		Violation{Source: "pod kubewarden/controller container controller-b", Reference: "ghcr.io/kubewarden/kubewarden-controller:v1.33.0"},
+		Violation{Source: "PolicyServer public", Reference: "ghcr.io/kubewarden/policy-server:v1.33.0"},
+		Violation{Source: "AdmissionPolicy default/public", Reference: "registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.6"},
+		Violation{Source: "ClusterAdmissionPolicyGroup group member https", Reference: "https://github.com/kubewarden/policy.wasm"},
+		Violation{Source: "containerd", Reference: "ghcr.io/kubewarden/kubewarden-controller:v1.33.0"},
+		// Pinned but not in the image list of k3s
+		Violation{Source: "containerd", Reference: "docker.io/rancher/mirrored-pause:3.6"},
+	))
+
+	// Pinned and in the image list of k3s
+	v.Allowed = append(v.Allowed, "rancher/mirrored-pause:3.6")
+	violations, err = v.ContainerdImages(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(violations).To(ConsistOf(Violation{Source: "containerd", Reference: "ghcr.io/kubewarden/kubewarden-controller:v1.33.0"}))
+
+	// Nothing is run on the node once the context is done
+	node.cmd = ""
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = v.ContainerdImages(canceled)
+	g.Expect(err).To(MatchError(context.Canceled))
+	g.Expect(node.cmd).To(BeEmpty())
+}
@@ -0,0 +1,153 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// PolicyServer holds the parameters of assets/policy-server.yaml
+type PolicyServer struct {
+	Name     string
+	Image    string
+	Replicas int
+	// Optional secret used to pull the image
+	ImagePullSecret string
+}
+
+// Backup holds the parameters of assets/backup.yaml
+type Backup struct {
+	Name            string
+	ResourceSetName string
+	RetentionCount  int
+	// Optional cron schedule of a recurring backup, e.g. "@every 1m"
+	Schedule string
+	// Optional EncryptionConfiguration secret, see backup.NewEncryptionConfigSecret
+	EncryptionConfigSecretName string
+}
+
+// ResourceSet holds the parameters of assets/resource-set-kubewarden.yaml
+type ResourceSet struct {
+	Name string
+	// Optional secrets of SecretsNamespace backed up with the Kubewarden resources
+	SecretsNamespace string
+	Secrets          []string
+}
+
+// Restore holds the parameters of assets/restore.yaml
+type Restore struct {
+	Name       string
+	BackupFile string
+	Prune      bool
+	// EncryptionConfiguration secret of the backup, if encrypted
+	EncryptionConfigSecretName string
+}
+
+// NetworkHost is a host with a fixed address in assets/net-default-airgap.xml
+type NetworkHost struct {
+	// Name of the DHCP host, e.g. rancher-manager
+	Name string
+	// DNS name, e.g. rancher-manager.test
+	Hostname string
+	MAC      string
+	IP       string
+}
+
+// Network holds the parameters of assets/net-default-airgap.xml
+type Network struct {
+	Name   string
+	Bridge string
+	// Interface the network is routed to
+	ForwardDev string
+	// Address and netmask of the host on the network
+	Address string
+	Netmask string
+	// Range of the dynamic addresses, the hosts must be outside of it
+	DHCPStart string
+	DHCPEnd   string
+	Hosts     []NetworkHost
+}
+
+/*
+Render a template asset
+  - @param file text/template file
+  - @param params Typed parameters of the asset, all the referenced fields must exist
+  - @returns The rendered manifest or an error
+*/
+func Render(file string, params any) ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(file)).Option("missingkey=error").ParseFiles(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse asset: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, params); err != nil {
+		return nil, fmt.Errorf("cannot render asset %s: %w", file, err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// Renderer writes rendered assets in a dedicated directory, tracked files are never modified
+type Renderer struct {
+	Dir string
+}
+
+/*
+Render a template asset into the directory of the renderer
+  - @param file text/template file
+  - @param params Typed parameters of the asset
+  - @returns The path of the rendered file, unique for each call, or an error
+*/
+func (r *Renderer) RenderFile(file string, params any) (string, error) {
+	data, err := Render(file, params)
+	if err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(file)
+	f, err := os.CreateTemp(r.Dir, strings.TrimSuffix(filepath.Base(file), ext)+"-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+/*
+Apply a manifest without writing it on disk
+  - @param namespace Namespace of the namespaced resources
+  - @param manifest YAML manifest
+  - @returns Nothing or an error with the kubectl output
+*/
+func Apply(namespace string, manifest []byte) error {
+	cmd := exec.Command("kubectl", "--namespace", namespace, "apply", "-f", "-")
+	cmd.Stdin = bytes.NewReader(manifest)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("kubectl apply failed: %w: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets
+
+import (
+	"encoding/xml"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+)
+
+const assetsDir = "../../../assets/"
+
+func TestRenderNetwork(t *testing.T) {
+	g := NewWithT(t)
+
+	data, err := Render(assetsDir+"net-default-airgap.xml", Network{
+		Name: "default", Bridge: "virbr0", ForwardDev: "eth0",
+		Address: "192.168.122.1", Netmask: "255.255.255.0", DHCPStart: "192.168.122.2", DHCPEnd: "192.168.122.191",
+		Hosts: []NetworkHost{
+			{Name: "rancher-manager", Hostname: "rancher-manager.test", MAC: "52:54:00:00:00:10", IP: "192.168.122.102"},
+			{Name: "agent-1", Hostname: "agent-1.test", MAC: "52:54:00:00:00:11", IP: "192.168.122.103"},
+		},
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	network := struct {
+		Name string `xml:"name"`
+		DNS  []struct {
+			IP       string `xml:"ip,attr"`
+			Hostname string `xml:"hostname"`
+		} `xml:"dns>host"`
+		DHCP []struct {
+			MAC string `xml:"mac,attr"`
+			IP  string `xml:"ip,attr"`
+		} `xml:"ip>dhcp>host"`
+	}{}
+	g.Expect(xml.Unmarshal(data, &network)).To(Succeed())
+	g.Expect(network.Name).To(Equal("default"))
+	g.Expect(network.DNS).To(HaveLen(2))
+	g.Expect(network.DNS[1].Hostname).To(Equal("agent-1.test"))
+	g.Expect(network.DHCP[0].MAC).To(Equal("52:54:00:00:00:10"))
+	g.Expect(network.DHCP[1].IP).To(Equal("192.168.122.103"))
+}
+
+func TestRenderShippedAssets(t *testing.T) {
+	g := NewWithT(t)
+
+	for file, params := range map[string]any{
+		"policy-server.yaml":           PolicyServer{Name: "production", Image: "ghcr.io/kubewarden/policy-server:v1.33.0", Replicas: 2},
+		"backup.yaml":                  Backup{Name: "kubewarden-backup", ResourceSetName: "rancher-resource-set-full", RetentionCount: 1},
+		"restore.yaml":                 Restore{Name: "kubewarden-restore", BackupFile: "backup.tar.gz", Prune: true},
+		"resource-set-kubewarden.yaml": ResourceSet{Name: "kubewarden-only"},
+	} {
+		data, err := Render(assetsDir+file, params)
+		g.Expect(err).To(Not(HaveOccurred()), file)
+
+		obj := map[string]any{}
+		g.Expect(yaml.Unmarshal(data, &obj)).To(Succeed(), file)
+		// ResourceSets have no spec
+		g.Expect(obj).To(Or(HaveKey("spec"), HaveKey("resourceSelectors")), file)
+	}
+
+	data, err := Render(assetsDir+"restore.yaml", Restore{Name: "r", BackupFile: "b.tar.gz", Prune: true})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(string(data)).To(ContainSubstring("prune: true"))
+	g.Expect(string(data)).To(ContainSubstring("backupFilename: b.tar.gz"))
+
+	// Encryption is optional
+	data, err = Render(assetsDir+"backup.yaml", Backup{Name: "b", ResourceSetName: "rs", RetentionCount: 1})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(string(data)).To(Not(ContainSubstring("encryptionConfigSecretName")))
+
+	data, err = Render(assetsDir+"backup.yaml", Backup{Name: "b", ResourceSetName: "rs", RetentionCount: 1, EncryptionConfigSecretName: "encryptionconfig"})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(string(data)).To(HaveSuffix("  retentionCount: 1\n  encryptionConfigSecretName: encryptionconfig\n"))
+
+	// Recurring backups are optional too
+	data, err = Render(assetsDir+"backup.yaml", Backup{Name: "b", ResourceSetName: "rs", RetentionCount: 2, Schedule: "@every 1m"})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(string(data)).To(HaveSuffix("  retentionCount: 2\n  schedule: \"@every 1m\"\n"))
+
+	// Secrets are selected by name
+	data, err = Render(assetsDir+"resource-set-kubewarden.yaml", ResourceSet{Name: "rs", SecretsNamespace: "kubewarden", Secrets: []string{"pull", "sources"}})
+	g.Expect(err).To(Not(HaveOccurred()))
+	resourceSet := map[string]any{}
+	g.Expect(yaml.Unmarshal(data, &resourceSet)).To(Succeed())
+	g.Expect(resourceSet["resourceSelectors"]).To(ContainElement(And(
+		HaveKeyWithValue("kinds", ConsistOf("secrets")),
+		HaveKeyWithValue("namespaces", ConsistOf("kubewarden")),
+		HaveKeyWithValue("resourceNames", ConsistOf("pull", "sources")),
+	)))
+
+	// The pull secret is optional
+	data, err = Render(assetsDir+"policy-server.yaml", PolicyServer{Name: "p", Image: "ps", Replicas: 1})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(string(data)).To(Not(ContainSubstring("imagePullSecret")))
+
+	data, err = Render(assetsDir+"policy-server.yaml", PolicyServer{Name: "p", Image: "ps", Replicas: 1, ImagePullSecret: "application-collection"})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(string(data)).To(HaveSuffix("  replicas: 1\n  imagePullSecret: application-collection\n"))
+}
+
+func TestRenderMissingParameter(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := Render(assetsDir+"restore.yaml", PolicyServer{Name: "production"})
+	g.Expect(err).To(MatchError(ContainSubstring("BackupFile")))
+}
+
+func TestRenderFile(t *testing.T) {
+	g := NewWithT(t)
+
+	before, err := os.ReadFile(assetsDir + "policy-server.yaml")
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	r := &Renderer{Dir: t.TempDir()}
+	first, err := r.RenderFile(assetsDir+"policy-server.yaml", PolicyServer{Name: "first", Image: "ps", Replicas: 1})
+	g.Expect(err).To(Not(HaveOccurred()))
+	second, err := r.RenderFile(assetsDir+"policy-server.yaml", PolicyServer{Name: "second", Image: "ps", Replicas: 1})
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	// Several objects can be rendered from the same template
+	g.Expect(first).To(Not(Equal(second)))
+	g.Expect(first).To(HaveSuffix(".yaml"))
+	g.Expect(os.ReadFile(second)).To(ContainSubstring("name: second"))
+
+	// The tracked asset is left untouched
+	g.Expect(os.ReadFile(assetsDir + "policy-server.yaml")).To(Equal(before))
+}
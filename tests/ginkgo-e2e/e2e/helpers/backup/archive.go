@@ -0,0 +1,175 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Directory of the archive holding the resource selectors, not resources
+const filtersDir = "filters"
+
+// Entry is a resource stored in a backup archive
+type Entry struct {
+	// Plural name of the resource, e.g. clusteradmissionpolicies
+	Resource  string
+	Group     string
+	Version   string
+	Namespace string
+	Name      string
+	// Raw content of the file, encrypted for encrypted backups
+	Data []byte
+}
+
+func (e Entry) String() string {
+	gr := e.Resource
+	if e.Group != "" {
+		gr += "." + e.Group
+	}
+	if e.Namespace != "" {
+		return fmt.Sprintf("%s %s/%s", gr, e.Namespace, e.Name)
+	}
+	return fmt.Sprintf("%s %s", gr, e.Name)
+}
+
+// Encrypted returns true if the resource has been encrypted by the EncryptionConfiguration of the backup
+func (e Entry) Encrypted() bool {
+	return bytes.HasPrefix(e.Data, []byte(encryptedPrefix))
+}
+
+// Archive is the content of a rancher-backup tarball
+type Archive struct {
+	Entries []Entry
+}
+
+/*
+Parse the path of a resource in a backup archive
+  - @param name Path in the archive: <resource>.<group>#<version>/[<namespace>/]<name>.json
+  - @returns The entry without data, false if the path is not a resource
+*/
+func parseEntry(name string) (Entry, bool) {
+	parts := strings.Split(strings.TrimPrefix(path.Clean(name), "./"), "/")
+	if parts[0] == filtersDir || len(parts) < 2 || len(parts) > 3 || !strings.HasSuffix(name, ".json") {
+		return Entry{}, false
+	}
+
+	gr, version, found := strings.Cut(parts[0], "#")
+	if !found {
+		return Entry{}, false
+	}
+
+	e := Entry{Version: version, Name: strings.TrimSuffix(parts[len(parts)-1], ".json")}
+	e.Resource, e.Group, _ = strings.Cut(gr, ".")
+	if len(parts) == 3 {
+		e.Namespace = parts[1]
+	}
+	return e, true
+}
+
+/*
+Read a backup archive
+  - @param file Backup tarball (.tar.gz)
+  - @returns The resources of the backup or an error
+*/
+func ReadArchive(file string) (*Archive, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read backup %s: %w", file, err)
+	}
+	defer gz.Close()
+
+	a := &Archive{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read backup %s: %w", file, err)
+		}
+
+		e, ok := parseEntry(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || !ok {
+			continue
+		}
+		if e.Data, err = io.ReadAll(tr); err != nil {
+			return nil, err
+		}
+		a.Entries = append(a.Entries, e)
+	}
+
+	return a, nil
+}
+
+// Groups returns the API groups of the resources in the archive, sorted
+func (a *Archive) Groups() []string {
+	seen := map[string]bool{}
+	for _, e := range a.Entries {
+		seen[e.Group] = true
+	}
+
+	groups := make([]string, 0, len(seen))
+	for g := range seen {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// Names returns the entries as "<resource>.<group> [<namespace>/]<name>", sorted
+func (a *Archive) Names() []string {
+	names := make([]string, 0, len(a.Entries))
+	for _, e := range a.Entries {
+		names = append(names, e.String())
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+Find a resource in the archive
+  - @param resource Plural name of the resource, with its group if any, e.g. policyservers.policies.kubewarden.io
+  - @param namespace Namespace of the resource, empty for cluster-wide ones
+  - @param name Name of the resource
+  - @returns The entry, false if not found
+*/
+func (a *Archive) Find(resource, namespace, name string) (Entry, bool) {
+	for _, e := range a.Entries {
+		gr := e.Resource
+		if e.Group != "" {
+			gr += "." + e.Group
+		}
+		if gr == resource && e.Namespace == namespace && e.Name == name {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
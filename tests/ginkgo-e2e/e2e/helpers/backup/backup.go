@@ -0,0 +1,242 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/common"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// Group and version of the rancher-backup CRDs
+const (
+	Group   = "resources.cattle.io"
+	Version = "v1"
+)
+
+// Kinds of the rancher-backup CRDs
+const (
+	KindBackup      = "Backup"
+	KindRestore     = "Restore"
+	KindResourceSet = "ResourceSet"
+)
+
+// GroupVersionKind returns the GVK of a rancher-backup kind
+func GroupVersionKind(kind string) schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: Group, Version: Version, Kind: kind}
+}
+
+// Client gives access to the rancher-backup resources
+type Client struct {
+	client.Client
+
+	// Timeout and interval used by the Wait* functions
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+/*
+Create a rancher-backup client for the current kubeconfig (KUBECONFIG, then ~/.kube/config)
+  - @returns The client or an error
+*/
+func New() (*Client, error) {
+	restConfig, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(restConfig, client.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewForClient(c), nil
+}
+
+/*
+Create a rancher-backup client on top of an existing controller-runtime client
+  - @param c controller-runtime client, can be a fake one
+  - @returns The client with default timeouts
+*/
+func NewForClient(c client.Client) *Client {
+	return &Client{
+		Client:   c,
+		Timeout:  5 * time.Minute,
+		Interval: 10 * time.Second,
+	}
+}
+
+// get returns a cluster-wide rancher-backup resource
+func (c *Client) get(ctx context.Context, kind, name string) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(GroupVersionKind(kind))
+
+	if err := c.Client.Get(ctx, client.ObjectKey{Name: name}, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+/*
+Delete a cluster-wide rancher-backup resource
+  - @param kind Kind of the resource: Backup, Restore or ResourceSet
+  - @param name Name of the resource
+  - @returns Nothing or an error, a missing resource or operator is not an error
+*/
+func (c *Client) DeleteResource(ctx context.Context, kind, name string) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(GroupVersionKind(kind))
+	obj.SetName(name)
+
+	// The operator is not installed again yet after a cluster reset
+	if err := c.Client.Delete(ctx, obj); !meta.IsNoMatchError(err) {
+		return client.IgnoreNotFound(err)
+	}
+	return nil
+}
+
+// ready checks the Ready condition of a Backup or a Restore
+func ready(obj *unstructured.Unstructured) (bool, error) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]any)
+		if !ok || cond["type"] != "Ready" {
+			continue
+		}
+
+		message, _ := cond["message"].(string)
+		if cond["status"] == "True" {
+			return true, nil
+		}
+		// The operator reports the errors in the message of the condition
+		return false, fmt.Errorf("%s %s not ready: %s", obj.GetKind(), obj.GetName(), message)
+	}
+
+	return false, fmt.Errorf("%s %s has no Ready condition yet", obj.GetKind(), obj.GetName())
+}
+
+// poll calls check until it returns true, the last error is kept to explain a timeout
+func (c *Client) poll(ctx context.Context, what string, check func(context.Context) (bool, error)) error {
+	return common.Poll(ctx, c.Interval, c.Timeout, what, check)
+}
+
+/*
+Wait for a backup to be done
+  - @param name Name of the Backup resource
+  - @returns The name of the backup file or an error with the last status on timeout
+*/
+func (c *Client) WaitBackup(ctx context.Context, name string) (string, error) {
+	var filename string
+
+	err := c.poll(ctx, "Backup "+name, func(ctx context.Context) (bool, error) {
+		obj, err := c.get(ctx, KindBackup, name)
+		if err != nil {
+			return false, err
+		}
+
+		if done, err := ready(obj); !done {
+			return false, err
+		}
+
+		filename, _, _ = unstructured.NestedString(obj.Object, "status", "filename")
+		if filename == "" {
+			return false, fmt.Errorf("backup %s has no file yet", name)
+		}
+		return true, nil
+	})
+
+	return filename, err
+}
+
+/*
+Wait for a run of a recurring backup, taken after a given time
+  - @param name Name of the Backup resource, with a schedule
+  - @param after Runs started before this time are ignored, e.g. the end of a change to back up
+  - @returns The name of the backup file of the run or an error with the last status on timeout
+*/
+func (c *Client) WaitScheduledBackup(ctx context.Context, name string, after time.Time) (string, error) {
+	var filename string
+
+	err := c.poll(ctx, "a run of Backup "+name+" after "+after.UTC().Format(time.RFC3339), func(ctx context.Context) (bool, error) {
+		obj, err := c.get(ctx, KindBackup, name)
+		if err != nil {
+			return false, err
+		}
+
+		if done, err := ready(obj); !done {
+			return false, err
+		}
+
+		// The timestamp has a second resolution, the run started at or after it
+		last, _, _ := unstructured.NestedString(obj.Object, "status", "lastSnapshotTs")
+		ts, err := time.Parse(time.RFC3339, last)
+		if err != nil {
+			return false, fmt.Errorf("backup %s has no valid last snapshot time %q", name, last)
+		}
+		if !ts.After(after) {
+			return false, fmt.Errorf("last run of backup %s at %s", name, last)
+		}
+
+		filename, _, _ = unstructured.NestedString(obj.Object, "status", "filename")
+		if filename == "" {
+			return false, fmt.Errorf("backup %s has no file yet", name)
+		}
+		return true, nil
+	})
+
+	return filename, err
+}
+
+/*
+Select the files of a Backup resource, named "<backup>-<cluster id>-<timestamp>.tar.gz"
+  - @param files Backup files, e.g. returned by Storage.List
+  - @param name Name of the Backup resource
+  - @returns The files of the backup, oldest first
+*/
+func Files(files []string, name string) []string {
+	selected := []string{}
+	for _, f := range files {
+		if strings.HasPrefix(f, name+"-") {
+			selected = append(selected, f)
+		}
+	}
+	// The cluster id is the same for all the runs, the timestamp gives the order
+	sort.Strings(selected)
+	return selected
+}
+
+/*
+Wait for a restore to be done
+  - @param name Name of the Restore resource
+  - @returns An error with the last status on timeout
+*/
+func (c *Client) WaitRestore(ctx context.Context, name string) error {
+	return c.poll(ctx, "Restore "+name, func(ctx context.Context) (bool, error) {
+		obj, err := c.get(ctx, KindRestore, name)
+		if err != nil {
+			return false, err
+		}
+		return ready(obj)
+	})
+}
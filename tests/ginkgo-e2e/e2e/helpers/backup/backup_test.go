@@ -0,0 +1,219 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+// writeArchive writes a backup tarball with the given files
+func writeArchive(t *testing.T, files map[string]string) string {
+	file := filepath.Join(t.TempDir(), "backup.tar.gz")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestReadArchive(t *testing.T) {
+	g := NewWithT(t)
+
+	file := writeArchive(t, map[string]string{
+		"filters/filters.json": `{"resourceSelectors": []}`,
+		"clusteradmissionpolicies.policies.kubewarden.io#v1/no-privileged-pod.json":  `{"kind": "ClusterAdmissionPolicy"}`,
+		"admissionpolicies.policies.kubewarden.io#v1/kubewarden/pod-privileged.json": `{"kind": "AdmissionPolicy"}`,
+		"./configmaps#v1/kubewarden/settings.json":                                   `{"kind": "ConfigMap"}`,
+	})
+
+	a, err := ReadArchive(file)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(a.Names()).To(Equal([]string{
+		"admissionpolicies.policies.kubewarden.io kubewarden/pod-privileged",
+		"clusteradmissionpolicies.policies.kubewarden.io no-privileged-pod",
+		"configmaps kubewarden/settings",
+	}))
+	g.Expect(a.Groups()).To(Equal([]string{"", "policies.kubewarden.io"}))
+
+	g.Expect(a.Entries).To(ContainElement(And(
+		HaveField("Resource", "admissionpolicies"),
+		HaveField("Version", "v1"),
+		HaveField("Namespace", "kubewarden"),
+		HaveField("Data", BeEquivalentTo(`{"kind": "AdmissionPolicy"}`)),
+	)))
+}
+
+func TestEncryptedEntries(t *testing.T) {
+	g := NewWithT(t)
+
+	// Paths stay readable, only the content is encrypted
+	file := writeArchive(t, map[string]string{
+		"secrets.#v1/kubewarden/secret-registry-docker.json":            "k8s:enc:aescbc:v1:key1:\x8f\x01",
+		"policyservers.policies.kubewarden.io#v1/private-registry.json": `{"kind": "PolicyServer"}`,
+	})
+
+	a, err := ReadArchive(file)
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	secret, found := a.Find("secrets", "kubewarden", "secret-registry-docker")
+	g.Expect(found).To(BeTrue())
+	g.Expect(secret.Encrypted()).To(BeTrue())
+
+	policyServer, found := a.Find("policyservers.policies.kubewarden.io", "", "private-registry")
+	g.Expect(found).To(BeTrue())
+	g.Expect(policyServer.Encrypted()).To(BeFalse())
+
+	_, found = a.Find("secrets", "default", "secret-registry-docker")
+	g.Expect(found).To(BeFalse())
+}
+
+func TestEncryptionConfigSecret(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := NewEncryptionConfigSecret("encryptionconfig", []byte("too short"), "secrets")
+	g.Expect(err).To(MatchError(ContainSubstring("invalid AES key length")))
+
+	secret, err := NewEncryptionConfigSecret("encryptionconfig", []byte("0123456789abcdef0123456789abcdef"), "secrets")
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(secret.Namespace).To(Equal(OperatorNamespace))
+	g.Expect(secret.Data).To(HaveKey(EncryptionConfigKey))
+
+	config := map[string]any{}
+	g.Expect(yaml.Unmarshal(secret.Data[EncryptionConfigKey], &config)).To(Succeed())
+	g.Expect(config).To(HaveKeyWithValue("kind", "EncryptionConfiguration"))
+	g.Expect(config["resources"]).To(ConsistOf(And(
+		HaveKeyWithValue("resources", ConsistOf("secrets")),
+		HaveKeyWithValue("providers", ContainElement(HaveKeyWithValue("aescbc", HaveKeyWithValue("keys", ConsistOf(
+			HaveKeyWithValue("secret", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="),
+		))))),
+	)))
+}
+
+func TestReadArchiveNotGzip(t *testing.T) {
+	g := NewWithT(t)
+
+	file := filepath.Join(t.TempDir(), "backup.tar.gz")
+	g.Expect(os.WriteFile(file, []byte("not a tarball"), 0600)).To(Succeed())
+
+	_, err := ReadArchive(file)
+	g.Expect(err).To(MatchError(ContainSubstring("cannot read backup")))
+}
+
+func newResource(kind, name string, status map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{"status": status}}
+	obj.SetGroupVersionKind(GroupVersionKind(kind))
+	obj.SetName(name)
+	return obj
+}
+
+func TestWaitBackupAndRestore(t *testing.T) {
+	g := NewWithT(t)
+
+	readyCondition := func(status, message string) map[string]any {
+		return map[string]any{"type": "Ready", "status": status, "message": message}
+	}
+
+	c := NewForClient(fake.NewClientBuilder().WithObjects(
+		newResource(KindBackup, "done", map[string]any{
+			"filename":   "done-a1b2-2025-06-01T10-00-00Z.tar.gz",
+			"conditions": []any{readyCondition("True", "Completed")},
+		}),
+		newResource(KindBackup, "failed", map[string]any{
+			"conditions": []any{readyCondition("False", "error syncing backup: no such resource set")},
+		}),
+		newResource(KindRestore, "running", map[string]any{}),
+	).Build())
+	c.Timeout = 200 * time.Millisecond
+	c.Interval = 10 * time.Millisecond
+
+	filename, err := c.WaitBackup(context.Background(), "done")
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(filename).To(Equal("done-a1b2-2025-06-01T10-00-00Z.tar.gz"))
+
+	_, err = c.WaitBackup(context.Background(), "failed")
+	g.Expect(err).To(MatchError(ContainSubstring("no such resource set")))
+
+	g.Expect(c.WaitRestore(context.Background(), "running")).To(MatchError(ContainSubstring("no Ready condition yet")))
+
+	// Deleting twice is not an error
+	g.Expect(c.DeleteResource(context.Background(), KindBackup, "done")).To(Succeed())
+	g.Expect(c.DeleteResource(context.Background(), KindBackup, "done")).To(Succeed())
+	_, err = c.WaitBackup(context.Background(), "done")
+	g.Expect(err).To(MatchError(ContainSubstring("not found")))
+}
+
+func TestWaitScheduledBackup(t *testing.T) {
+	g := NewWithT(t)
+
+	c := NewForClient(fake.NewClientBuilder().WithObjects(
+		newResource(KindBackup, "recurring", map[string]any{
+			"filename":       "recurring-a1b2-2025-06-01T10-01-00Z.tar.gz",
+			"lastSnapshotTs": "2025-06-01T10:01:00Z",
+			"conditions":     []any{map[string]any{"type": "Ready", "status": "True", "message": "Completed"}},
+		}),
+	).Build())
+	c.Timeout = 200 * time.Millisecond
+	c.Interval = 10 * time.Millisecond
+
+	filename, err := c.WaitScheduledBackup(context.Background(), "recurring", time.Date(2025, 6, 1, 10, 0, 30, 0, time.UTC))
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(filename).To(Equal("recurring-a1b2-2025-06-01T10-01-00Z.tar.gz"))
+
+	// The run started before the change
+	_, err = c.WaitScheduledBackup(context.Background(), "recurring", time.Date(2025, 6, 1, 10, 1, 0, 0, time.UTC))
+	g.Expect(err).To(MatchError(ContainSubstring("last run of backup recurring at 2025-06-01T10:01:00Z")))
+}
+
+func TestFiles(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(Files([]string{
+		"recurring-a1b2-2025-06-01T10-02-00Z.tar.gz",
+		"kubewarden-backup-a1b2-2025-06-01T09-00-00Z.tar.gz",
+		"recurring-a1b2-2025-06-01T10-01-00Z.tar.gz",
+	}, "recurring")).To(Equal([]string{
+		"recurring-a1b2-2025-06-01T10-01-00Z.tar.gz",
+		"recurring-a1b2-2025-06-01T10-02-00Z.tar.gz",
+	}))
+}
@@ -0,0 +1,76 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Namespace of the rancher-backup operator, where the encryption secrets must be
+const OperatorNamespace = "cattle-resources-system"
+
+// Key of the EncryptionConfiguration in the secret, as expected by rancher-backup
+const EncryptionConfigKey = "encryption-provider-config.yaml"
+
+// Prefix of the values written by the Kubernetes encryption providers
+const encryptedPrefix = "k8s:enc:"
+
+/*
+Build the secret referenced by encryptionConfigSecretName
+  - @param name Name of the secret
+  - @param key AES key of 16, 24 or 32 bytes
+  - @param resources Resources to encrypt, e.g. secrets
+  - @returns The secret holding an aescbc EncryptionConfiguration, or an error
+*/
+func NewEncryptionConfigSecret(name string, key []byte, resources ...string) (*corev1.Secret, error) {
+	if l := len(key); l != 16 && l != 24 && l != 32 {
+		return nil, fmt.Errorf("invalid AES key length %d", l)
+	}
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("no resource to encrypt in %s", name)
+	}
+
+	config := map[string]any{
+		"apiVersion": "apiserver.config.k8s.io/v1",
+		"kind":       "EncryptionConfiguration",
+		"resources": []any{
+			map[string]any{
+				"resources": resources,
+				"providers": []any{
+					map[string]any{"aescbc": map[string]any{
+						"keys": []any{map[string]any{"name": "key1", "secret": base64.StdEncoding.EncodeToString(key)}},
+					}},
+					// Restores can still read the resources not encrypted yet
+					map[string]any{"identity": map[string]any{}},
+				},
+			},
+		},
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: OperatorNamespace, Name: name},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{EncryptionConfigKey: data},
+	}, nil
+}
@@ -0,0 +1,285 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/certs"
+	"github.com/rancher/elemental/tests/e2e/helpers/common"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MinIO stand-in of the S3 storage, test credentials only
+const (
+	minioImage     = "quay.io/minio/minio:RELEASE.2025-04-22T22-12-26Z"
+	minioNamespace = "minio"
+	minioName      = "minio"
+	minioTLSSecret = "minio-tls"
+	minioNodePort  = 30900
+
+	S3Bucket           = "kubewarden-backups"
+	S3Region           = "us-east-1"
+	S3CredentialSecret = "minio-credentials"
+	s3AccessKey        = "kubewarden-e2e"
+	s3SecretKey        = "kubewarden-e2e-secret"
+)
+
+// S3 is a MinIO deployed in the cluster, rancher-backup writes the backups in a bucket
+//
+// The data is lost with the cluster: after a reset, Put uploads again the backup fetched before it.
+type S3 struct {
+	cl   client.Client
+	opts StorageOptions
+	// PEM encoded CA of the MinIO certificate, set by Prepare or read from the cluster
+	caPEM []byte
+}
+
+func (s *S3) Name() string { return StorageS3 }
+
+// endpointHost returns the in-cluster name of MinIO
+func (s *S3) endpointHost() string {
+	return fmt.Sprintf("%s.%s.svc.cluster.local", minioName, minioNamespace)
+}
+
+// ChartValues must be called after Prepare, which sets the CA
+func (s *S3) ChartValues() []string {
+	return []string{
+		"persistence.enabled=false",
+		"s3.enabled=true",
+		"s3.bucketName=" + S3Bucket,
+		"s3.region=" + S3Region,
+		"s3.endpoint=" + s.endpointHost() + ":9000",
+		"s3.endpointCA=" + base64.StdEncoding.EncodeToString(s.caPEM),
+		"s3.credentialSecretName=" + S3CredentialSecret,
+		"s3.credentialSecretNamespace=" + OperatorNamespace,
+	}
+}
+
+// create creates an object, it is not an error if it already exists
+func (s *S3) create(ctx context.Context, obj client.Object) error {
+	if err := s.cl.Create(ctx, obj); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("cannot create %s %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+	}
+	return nil
+}
+
+// tlsSecret returns the certificate of MinIO, issued the first time for the in-cluster names and the node address
+func (s *S3) tlsSecret(ctx context.Context) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := s.cl.Get(ctx, client.ObjectKey{Namespace: minioNamespace, Name: minioTLSSecret}, secret)
+	if err == nil || !apierrors.IsNotFound(err) {
+		return secret, err
+	}
+
+	nodeIP, err := common.ControlPlaneIP(ctx, s.cl)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := certs.NewCA("kubewarden-e2e-minio")
+	if err != nil {
+		return nil, err
+	}
+	kp, err := ca.Issue(s.endpointHost(), minioName+"."+minioNamespace+".svc", nodeIP)
+	if err != nil {
+		return nil, err
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: minioNamespace, Name: minioTLSSecret},
+		Data: map[string][]byte{
+			"public.crt":  kp.CertPEM,
+			"private.key": kp.KeyPEM,
+			"ca.crt":      ca.CertPEM,
+		},
+	}
+	return secret, s.create(ctx, secret)
+}
+
+func (s *S3) Prepare(ctx context.Context) error {
+	for _, ns := range []string{minioNamespace, OperatorNamespace} {
+		if err := s.create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}); err != nil {
+			return err
+		}
+	}
+
+	secret, err := s.tlsSecret(ctx)
+	if err != nil {
+		return err
+	}
+	s.caPEM = secret.Data["ca.crt"]
+
+	objects := []client.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: minioNamespace, Name: minioName},
+			StringData: map[string]string{"MINIO_ROOT_USER": s3AccessKey, "MINIO_ROOT_PASSWORD": s3SecretKey},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: OperatorNamespace, Name: S3CredentialSecret},
+			StringData: map[string]string{"accessKey": s3AccessKey, "secretKey": s3SecretKey},
+		},
+		s.deployment(),
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: minioNamespace, Name: minioName},
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeNodePort,
+				Selector: map[string]string{"app": minioName},
+				Ports:    []corev1.ServicePort{{Name: "s3", Port: 9000, TargetPort: intstr.FromInt32(9000), NodePort: minioNodePort}},
+			},
+		},
+	}
+	for _, obj := range objects {
+		if err := s.create(ctx, obj); err != nil {
+			return err
+		}
+	}
+
+	// MinIO must serve the bucket before rancher-backup starts
+	var last error
+	err = wait.PollUntilContextTimeout(ctx, s.opts.Interval, s.opts.Timeout, true, func(ctx context.Context) (bool, error) {
+		var c *S3Client
+		c, last = s.client(ctx)
+		if last == nil {
+			last = c.MakeBucket(ctx, S3Bucket)
+		}
+		return last == nil, nil
+	})
+	if err != nil && last != nil {
+		return fmt.Errorf("MinIO not ready: %w", last)
+	}
+	return err
+}
+
+func (s *S3) deployment() *appsv1.Deployment {
+	labels := map[string]string{"app": minioName}
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: minioNamespace, Name: minioName},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:    minioName,
+						Image:   s.opts.MinIOImage,
+						Args:    []string{"server", "/data", "--address", ":9000", "--certs-dir", "/certs"},
+						EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: minioName}}}},
+						Ports:   []corev1.ContainerPort{{ContainerPort: 9000}},
+						ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+							Path: "/minio/health/ready", Port: intstr.FromInt32(9000), Scheme: corev1.URISchemeHTTPS,
+						}}},
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "data", MountPath: "/data"},
+							{Name: "certs", MountPath: "/certs", ReadOnly: true},
+						},
+					}},
+					Volumes: []corev1.Volume{
+						{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+						{Name: "certs", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+							SecretName: minioTLSSecret,
+							Items: []corev1.KeyToPath{
+								{Key: "public.crt", Path: "public.crt"},
+								{Key: "private.key", Path: "private.key"},
+							},
+						}}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// client returns an S3 client trusting the CA of MinIO, through the NodePort unless S3Endpoint is set
+func (s *S3) client(ctx context.Context) (*S3Client, error) {
+	endpoint := s.opts.S3Endpoint
+	if endpoint == "" {
+		nodeIP, err := common.ControlPlaneIP(ctx, s.cl)
+		if err != nil {
+			return nil, err
+		}
+		endpoint = fmt.Sprintf("https://%s:%d", nodeIP, minioNodePort)
+	}
+
+	if s.caPEM == nil {
+		secret := &corev1.Secret{}
+		if err := s.cl.Get(ctx, client.ObjectKey{Namespace: minioNamespace, Name: minioTLSSecret}, secret); err != nil {
+			return nil, fmt.Errorf("cannot get the MinIO CA: %w", err)
+		}
+		s.caPEM = secret.Data["ca.crt"]
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(s.caPEM) {
+		return nil, errors.New("invalid MinIO CA")
+	}
+
+	return &S3Client{
+		Endpoint:   endpoint,
+		Region:     S3Region,
+		AccessKey:  s3AccessKey,
+		SecretKey:  s3SecretKey,
+		HTTPClient: &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}},
+	}, nil
+}
+
+func (s *S3) Fetch(ctx context.Context, filename, dir string) (string, error) {
+	c, err := s.client(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := c.GetObject(ctx, S3Bucket, filename)
+	if err != nil {
+		return "", fmt.Errorf("cannot get backup %s: %w", filename, err)
+	}
+
+	dest := filepath.Join(dir, filename)
+	return dest, os.WriteFile(dest, data, 0600)
+}
+
+func (s *S3) Put(ctx context.Context, file string) error {
+	c, err := s.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return c.PutObject(ctx, S3Bucket, filepath.Base(file), data)
+}
+
+func (s *S3) List(ctx context.Context) ([]string, error) {
+	c, err := s.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.ListObjects(ctx, S3Bucket)
+}
@@ -0,0 +1,277 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Client is a minimal S3 client with path-style requests, enough to move backups around
+type S3Client struct {
+	// Base URL, e.g. https://192.168.122.102:30900
+	Endpoint   string
+	Region     string
+	AccessKey  string
+	SecretKey  string
+	HTTPClient *http.Client
+
+	// Clock used to sign the requests
+	now func() time.Time
+}
+
+// S3Error is an error response of the object store
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("S3 error %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+/*
+Send a signed request
+  - @param method HTTP method
+  - @param path Bucket or bucket/key, not escaped
+  - @param query Query parameters, can be nil
+  - @param body Request body, can be nil
+  - @returns The response body or an error, S3Error for error responses
+*/
+func (c *S3Client) do(ctx context.Context, method, path string, query url.Values, body []byte) ([]byte, error) {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + path
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	sum := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	req.Header.Set("X-Amz-Date", now().UTC().Format(amzDateFormat))
+	signV4(req, hex.EncodeToString(sum[:]), c.AccessKey, c.SecretKey, c.Region, "s3", now())
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		e := &S3Error{StatusCode: resp.StatusCode}
+		// HEAD responses have no body
+		_ = xml.Unmarshal(data, e)
+		return nil, e
+	}
+	return data, nil
+}
+
+// IsS3Code returns true if err is an S3 error with one of the codes or HTTP status codes
+func IsS3Code(err error, codes ...any) bool {
+	var e *S3Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	for _, c := range codes {
+		if c == e.Code || c == e.StatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// MakeBucket creates a bucket, it is not an error if it already exists
+func (c *S3Client) MakeBucket(ctx context.Context, bucket string) error {
+	_, err := c.do(ctx, http.MethodPut, bucket, nil, nil)
+	if IsS3Code(err, "BucketAlreadyOwnedByYou", "BucketAlreadyExists") {
+		return nil
+	}
+	return err
+}
+
+// PutObject writes an object
+func (c *S3Client) PutObject(ctx context.Context, bucket, key string, data []byte) error {
+	_, err := c.do(ctx, http.MethodPut, bucket+"/"+key, nil, data)
+	return err
+}
+
+// GetObject reads an object
+func (c *S3Client) GetObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, bucket+"/"+key, nil, nil)
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// ListObjects returns the keys of a bucket, sorted
+func (c *S3Client) ListObjects(ctx context.Context, bucket string) ([]string, error) {
+	keys := []string{}
+	query := url.Values{"list-type": {"2"}}
+
+	for {
+		data, err := c.do(ctx, http.MethodGet, bucket, query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		result := &listBucketResult{}
+		if err := xml.Unmarshal(data, result); err != nil {
+			return nil, fmt.Errorf("cannot parse objects of bucket %s: %w", bucket, err)
+		}
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+const amzDateFormat = "20060102T150405Z"
+
+/*
+Sign a request with AWS Signature Version 4
+  - @param req Request, the host and all its headers are signed
+  - @param payloadHash Hex encoded SHA256 of the body
+  - @param t Time of the signature, must match the X-Amz-Date header
+  - @returns Nothing, the Authorization header is set
+*/
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region, service string, t time.Time) {
+	t = t.UTC()
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{t.Format("20060102"), region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", t.Format(amzDateFormat), scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{t.Format("20060102"), region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes the query sorted by key, as required by the signature
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes everything but the unreserved characters, and the slashes if encodeSlash is false
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
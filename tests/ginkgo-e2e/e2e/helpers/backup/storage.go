@@ -0,0 +1,188 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/common"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Names of the storages, as set in BACKUP_STORAGE
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// Storage is where rancher-backup writes the backup files
+type Storage interface {
+	// Name of the storage
+	Name() string
+	// Prepare deploys what the storage needs, before rancher-backup is installed
+	Prepare(ctx context.Context) error
+	// ChartValues returns the rancher-backup chart values selecting the storage
+	ChartValues() []string
+	// Fetch copies a backup file in a local directory and returns its path
+	Fetch(ctx context.Context, filename, dir string) (string, error)
+	// Put makes a local backup file available to the restores
+	Put(ctx context.Context, file string) error
+	// List returns the backup files, sorted
+	List(ctx context.Context) ([]string, error)
+}
+
+// StorageOptions configures the storages, unused fields are ignored
+type StorageOptions struct {
+	// MinIO image of the S3 storage
+	MinIOImage string
+	// S3 endpoint reachable from the host, the MinIO NodePort of the control-plane node if empty
+	S3Endpoint string
+	// Timeout of the deployments
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+/*
+Create a backup storage
+  - @param name Name of the storage: local (default) or s3
+  - @param cl Client of the cluster running rancher-backup
+  - @param opts Options of the storage
+  - @returns The storage or an error
+*/
+func NewStorage(name string, cl client.Client, opts StorageOptions) (Storage, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Minute
+	}
+	if opts.Interval == 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.MinIOImage == "" {
+		opts.MinIOImage = minioImage
+	}
+
+	switch name {
+	case "", StorageLocal:
+		return &Local{cl: cl, exec: common.Run}, nil
+	case StorageS3:
+		return &S3{cl: cl, opts: opts}, nil
+	}
+
+	return nil, fmt.Errorf("unknown backup storage %q", name)
+}
+
+// Local is the persistent volume of rancher-backup, on the host running the tests
+type Local struct {
+	cl   client.Client
+	exec common.Executor
+}
+
+// Volume of the rancher-backup pod holding the backups
+const storageVolume = "pv-storage"
+
+func (s *Local) Name() string { return StorageLocal }
+
+func (s *Local) Prepare(context.Context) error { return nil }
+
+func (s *Local) ChartValues() []string {
+	return []string{
+		"persistence.enabled=true",
+		"persistence.storageClass=local-path",
+	}
+}
+
+// Dir returns the host directory of the persistent volume
+func (s *Local) Dir(ctx context.Context) (string, error) {
+	pods := &corev1.PodList{}
+	if err := s.cl.List(ctx, pods, client.InNamespace(OperatorNamespace), client.MatchingLabels{"app.kubernetes.io/name": "rancher-backup"}); err != nil {
+		return "", err
+	}
+
+	claim := ""
+	for _, p := range pods.Items {
+		for _, v := range p.Spec.Volumes {
+			if v.Name == storageVolume && v.PersistentVolumeClaim != nil {
+				claim = v.PersistentVolumeClaim.ClaimName
+			}
+		}
+	}
+	if claim == "" {
+		return "", fmt.Errorf("no rancher-backup pod with a %s volume", storageVolume)
+	}
+
+	pvs := &corev1.PersistentVolumeList{}
+	if err := s.cl.List(ctx, pvs); err != nil {
+		return "", err
+	}
+	for _, pv := range pvs.Items {
+		if pv.Spec.ClaimRef == nil || pv.Spec.ClaimRef.Name != claim {
+			continue
+		}
+		switch {
+		case pv.Spec.Local != nil:
+			return pv.Spec.Local.Path, nil
+		case pv.Spec.HostPath != nil:
+			return pv.Spec.HostPath.Path, nil
+		}
+		return "", fmt.Errorf("volume %s of claim %s is not on the host", pv.Name, claim)
+	}
+
+	return "", fmt.Errorf("no volume bound to claim %s", claim)
+}
+
+func (s *Local) Fetch(ctx context.Context, filename, dir string) (string, error) {
+	src, err := s.Dir(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// The storage belongs to root
+	dest := filepath.Join(dir, filename)
+	if _, err := s.exec(ctx, "sudo", "cp", filepath.Join(src, filename), dest); err != nil {
+		return "", err
+	}
+	_, err = s.exec(ctx, "sudo", "chmod", "a+r", dest)
+	return dest, err
+}
+
+func (s *Local) Put(ctx context.Context, file string) error {
+	dest, err := s.Dir(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(ctx, "sudo", "cp", file, dest)
+	return err
+}
+
+func (s *Local) List(ctx context.Context) ([]string, error) {
+	dir, err := s.Dir(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := s.exec(ctx, "sudo", "ls", "-1", dir)
+	if err != nil {
+		return nil, err
+	}
+	files := strings.Fields(string(out))
+	sort.Strings(files)
+	return files, nil
+}
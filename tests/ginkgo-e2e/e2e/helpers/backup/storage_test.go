@@ -0,0 +1,246 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// get-vanilla of the AWS Signature Version 4 test suite
+func TestSignV4(t *testing.T) {
+	g := NewWithT(t)
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	g.Expect(err).To(Not(HaveOccurred()))
+	req.Header.Set("X-Amz-Date", "20150830T123600Z")
+
+	signV4(req, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	g.Expect(req.Header.Get("Authorization")).To(Equal("AWS4-HMAC-SHA256 " +
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"))
+}
+
+// fakeS3 is an in-memory object store with path-style requests
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s3AccessKey+"/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case key == "" && r.Method == http.MethodPut:
+		if _, ok := f.buckets[bucket]; ok {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = io.WriteString(w, "<Error><Code>BucketAlreadyOwnedByYou</Code></Error>")
+			return
+		}
+		f.buckets[bucket] = map[string][]byte{}
+
+	case key == "" && r.Method == http.MethodGet:
+		result := struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+		}{}
+		for k := range f.buckets[bucket] {
+			result.Contents = append(result.Contents, struct {
+				Key string `xml:"Key"`
+			}{k})
+		}
+		_ = xml.NewEncoder(w).Encode(result)
+
+	case r.Method == http.MethodPut:
+		f.buckets[bucket][key], _ = io.ReadAll(r.Body)
+
+	case r.Method == http.MethodGet:
+		data, ok := f.buckets[bucket][key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	store := &fakeS3{buckets: map[string]map[string][]byte{}}
+	srv := httptest.NewTLSServer(store)
+	defer srv.Close()
+
+	// The CA of the cluster secret is the certificate of the test server
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	cl := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: minioNamespace, Name: minioTLSSecret},
+		Data:       map[string][]byte{"ca.crt": caPEM},
+	}).Build()
+
+	s, err := NewStorage(StorageS3, cl, StorageOptions{S3Endpoint: srv.URL})
+	g.Expect(err).To(Not(HaveOccurred()))
+	c, err := s.(*S3).client(ctx)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(c.MakeBucket(ctx, S3Bucket)).To(Succeed())
+	// Again, as after a cluster reset
+	g.Expect(c.MakeBucket(ctx, S3Bucket)).To(Succeed())
+
+	file := filepath.Join(t.TempDir(), "kubewarden-backup-a1b2-2025-06-01T10-00-00Z.tar.gz")
+	g.Expect(os.WriteFile(file, []byte("backup"), 0600)).To(Succeed())
+	g.Expect(s.Put(ctx, file)).To(Succeed())
+	g.Expect(s.List(ctx)).To(Equal([]string{filepath.Base(file)}))
+
+	fetched, err := s.Fetch(ctx, filepath.Base(file), t.TempDir())
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(os.ReadFile(fetched)).To(BeEquivalentTo("backup"))
+
+	_, err = s.Fetch(ctx, "missing.tar.gz", t.TempDir())
+	g.Expect(err).To(MatchError(ContainSubstring("S3 error 404")))
+
+	g.Expect(s.ChartValues()).To(ContainElements(
+		"persistence.enabled=false",
+		"s3.bucketName="+S3Bucket,
+		"s3.endpoint=minio.minio.svc.cluster.local:9000",
+		HavePrefix("s3.endpointCA="),
+	))
+}
+
+func TestS3Prepare(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	store := &fakeS3{buckets: map[string]map[string][]byte{}}
+	srv := httptest.NewTLSServer(store)
+	defer srv.Close()
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	cl := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: minioNamespace, Name: minioTLSSecret},
+		Data:       map[string][]byte{"ca.crt": caPEM},
+	}).Build()
+
+	s, err := NewStorage(StorageS3, cl, StorageOptions{S3Endpoint: srv.URL, Interval: 10 * time.Millisecond})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(s.Prepare(ctx)).To(Succeed())
+	g.Expect(s.List(ctx)).To(BeEmpty())
+
+	// The data is lost with the pod, not on the node
+	deploy := &appsv1.Deployment{}
+	g.Expect(cl.Get(ctx, client.ObjectKey{Namespace: minioNamespace, Name: minioName}, deploy)).To(Succeed())
+	g.Expect(deploy.Spec.Template.Spec.Volumes).To(ContainElement(And(
+		HaveField("Name", "data"),
+		HaveField("VolumeSource.EmptyDir", Not(BeNil())),
+	)))
+
+	// MinIO already deployed: the backups of the run are kept
+	file := filepath.Join(t.TempDir(), "kubewarden-backup-a1b2-2025-06-01T10-00-00Z.tar.gz")
+	g.Expect(os.WriteFile(file, []byte("backup"), 0600)).To(Succeed())
+	g.Expect(s.Put(ctx, file)).To(Succeed())
+	g.Expect(s.Prepare(ctx)).To(Succeed())
+	g.Expect(s.List(ctx)).To(Equal([]string{filepath.Base(file)}))
+}
+
+func TestIsS3Code(t *testing.T) {
+	g := NewWithT(t)
+
+	err := fmt.Errorf("cannot get backup: %w", &S3Error{StatusCode: http.StatusNotFound, Code: "NoSuchKey"})
+	g.Expect(IsS3Code(err, "NoSuchKey")).To(BeTrue())
+	g.Expect(IsS3Code(err, http.StatusNotFound)).To(BeTrue())
+	g.Expect(IsS3Code(err, "NoSuchBucket", http.StatusForbidden)).To(BeFalse())
+	g.Expect(IsS3Code(errors.New("NoSuchKey"), "NoSuchKey")).To(BeFalse())
+}
+
+func TestLocalStorage(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	cl := fake.NewClientBuilder().WithObjects(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: OperatorNamespace, Name: "rancher-backup-5d8f", Labels: map[string]string{"app.kubernetes.io/name": "rancher-backup"}},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: storageVolume, VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "rancher-backup-1"},
+			}}}},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-1234"},
+			Spec: corev1.PersistentVolumeSpec{
+				ClaimRef:               &corev1.ObjectReference{Namespace: OperatorNamespace, Name: "rancher-backup-1"},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{Local: &corev1.LocalVolumeSource{Path: "/var/lib/rancher/k3s/storage/pvc-1234"}},
+			},
+		},
+	).Build()
+
+	calls := []string{}
+	s, err := NewStorage("", cl, StorageOptions{})
+	g.Expect(err).To(Not(HaveOccurred()))
+	s.(*Local).exec = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		return []byte("b.tar.gz\na.tar.gz\n"), nil
+	}
+
+	g.Expect(s.Name()).To(Equal(StorageLocal))
+	g.Expect(s.List(ctx)).To(Equal([]string{"a.tar.gz", "b.tar.gz"}))
+	dest, err := s.Fetch(ctx, "a.tar.gz", "/tmp/spec")
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(dest).To(Equal("/tmp/spec/a.tar.gz"))
+	g.Expect(s.Put(ctx, "/tmp/spec/a.tar.gz")).To(Succeed())
+
+	g.Expect(calls).To(Equal([]string{
+		"sudo ls -1 /var/lib/rancher/k3s/storage/pvc-1234",
+		"sudo cp /var/lib/rancher/k3s/storage/pvc-1234/a.tar.gz /tmp/spec/a.tar.gz",
+		"sudo chmod a+r /tmp/spec/a.tar.gz",
+		"sudo cp /tmp/spec/a.tar.gz /var/lib/rancher/k3s/storage/pvc-1234",
+	}))
+
+	_, err = NewStorage("nfs", cl, StorageOptions{})
+	g.Expect(err).To(MatchError(ContainSubstring("unknown backup storage")))
+}
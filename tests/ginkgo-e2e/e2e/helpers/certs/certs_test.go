@@ -0,0 +1,75 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestIssuedCertificateIsTrusted(t *testing.T) {
+	g := NewWithT(t)
+
+	ca, err := NewCA("kubewarden-e2e")
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(ca.Cert.IsCA).To(BeTrue())
+
+	kp, err := ca.Issue("rancher-manager.test", "127.0.0.1")
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	certFile, keyFile, err := kp.Write(t.TempDir())
+	g.Expect(err).To(Not(HaveOccurred()))
+	serverCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	g.Expect(pool.AppendCertsFromPEM(ca.CertPEM)).To(BeTrue())
+
+	// The IP address is in the certificate, the server is reachable with verified TLS
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := c.Get(srv.URL)
+	g.Expect(err).To(Not(HaveOccurred()))
+	resp.Body.Close()
+
+	// Only the listed hosts are valid
+	leaf, err := x509.ParseCertificate(serverCert.Certificate[0])
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(leaf.VerifyHostname("rancher-manager.test")).To(Succeed())
+	g.Expect(leaf.VerifyHostname("example.com")).To(Not(Succeed()))
+
+	// And the system roots do not know the CA
+	_, err = (&http.Client{}).Get(srv.URL)
+	g.Expect(err).To(MatchError(ContainSubstring("certificate")))
+}
+
+func TestIssueNeedsHosts(t *testing.T) {
+	g := NewWithT(t)
+
+	ca, err := NewCA("kubewarden-e2e")
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	_, err = ca.Issue()
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,287 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/common"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Names of the providers, as set in CLUSTER_PROVIDER
+const (
+	ProviderK3s      = "k3s"
+	ProviderK3d      = "k3d"
+	ProviderKind     = "kind"
+	ProviderExisting = "existing"
+)
+
+// ErrNotSupported is returned by the operations a provider cannot do
+var ErrNotSupported = errors.New("operation not supported by this cluster provider")
+
+// Provider manages the lifecycle of the cluster the specs run against
+type Provider interface {
+	// Name of the provider
+	Name() string
+	// Create the cluster
+	Create(ctx context.Context) error
+	// Destroy the cluster and its data
+	Destroy(ctx context.Context) error
+	// Kubeconfig returns the path of the kubeconfig of the cluster
+	Kubeconfig(ctx context.Context) (string, error)
+	// WaitReady waits for the readiness checks of the provider
+	WaitReady(ctx context.Context) error
+	// Reset destroys and creates the cluster again, then waits for it
+	Reset(ctx context.Context) error
+	// ReadinessChecks returns the workloads which must be ready once the cluster is up
+	ReadinessChecks() []Check
+}
+
+// Options configures the providers, unused fields are ignored
+type Options struct {
+	// Name of the k3d/kind cluster
+	Name string
+	// Kubernetes version, e.g. v1.33.1+k3s1 for K3s/k3d or v1.33.1 for kind
+	Version string
+	// Kubeconfig used by the "existing" provider, KUBECONFIG or ~/.kube/config if empty
+	Kubeconfig string
+	// Timeout of the readiness checks, 4 minutes if not set
+	Timeout time.Duration
+}
+
+/*
+Create a cluster provider
+  - @param name Name of the provider: k3s (default), k3d, kind or existing
+  - @param opts Options of the provider
+  - @returns The provider or an error
+*/
+func New(name string, opts Options) (Provider, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = 4 * time.Minute
+	}
+	if opts.Name == "" {
+		opts.Name = "kubewarden-e2e"
+	}
+	b := base{opts: opts, exec: common.RunEnv}
+
+	switch name {
+	case "", ProviderK3s:
+		return &HostK3s{base: b}, nil
+	case ProviderK3d:
+		return &K3d{base: b}, nil
+	case ProviderKind:
+		return &Kind{base: b}, nil
+	case ProviderExisting:
+		return &Existing{base: b}, nil
+	}
+
+	return nil, fmt.Errorf("unknown cluster provider %q", name)
+}
+
+// base holds what all the providers share
+type base struct {
+	opts Options
+	exec common.EnvExecutor
+}
+
+// waitReady runs the readiness checks of a provider against its kubeconfig
+func waitReady(ctx context.Context, p Provider, timeout time.Duration) error {
+	path, err := p.Kubeconfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	restConfig, err := clientcmd.BuildConfigFromFlags("", path)
+	if err != nil {
+		return fmt.Errorf("cannot load kubeconfig %s: %w", path, err)
+	}
+	c, err := client.New(restConfig, client.Options{})
+	if err != nil {
+		return err
+	}
+
+	return WaitChecks(ctx, c, p.ReadinessChecks(), timeout, 10*time.Second)
+}
+
+// reset is the usual Reset implementation
+func reset(ctx context.Context, p Provider) error {
+	if err := p.Destroy(ctx); err != nil {
+		return err
+	}
+	if err := p.Create(ctx); err != nil {
+		return err
+	}
+	return p.WaitReady(ctx)
+}
+
+// retry calls fn until it succeeds, the last error is returned on timeout
+func retry(ctx context.Context, timeout, interval time.Duration, fn func() error) error {
+	var last error
+
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(context.Context) (bool, error) {
+		last = fn()
+		return last == nil, nil
+	})
+	if err != nil && last != nil {
+		return last
+	}
+	return err
+}
+
+// CheckKind is the kind of workload a readiness check looks at
+type CheckKind string
+
+const (
+	CheckPods      CheckKind = "pods"
+	CheckDaemonSet CheckKind = "daemonset"
+)
+
+// Check is a workload which must be ready
+type Check struct {
+	Kind      CheckKind
+	Namespace string
+	Selector  string
+}
+
+func (c Check) String() string {
+	return fmt.Sprintf("%s %s in %s", c.Kind, c.Selector, c.Namespace)
+}
+
+/*
+Check that the workload is ready
+  - @param cl Client of the cluster
+  - @returns nil if ready, an error describing what is missing otherwise
+*/
+func (c Check) Ready(ctx context.Context, cl client.Client) error {
+	selector, err := labels.Parse(c.Selector)
+	if err != nil {
+		return err
+	}
+	opts := []client.ListOption{client.InNamespace(c.Namespace), client.MatchingLabelsSelector{Selector: selector}}
+
+	switch c.Kind {
+	case CheckPods:
+		pods := &corev1.PodList{}
+		if err := cl.List(ctx, pods, opts...); err != nil {
+			return err
+		}
+		if len(pods.Items) == 0 {
+			return fmt.Errorf("no pod found for %s", c)
+		}
+		for _, p := range pods.Items {
+			if p.Status.Phase == corev1.PodSucceeded {
+				continue
+			}
+			if !podReady(&p) {
+				return fmt.Errorf("pod %s/%s not ready (%s)", p.Namespace, p.Name, p.Status.Phase)
+			}
+		}
+
+	case CheckDaemonSet:
+		daemonSets := &appsv1.DaemonSetList{}
+		if err := cl.List(ctx, daemonSets, opts...); err != nil {
+			return err
+		}
+		if len(daemonSets.Items) == 0 {
+			return fmt.Errorf("no daemonset found for %s", c)
+		}
+		for _, ds := range daemonSets.Items {
+			if ds.Status.DesiredNumberScheduled == 0 || ds.Status.NumberReady != ds.Status.DesiredNumberScheduled {
+				return fmt.Errorf("daemonset %s/%s has %d/%d pods ready", ds.Namespace, ds.Name,
+					ds.Status.NumberReady, ds.Status.DesiredNumberScheduled)
+			}
+		}
+
+	default:
+		return fmt.Errorf("unknown check kind %q", c.Kind)
+	}
+
+	return nil
+}
+
+func podReady(p *corev1.Pod) bool {
+	for _, cond := range p.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+/*
+Wait for readiness checks
+  - @param cl Client of the cluster
+  - @param checks Checks which must all succeed
+  - @param timeout Maximum time to wait
+  - @param interval Time between two rounds of checks
+  - @returns nil when all the checks succeed, the last failure on timeout
+*/
+func WaitChecks(ctx context.Context, cl client.Client, checks []Check, timeout, interval time.Duration) error {
+	return retry(ctx, timeout, interval, func() error {
+		for _, c := range checks {
+			if err := c.Ready(ctx, cl); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// nodeReady returns true if the node has the Ready condition
+func nodeReady(n *corev1.Node) bool {
+	for _, cond := range n.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+/*
+Wait for the nodes of the cluster, e.g. the agents joining a server
+  - @param cl Client of the cluster
+  - @param count Number of nodes expected
+  - @param timeout Maximum time to wait
+  - @param interval Time between two checks
+  - @returns nil when count nodes are ready, the last failure on timeout
+*/
+func WaitNodes(ctx context.Context, cl client.Client, count int, timeout, interval time.Duration) error {
+	return retry(ctx, timeout, interval, func() error {
+		nodes := &corev1.NodeList{}
+		if err := cl.List(ctx, nodes); err != nil {
+			return err
+		}
+
+		notReady := []string{}
+		for i := range nodes.Items {
+			if !nodeReady(&nodes.Items[i]) {
+				notReady = append(notReady, nodes.Items[i].Name)
+			}
+		}
+		if len(nodes.Items) != count || len(notReady) > 0 {
+			return fmt.Errorf("%d/%d nodes, not ready: %v", len(nodes.Items), count, notReady)
+		}
+		return nil
+	})
+}
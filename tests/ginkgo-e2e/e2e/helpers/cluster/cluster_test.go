@@ -0,0 +1,191 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// recorder is an Executor keeping the commands instead of running them
+type recorder struct {
+	commands []string
+	output   string
+}
+
+func (r *recorder) exec(_ context.Context, env []string, name string, args ...string) ([]byte, error) {
+	r.commands = append(r.commands, strings.TrimSpace(strings.Join(env, " ")+" "+name+" "+strings.Join(args, " ")))
+	return []byte(r.output), nil
+}
+
+func TestNew(t *testing.T) {
+	g := NewWithT(t)
+
+	for name, expected := range map[string]string{
+		"":               ProviderK3s,
+		ProviderK3s:      ProviderK3s,
+		ProviderK3d:      ProviderK3d,
+		ProviderKind:     ProviderKind,
+		ProviderExisting: ProviderExisting,
+	} {
+		p, err := New(name, Options{})
+		g.Expect(err).To(Not(HaveOccurred()))
+		g.Expect(p.Name()).To(Equal(expected))
+		g.Expect(p.ReadinessChecks()).To(Not(BeEmpty()))
+	}
+
+	_, err := New("minikube", Options{})
+	g.Expect(err).To(MatchError(ContainSubstring("unknown cluster provider")))
+}
+
+func TestHostK3sCreate(t *testing.T) {
+	g := NewWithT(t)
+
+	p, _ := New(ProviderK3s, Options{Version: "v1.33.1+k3s1"})
+	r := &recorder{}
+	p.(*HostK3s).exec = r.exec
+
+	g.Expect(p.Create(context.Background())).To(Succeed())
+	g.Expect(r.commands).To(Equal([]string{
+		"curl -sfL https://get.k3s.io -o k3s-install.sh",
+		"INSTALL_K3S_EXEC=--disable metrics-server INSTALL_K3S_VERSION=v1.33.1+k3s1 sh k3s-install.sh",
+		"sudo systemctl start k3s",
+	}))
+}
+
+func TestK3dCommands(t *testing.T) {
+	g := NewWithT(t)
+
+	p, _ := New(ProviderK3d, Options{Name: "kw", Version: "v1.33.1+k3s1", Timeout: time.Minute})
+	r := &recorder{output: "/home/user/.config/k3d/kubeconfig-kw.yaml\n"}
+	p.(*K3d).exec = r.exec
+
+	g.Expect(p.Create(context.Background())).To(Succeed())
+	g.Expect(p.Kubeconfig(context.Background())).To(Equal("/home/user/.config/k3d/kubeconfig-kw.yaml"))
+	g.Expect(p.Destroy(context.Background())).To(Succeed())
+	g.Expect(r.commands).To(Equal([]string{
+		"k3d cluster create kw --wait --timeout 1m0s --k3s-arg --disable=metrics-server@server:* --image rancher/k3s:v1.33.1-k3s1",
+		"k3d kubeconfig write kw",
+		"k3d cluster delete kw",
+	}))
+}
+
+func TestKindKubeconfig(t *testing.T) {
+	g := NewWithT(t)
+
+	p, _ := New(ProviderKind, Options{Name: "unit-test"})
+	r := &recorder{output: "apiVersion: v1\nkind: Config\n"}
+	p.(*Kind).exec = r.exec
+
+	path, err := p.Kubeconfig(context.Background())
+	g.Expect(err).To(Not(HaveOccurred()))
+	defer os.Remove(path)
+
+	g.Expect(os.ReadFile(path)).To(Equal([]byte(r.output)))
+	g.Expect(r.commands).To(Equal([]string{"kind get kubeconfig --name unit-test"}))
+}
+
+func TestExisting(t *testing.T) {
+	g := NewWithT(t)
+
+	p, _ := New(ProviderExisting, Options{Kubeconfig: "/tmp/config"})
+	g.Expect(p.Kubeconfig(context.Background())).To(Equal("/tmp/config"))
+	g.Expect(p.Create(context.Background())).To(Succeed())
+	g.Expect(p.Reset(context.Background())).To(MatchError(ErrNotSupported))
+
+	t.Setenv("KUBECONFIG", "/tmp/env-config")
+	p, _ = New(ProviderExisting, Options{})
+	g.Expect(p.Kubeconfig(context.Background())).To(Equal("/tmp/env-config"))
+}
+
+func readyPod(name string, ready corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-system", Labels: map[string]string{"k8s-app": "kube-dns"}},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+		},
+	}
+}
+
+func TestChecks(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	dns := Check{Kind: CheckPods, Namespace: "kube-system", Selector: "k8s-app=kube-dns"}
+	proxy := Check{Kind: CheckDaemonSet, Namespace: "kube-system", Selector: "k8s-app=kube-proxy"}
+
+	c := fake.NewClientBuilder().WithObjects(readyPod("coredns-1", corev1.ConditionTrue)).Build()
+	g.Expect(dns.Ready(ctx, c)).To(Succeed())
+	g.Expect(proxy.Ready(ctx, c)).To(MatchError(ContainSubstring("no daemonset found")))
+
+	g.Expect(c.Create(ctx, readyPod("coredns-2", corev1.ConditionFalse))).To(Succeed())
+	g.Expect(dns.Ready(ctx, c)).To(MatchError(ContainSubstring("coredns-2 not ready")))
+
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-proxy", Namespace: "kube-system", Labels: map[string]string{"k8s-app": "kube-proxy"}},
+		Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 2, NumberReady: 1},
+	}
+	g.Expect(c.Create(ctx, ds)).To(Succeed())
+	err := WaitChecks(ctx, c, []Check{proxy}, 50*time.Millisecond, 10*time.Millisecond)
+	g.Expect(err).To(MatchError(ContainSubstring("has 1/2 pods ready")))
+
+	ds.Status.NumberReady = 2
+	g.Expect(c.Status().Update(ctx, ds)).To(Succeed())
+	g.Expect(WaitChecks(ctx, c, []Check{proxy}, time.Second, 10*time.Millisecond)).To(Succeed())
+
+	// Pods of completed jobs are ignored
+	g.Expect(c.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "coredns-2", Namespace: "kube-system"}})).To(Succeed())
+	done := readyPod("coredns-job", corev1.ConditionFalse)
+	done.Status.Phase = corev1.PodSucceeded
+	g.Expect(c.Create(ctx, done)).To(Succeed())
+	g.Expect(dns.Ready(ctx, c)).To(Succeed())
+}
+
+func readyNode(name string, ready corev1.ConditionStatus) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}}},
+	}
+}
+
+func TestWaitNodes(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	c := fake.NewClientBuilder().WithObjects(
+		readyNode("rancher-manager", corev1.ConditionTrue),
+		readyNode("agent-1", corev1.ConditionTrue),
+		readyNode("agent-2", corev1.ConditionFalse),
+	).Build()
+
+	g.Expect(WaitNodes(ctx, c, 3, 30*time.Millisecond, 10*time.Millisecond)).To(MatchError("3/3 nodes, not ready: [agent-2]"))
+	g.Expect(WaitNodes(ctx, c, 4, 30*time.Millisecond, 10*time.Millisecond)).To(MatchError(ContainSubstring("3/4 nodes")))
+
+	c = fake.NewClientBuilder().WithObjects(
+		readyNode("rancher-manager", corev1.ConditionTrue),
+		readyNode("agent-1", corev1.ConditionTrue),
+	).Build()
+	g.Expect(WaitNodes(ctx, c, 2, 30*time.Millisecond, 10*time.Millisecond)).To(Succeed())
+}
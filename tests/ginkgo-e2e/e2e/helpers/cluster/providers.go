@@ -0,0 +1,231 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Workloads deployed by K3s, also used by k3d
+var k3sChecks = []Check{
+	{Kind: CheckPods, Namespace: "kube-system", Selector: "app=local-path-provisioner"},
+	{Kind: CheckPods, Namespace: "kube-system", Selector: "k8s-app=kube-dns"},
+	{Kind: CheckPods, Namespace: "kube-system", Selector: "app.kubernetes.io/name=traefik"},
+	{Kind: CheckPods, Namespace: "kube-system", Selector: "svccontroller.k3s.cattle.io/svcname=traefik"},
+	{Kind: CheckDaemonSet, Namespace: "kube-system", Selector: "svccontroller.k3s.cattle.io/svcname=traefik"},
+}
+
+// HostK3s installs K3s on the host running the tests
+type HostK3s struct {
+	base
+}
+
+const (
+	k3sInstallScript = "k3s-install.sh"
+	k3sKubeconfig    = "/etc/rancher/k3s/k3s.yaml"
+)
+
+func (p *HostK3s) Name() string { return ProviderK3s }
+
+func (p *HostK3s) Create(ctx context.Context) error {
+	err := retry(ctx, 2*time.Minute, 10*time.Second, func() error {
+		_, err := p.exec(ctx, nil, "curl", "-sfL", "https://get.k3s.io", "-o", k3sInstallScript)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	env := []string{"INSTALL_K3S_EXEC=--disable metrics-server"}
+	if p.opts.Version != "" {
+		env = append(env, "INSTALL_K3S_VERSION="+p.opts.Version)
+	}
+
+	// Retry in case of (sporadic) failure...
+	err = retry(ctx, 2*time.Minute, 5*time.Second, func() error {
+		_, err := p.exec(ctx, env, "sh", k3sInstallScript)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.exec(ctx, nil, "sudo", "systemctl", "start", "k3s")
+	return err
+}
+
+func (p *HostK3s) Destroy(ctx context.Context) error {
+	_, err := p.exec(ctx, nil, "k3s-uninstall.sh")
+	return err
+}
+
+func (p *HostK3s) Kubeconfig(context.Context) (string, error) {
+	return k3sKubeconfig, nil
+}
+
+func (p *HostK3s) WaitReady(ctx context.Context) error {
+	return waitReady(ctx, p, p.opts.Timeout)
+}
+
+func (p *HostK3s) Reset(ctx context.Context) error {
+	return reset(ctx, p)
+}
+
+func (p *HostK3s) ReadinessChecks() []Check {
+	return k3sChecks
+}
+
+// K3d runs K3s in containers
+type K3d struct {
+	base
+}
+
+func (p *K3d) Name() string { return ProviderK3d }
+
+func (p *K3d) Create(ctx context.Context) error {
+	args := []string{"cluster", "create", p.opts.Name,
+		"--wait", "--timeout", p.opts.Timeout.String(),
+		"--k3s-arg", "--disable=metrics-server@server:*",
+	}
+	if p.opts.Version != "" {
+		// Image tags can't contain "+"
+		args = append(args, "--image", "rancher/k3s:"+strings.ReplaceAll(p.opts.Version, "+", "-"))
+	}
+
+	_, err := p.exec(ctx, nil, "k3d", args...)
+	return err
+}
+
+func (p *K3d) Destroy(ctx context.Context) error {
+	_, err := p.exec(ctx, nil, "k3d", "cluster", "delete", p.opts.Name)
+	return err
+}
+
+func (p *K3d) Kubeconfig(ctx context.Context) (string, error) {
+	out, err := p.exec(ctx, nil, "k3d", "kubeconfig", "write", p.opts.Name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (p *K3d) WaitReady(ctx context.Context) error {
+	return waitReady(ctx, p, p.opts.Timeout)
+}
+
+func (p *K3d) Reset(ctx context.Context) error {
+	return reset(ctx, p)
+}
+
+func (p *K3d) ReadinessChecks() []Check {
+	return k3sChecks
+}
+
+// Kind runs Kubernetes in containers with kind
+type Kind struct {
+	base
+}
+
+func (p *Kind) Name() string { return ProviderKind }
+
+func (p *Kind) Create(ctx context.Context) error {
+	args := []string{"create", "cluster", "--name", p.opts.Name, "--wait", p.opts.Timeout.String()}
+	if p.opts.Version != "" {
+		args = append(args, "--image", "kindest/node:"+p.opts.Version)
+	}
+
+	_, err := p.exec(ctx, nil, "kind", args...)
+	return err
+}
+
+func (p *Kind) Destroy(ctx context.Context) error {
+	_, err := p.exec(ctx, nil, "kind", "delete", "cluster", "--name", p.opts.Name)
+	return err
+}
+
+func (p *Kind) Kubeconfig(ctx context.Context) (string, error) {
+	out, err := p.exec(ctx, nil, "kind", "get", "kubeconfig", "--name", p.opts.Name)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(os.TempDir(), "kind-"+p.opts.Name+".kubeconfig")
+	return path, os.WriteFile(path, out, 0600)
+}
+
+func (p *Kind) WaitReady(ctx context.Context) error {
+	return waitReady(ctx, p, p.opts.Timeout)
+}
+
+func (p *Kind) Reset(ctx context.Context) error {
+	return reset(ctx, p)
+}
+
+func (p *Kind) ReadinessChecks() []Check {
+	return []Check{
+		{Kind: CheckPods, Namespace: "kube-system", Selector: "k8s-app=kube-dns"},
+		{Kind: CheckPods, Namespace: "local-path-storage", Selector: "app=local-path-provisioner"},
+		{Kind: CheckDaemonSet, Namespace: "kube-system", Selector: "app=kindnet"},
+		{Kind: CheckDaemonSet, Namespace: "kube-system", Selector: "k8s-app=kube-proxy"},
+	}
+}
+
+// Existing uses the current kubeconfig as is, the cluster is managed outside of the tests
+type Existing struct {
+	base
+}
+
+func (p *Existing) Name() string { return ProviderExisting }
+
+func (p *Existing) Create(context.Context) error {
+	return nil
+}
+
+func (p *Existing) Destroy(context.Context) error {
+	return ErrNotSupported
+}
+
+func (p *Existing) Kubeconfig(context.Context) (string, error) {
+	if p.opts.Kubeconfig != "" {
+		return p.opts.Kubeconfig, nil
+	}
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return env, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".kube", "config"), nil
+}
+
+func (p *Existing) WaitReady(ctx context.Context) error {
+	return waitReady(ctx, p, p.opts.Timeout)
+}
+
+func (p *Existing) Reset(context.Context) error {
+	return ErrNotSupported
+}
+
+func (p *Existing) ReadinessChecks() []Check {
+	return []Check{
+		{Kind: CheckPods, Namespace: "kube-system", Selector: "k8s-app=kube-dns"},
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRun(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	g.Expect(Run(ctx, "echo", "ok")).To(BeEquivalentTo("ok\n"))
+	g.Expect(RunEnv(ctx, []string{"E2E_VALUE=42"}, "sh", "-c", "echo $E2E_VALUE")).To(BeEquivalentTo("42\n"))
+
+	out, err := Run(ctx, "sh", "-c", "echo broken; exit 3")
+	g.Expect(out).To(BeEquivalentTo("broken\n"))
+	g.Expect(err).To(MatchError("sh -c echo broken; exit 3 failed: exit status 3: broken\n"))
+}
+
+func TestPoll(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	calls := 0
+	g.Expect(Poll(ctx, time.Millisecond, time.Second, "the third call", func(context.Context) (bool, error) {
+		calls++
+		return calls == 3, nil
+	})).To(Succeed())
+	g.Expect(calls).To(Equal(3))
+
+	// The last error explains the timeout
+	err := Poll(ctx, time.Millisecond, 20*time.Millisecond, "nothing", func(context.Context) (bool, error) {
+		return false, errors.New("still pending")
+	})
+	g.Expect(err).To(MatchError("timed out waiting for nothing: still pending"))
+
+	err = Poll(ctx, time.Millisecond, 20*time.Millisecond, "nothing", func(context.Context) (bool, error) {
+		return false, nil
+	})
+	g.Expect(err).To(MatchError(ContainSubstring("timed out waiting for nothing: ")))
+}
+
+func TestControlPlaneIP(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	node := func(name string, labels map[string]string, ip string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: ip}}},
+		}
+	}
+
+	cl := fake.NewClientBuilder().WithObjects(node("agent", nil, "192.168.122.102")).Build()
+	_, err := ControlPlaneIP(ctx, cl)
+	g.Expect(err).To(MatchError("no control-plane node with an internal IP"))
+
+	cl = fake.NewClientBuilder().WithObjects(
+		node("agent", nil, "192.168.122.102"),
+		node("server", map[string]string{"node-role.kubernetes.io/control-plane": "true"}, "192.168.122.101"),
+	).Build()
+	g.Expect(ControlPlaneIP(ctx, cl)).To(Equal("192.168.122.101"))
+}
@@ -0,0 +1,46 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Executor runs a command and returns its combined output
+type Executor func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// EnvExecutor runs a command with extra environment variables and returns its combined output
+type EnvExecutor func(ctx context.Context, env []string, name string, args ...string) ([]byte, error)
+
+// Run is the default Executor
+func Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return RunEnv(ctx, nil, name, args...)
+}
+
+// RunEnv is the default EnvExecutor
+func RunEnv(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, out)
+	}
+	return out, nil
+}
@@ -0,0 +1,49 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+/*
+Call check until it returns true
+  - @param interval Time between two checks
+  - @param timeout Time given to check to succeed
+  - @param what What is waited for, used in the error message
+  - @param check Function returning true when done, its last error explains a timeout
+  - @returns Nothing or an error with the last error of check
+*/
+func Poll(ctx context.Context, interval, timeout time.Duration, what string, check func(context.Context) (bool, error)) error {
+	var last error
+
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		done, err := check(ctx)
+		last = err
+		return done, nil
+	})
+	if err != nil {
+		if last != nil {
+			return fmt.Errorf("timed out waiting for %s: %w", what, last)
+		}
+		return fmt.Errorf("timed out waiting for %s: %w", what, err)
+	}
+
+	return nil
+}
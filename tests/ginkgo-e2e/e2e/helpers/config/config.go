@@ -0,0 +1,272 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2/types"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variable pointing to an optional YAML configuration file
+const ConfigFileEnv = "E2E_CONFIG_FILE"
+
+// SuiteConfig holds every setting used by the E2E suite.
+// Each field can be set in the YAML file (yaml tag) and overridden
+// by an environment variable (env tag). Fields tagged secret are not printed.
+type SuiteConfig struct {
+	AdmControllerVersion                  string `yaml:"admControllerVersion" env:"ADM_CONTROLLER_VERSION"`
+	AirgapAgents                          string `yaml:"airgapAgents" env:"AIRGAP_AGENTS"`
+	AirgapChartsDir                       string `yaml:"airgapChartsDir" env:"AIRGAP_CHARTS_DIR"`
+	AirgapRegistryTLS                     string `yaml:"airgapRegistryTLS" env:"AIRGAP_REGISTRY_TLS"`
+	AllowPrivilegeEscalationPolicyVersion string `yaml:"allowPrivilegeEscalationPolicyVersion" env:"ALLOW_PRIVILEGE_ESCALATION_PSP_VERSION"`
+	AppCoPassword                         string `yaml:"appCoPassword" env:"APPCO_PW" secret:"true"`
+	AppCoUsername                         string `yaml:"appCoUsername" env:"APPCO_ID"`
+	AppCoVersion                          string `yaml:"appCoVersion" env:"APPCO_VERSION"`
+	AuditScannerVersion                   string `yaml:"auditScannerVersion" env:"AUDIT_SCANNER_VERSION"`
+	BackupRestoreVersion                  string `yaml:"backupRestoreVersion" env:"BACKUP_RESTORE_VERSION"`
+	BackupStorage                         string `yaml:"backupStorage" env:"BACKUP_STORAGE"`
+	CapabilitiesPolicyVersion             string `yaml:"capabilitiesPolicyVersion" env:"CAPABILITIES_PSP_VERSION"`
+	ClusterName                           string `yaml:"clusterName" env:"CLUSTER_NAME"`
+	ClusterProvider                       string `yaml:"clusterProvider" env:"CLUSTER_PROVIDER"`
+	HostNamespacePolicyVersion            string `yaml:"hostNamespacePolicyVersion" env:"HOST_NAMESPACES_PSP_VERSION"`
+	HostPathsPolicyVersion                string `yaml:"hostPathsPolicyVersion" env:"HOSTPATHS_PSP_VERSION"`
+	InstallMode                           string `yaml:"installMode" env:"INSTALL_MODE"`
+	K3sVersion                            string `yaml:"k3sVersion" env:"INSTALL_K3S_VERSION"`
+	KubewardenRelease                     string `yaml:"kubewardenRelease" env:"KUBEWARDEN_RELEASE"`
+	PodPrivilegedPolicyVersion            string `yaml:"podPrivilegedPolicyVersion" env:"POD_PRIVILEGED_PSP_VERSION"`
+	PolicyServerVersion                   string `yaml:"policyServerVersion" env:"POLICY_SERVER_VERSION"`
+	RancherHostname                       string `yaml:"rancherHostname" env:"PUBLIC_FQDN"`
+	ReportDir                             string `yaml:"reportDir" env:"REPORT_DIR"`
+	StepBudgetsFile                       string `yaml:"stepBudgetsFile" env:"STEP_BUDGETS_FILE"`
+	TestType                              string `yaml:"testType" env:"TEST_TYPE"`
+	UpgradeFromRelease                    string `yaml:"upgradeFromRelease" env:"UPGRADE_FROM_RELEASE"`
+	UserGroupPolicyVersion                string `yaml:"userGroupPolicyVersion" env:"USER_GROUP_PSP_VERSION"`
+	VersionMatrixFile                     string `yaml:"versionMatrixFile" env:"VERSION_MATRIX_FILE"`
+}
+
+// requirement lists the fields needed when a spec with one of the labels is selected
+type requirement struct {
+	labels []string
+	fields []string
+	// Optional condition, the requirement is skipped if it returns false
+	when func(c *SuiteConfig) bool
+}
+
+var policyVersionFields = []string{
+	"AllowPrivilegeEscalationPolicyVersion",
+	"CapabilitiesPolicyVersion",
+	"HostNamespacePolicyVersion",
+	"HostPathsPolicyVersion",
+	"PodPrivilegedPolicyVersion",
+	"UserGroupPolicyVersion",
+}
+
+// Name in the chart values of the recommended policy of each version field
+var policyValueNames = map[string]string{
+	"AllowPrivilegeEscalationPolicyVersion": "allowPrivilegeEscalationPolicy",
+	"CapabilitiesPolicyVersion":             "capabilitiesPolicy",
+	"HostNamespacePolicyVersion":            "hostNamespacePolicy",
+	"HostPathsPolicyVersion":                "hostPathsPolicy",
+	"PodPrivilegedPolicyVersion":            "podPrivilegedPolicy",
+	"UserGroupPolicyVersion":                "userGroupPolicy",
+}
+
+var requirements = []requirement{
+	{
+		labels: []string{"prepare-archive"},
+		fields: []string{"K3sVersion", "TestType"},
+	},
+	{
+		labels: []string{"airgap-rancher"},
+		fields: []string{"K3sVersion", "AdmControllerVersion", "AuditScannerVersion", "PolicyServerVersion"},
+	},
+	{
+		// Policy versions come from the previous Hauler manifest for the upgrade test
+		labels: []string{"airgap-rancher"},
+		fields: policyVersionFields,
+		when:   func(c *SuiteConfig) bool { return c.TestType != "upgrade" },
+	},
+	{
+		labels: []string{"airgap-upgrade"},
+		fields: append([]string{"AdmControllerVersion", "AuditScannerVersion", "PolicyServerVersion"}, policyVersionFields...),
+	},
+	{
+		labels: []string{"install-kubewarden"},
+		fields: []string{"AppCoUsername", "AppCoPassword"},
+		when:   func(c *SuiteConfig) bool { return c.InstallMode == "appco" },
+	},
+}
+
+/*
+Load the suite configuration
+  - @param file Optional YAML file, ignored if empty
+  - @returns The configuration, values from environment variables take precedence over the file
+*/
+func Load(file string) (*SuiteConfig, error) {
+	c := &SuiteConfig{}
+
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read configuration file: %w", err)
+		}
+
+		if err := yaml.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("cannot parse configuration file %s: %w", file, err)
+		}
+	}
+
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if value, ok := os.LookupEnv(v.Type().Field(i).Tag.Get("env")); ok {
+			v.Field(i).SetString(value)
+		}
+	}
+
+	return c, nil
+}
+
+/*
+Fill the unset image and policy versions from a Kubewarden release
+  - @param r Release resolved from the version matrix
+  - @returns Nothing, explicitly set versions are kept
+*/
+func (c *SuiteConfig) ApplyRelease(r *versions.Release) {
+	setDefault := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+
+	setDefault(&c.AdmControllerVersion, r.Images.Controller)
+	setDefault(&c.AuditScannerVersion, r.Images.AuditScanner)
+	setDefault(&c.PolicyServerVersion, r.Images.PolicyServer)
+
+	v := reflect.ValueOf(c).Elem()
+	for field, name := range policyValueNames {
+		if v.FieldByName(field).String() == "" {
+			v.FieldByName(field).SetString(r.Policies[name])
+		}
+	}
+}
+
+/*
+Get the release to test with the versions of the configuration
+  - @param r Release of the version matrix, nil for the latest charts
+  - @returns A copy of the release, the versions set in the configuration take precedence
+*/
+func (c *SuiteConfig) TargetRelease(r *versions.Release) *versions.Release {
+	release := versions.Release{}
+	policies := map[string]string{}
+	if r != nil {
+		release = *r
+		for name, tag := range r.Policies {
+			policies[name] = tag
+		}
+	}
+	release.Policies = policies
+
+	for field, tag := range map[*string]string{
+		&release.Images.Controller:   c.AdmControllerVersion,
+		&release.Images.AuditScanner: c.AuditScannerVersion,
+		&release.Images.PolicyServer: c.PolicyServerVersion,
+	} {
+		if tag != "" {
+			*field = tag
+		}
+	}
+
+	v := reflect.ValueOf(c).Elem()
+	for field, name := range policyValueNames {
+		if tag := v.FieldByName(field).String(); tag != "" {
+			release.Policies[name] = tag
+		}
+	}
+
+	return &release
+}
+
+/*
+Validate the configuration against the selected specs
+  - @param labelFilter Ginkgo label filter, an empty filter selects all the specs
+  - @returns An error listing all the missing settings, per label
+*/
+func (c *SuiteConfig) Validate(labelFilter string) error {
+	filter, err := types.ParseLabelFilter(labelFilter)
+	if err != nil {
+		return fmt.Errorf("invalid label filter %q: %w", labelFilter, err)
+	}
+
+	missing := map[string][]string{}
+	v := reflect.ValueOf(c).Elem()
+	for _, r := range requirements {
+		if r.when != nil && !r.when(c) {
+			continue
+		}
+
+		for _, label := range r.labels {
+			if !filter([]string{label}) {
+				continue
+			}
+
+			for _, name := range r.fields {
+				if v.FieldByName(name).String() == "" {
+					f, _ := v.Type().FieldByName(name)
+					missing[label] = append(missing[label], f.Tag.Get("env"))
+				}
+			}
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	labels := make([]string, 0, len(missing))
+	for label := range missing {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	msg := []string{}
+	for _, label := range labels {
+		msg = append(msg, fmt.Sprintf("label %q requires %s", label, strings.Join(missing[label], ", ")))
+	}
+
+	return fmt.Errorf("missing suite configuration: %s", strings.Join(msg, "; "))
+}
+
+// String returns the resolved configuration, one ENV=value per line
+func (c *SuiteConfig) String() string {
+	var b strings.Builder
+
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		value := v.Field(i).String()
+		if value != "" && v.Type().Field(i).Tag.Get("secret") == "true" {
+			value = "***"
+		}
+		fmt.Fprintf(&b, "%s=%s\n", v.Type().Field(i).Tag.Get("env"), value)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+)
+
+// unsetEnv clears the variables of the configuration for the test
+func unsetEnv(t *testing.T) {
+	typ := reflect.TypeOf(SuiteConfig{})
+	for i := 0; i < typ.NumField(); i++ {
+		name := typ.Field(i).Tag.Get("env")
+		// Setenv restores the variable at the end of the test
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	g := NewWithT(t)
+	unsetEnv(t)
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	g.Expect(os.WriteFile(file, []byte("k3sVersion: v1.33.5+k3s1\nclusterName: from-file\ntestType: single\n"), 0644)).To(Succeed())
+
+	// Environment variables take precedence over the file
+	t.Setenv("CLUSTER_NAME", "from-env")
+	t.Setenv("INSTALL_MODE", "appco")
+
+	c, err := Load(file)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(c.K3sVersion).To(Equal("v1.33.5+k3s1"))
+	g.Expect(c.ClusterName).To(Equal("from-env"))
+	g.Expect(c.InstallMode).To(Equal("appco"))
+	g.Expect(c.TestType).To(Equal("single"))
+
+	// An empty variable still overrides the file
+	t.Setenv("TEST_TYPE", "")
+	c, err = Load(file)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(c.TestType).To(BeEmpty())
+
+	// No file, environment only
+	c, err = Load("")
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(c.ClusterName).To(Equal("from-env"))
+	g.Expect(c.K3sVersion).To(BeEmpty())
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	g.Expect(err).To(MatchError(ContainSubstring("cannot read configuration file")))
+
+	g.Expect(os.WriteFile(file, []byte("k3sVersion: [\n"), 0644)).To(Succeed())
+	_, err = Load(file)
+	g.Expect(err).To(MatchError(ContainSubstring("cannot parse configuration file")))
+}
+
+func TestValidate(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &SuiteConfig{TestType: "single"}
+	g.Expect(c.Validate("")).To(MatchError(And(
+		ContainSubstring(`label "airgap-rancher" requires INSTALL_K3S_VERSION, ADM_CONTROLLER_VERSION`),
+		ContainSubstring(`label "prepare-archive" requires INSTALL_K3S_VERSION`),
+		Not(ContainSubstring(`"install-kubewarden"`)),
+	)))
+
+	// Only the requirements of the selected labels are checked
+	g.Expect(c.Validate("upgrade")).To(Succeed())
+	g.Expect(c.Validate("prepare-archive")).To(MatchError(And(
+		ContainSubstring("INSTALL_K3S_VERSION"),
+		Not(ContainSubstring("airgap-rancher")),
+	)))
+
+	// Conditional requirements
+	c.InstallMode = "appco"
+	g.Expect(c.Validate("install-kubewarden")).To(MatchError(ContainSubstring(`label "install-kubewarden" requires APPCO_ID, APPCO_PW`)))
+	c.AppCoUsername, c.AppCoPassword = "user", "secret"
+	g.Expect(c.Validate("install-kubewarden")).To(Succeed())
+
+	c = &SuiteConfig{TestType: "upgrade", K3sVersion: "v1.33.5+k3s1", AdmControllerVersion: "v1.33.0", AuditScannerVersion: "v1.33.0", PolicyServerVersion: "v1.33.0"}
+	g.Expect(c.Validate("airgap-rancher")).To(Succeed())
+
+	g.Expect(c.Validate("&&")).To(MatchError(ContainSubstring("invalid label filter")))
+}
+
+func TestString(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &SuiteConfig{AppCoUsername: "user", AppCoPassword: "secret", ClusterName: "e2e"}
+	s := c.String()
+	g.Expect(s).To(ContainSubstring("APPCO_ID=user\n"))
+	g.Expect(s).To(ContainSubstring("APPCO_PW=***\n"))
+	g.Expect(s).To(ContainSubstring("CLUSTER_NAME=e2e\n"))
+	g.Expect(s).To(ContainSubstring("INSTALL_K3S_VERSION=\n"))
+	g.Expect(s).ToNot(ContainSubstring("secret"))
+
+	// Unset secrets are shown as empty
+	c.AppCoPassword = ""
+	g.Expect(c.String()).To(ContainSubstring("APPCO_PW=\n"))
+}
+
+func TestTargetRelease(t *testing.T) {
+	g := NewWithT(t)
+
+	// Latest charts, only the configured versions are pinned
+	c := &SuiteConfig{PolicyServerVersion: "v1.34.0", CapabilitiesPolicyVersion: "v1.0.4"}
+	r := c.TargetRelease(nil)
+	g.Expect(r.Images).To(Equal(versions.Images{PolicyServer: "v1.34.0"}))
+	g.Expect(r.Policies).To(Equal(map[string]string{"capabilitiesPolicy": "v1.0.4"}))
+	g.Expect(r.PolicyValues()).To(Equal([]string{"recommendedPolicies.capabilitiesPolicy.module.tag=v1.0.4"}))
+
+	// The configured versions take precedence, the release of the matrix is not changed
+	matrix := &versions.Release{
+		Version:  "v1.33",
+		Images:   versions.Images{Controller: "v1.33.0", PolicyServer: "v1.33.0"},
+		Policies: map[string]string{"capabilitiesPolicy": "v1.0.3", "userGroupPolicy": "v1.0.2"},
+	}
+	r = c.TargetRelease(matrix)
+	g.Expect(r.Version).To(Equal("v1.33"))
+	g.Expect(r.Images).To(Equal(versions.Images{Controller: "v1.33.0", PolicyServer: "v1.34.0"}))
+	g.Expect(r.Policies).To(Equal(map[string]string{"capabilitiesPolicy": "v1.0.4", "userGroupPolicy": "v1.0.2"}))
+	g.Expect(matrix.Policies).To(HaveKeyWithValue("capabilitiesPolicy", "v1.0.3"))
+	g.Expect(matrix.Images.PolicyServer).To(Equal("v1.33.0"))
+}
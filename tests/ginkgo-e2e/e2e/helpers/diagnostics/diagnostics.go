@@ -0,0 +1,202 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+)
+
+// Runner executes a shell command where the cluster can be reached
+type Runner interface {
+	// Ready returns an error if commands cannot be executed at all
+	Ready() error
+	Run(cmd string) (string, error)
+}
+
+// LocalRunner executes the commands on the test runner
+type LocalRunner struct{}
+
+func (LocalRunner) Ready() error {
+	return nil
+}
+
+func (LocalRunner) Run(cmd string) (string, error) {
+	out, err := exec.Command("sh", "-c", cmd).CombinedOutput()
+	return string(out), err
+}
+
+// SSHRunner executes the commands on a remote node, like the airgap VM
+type SSHRunner struct {
+	Client *tools.Client
+}
+
+func (r SSHRunner) Ready() error {
+	_, err := r.Client.RunSSH("true")
+	return err
+}
+
+func (r SSHRunner) Run(cmd string) (string, error) {
+	return r.Client.RunSSH(cmd)
+}
+
+// Command is a command whose output is stored in the bundle
+type Command struct {
+	File string
+	Cmd  string
+}
+
+/*
+Get the commands collecting the default diagnostics
+  - @param kubewardenNamespace Namespace of the Kubewarden stack, depends on the install mode
+  - @param logNamespaces Other namespaces where all the pod logs are collected
+  - @returns Commands for pod logs, events, Kubewarden CRs, Helm values and policy-server config maps
+*/
+func DefaultCommands(kubewardenNamespace string, logNamespaces ...string) []Command {
+	cmds := []Command{
+		{File: "pods.txt", Cmd: "kubectl get pods -A -o wide"},
+		{File: "events.txt", Cmd: "kubectl get events -A --sort-by=.lastTimestamp"},
+		{
+			File: "kubewarden-resources.yaml",
+			Cmd:  "kubectl get policyservers,admissionpolicies,clusteradmissionpolicies,admissionpolicygroups,clusteradmissionpolicygroups -A -o yaml",
+		},
+		{
+			File: "helm-values.yaml",
+			Cmd: "helm ls -A --no-headers | while read name ns _; do " +
+				"echo \"# $ns/$name\"; helm get values -a -n \"$ns\" \"$name\"; done",
+		},
+		{
+			File: "policy-server-configmaps.yaml",
+			Cmd: "kubectl get cm -n " + kubewardenNamespace + " -o name | grep '/policy-server-' | " +
+				"xargs -r kubectl get -n " + kubewardenNamespace + " -o yaml",
+		},
+	}
+
+	for _, ns := range append([]string{kubewardenNamespace}, logNamespaces...) {
+		cmds = append(cmds, Command{
+			File: "logs-" + ns + ".txt",
+			Cmd: "for pod in $(kubectl get pods -n " + ns + " -o name); do " +
+				"echo \"### $pod\"; kubectl logs -n " + ns + " \"$pod\" --all-containers --prefix --tail=-1; done",
+		})
+	}
+
+	return cmds
+}
+
+// Bundle is a set of files collected after a failure
+type Bundle struct {
+	Files map[string][]byte
+	// Keep the order of the commands in the tarball
+	order []string
+}
+
+func (b *Bundle) add(name string, data []byte) {
+	if b.Files == nil {
+		b.Files = map[string][]byte{}
+	}
+	if _, ok := b.Files[name]; !ok {
+		b.order = append(b.order, name)
+	}
+	b.Files[name] = data
+}
+
+/*
+Collect the diagnostics
+  - @param r Runner executing the commands
+  - @param cmds Commands to execute
+  - @returns The bundle, command errors are written in the bundle instead of being returned
+*/
+func Collect(r Runner, cmds []Command) *Bundle {
+	b := &Bundle{}
+
+	if err := r.Ready(); err != nil {
+		b.add("errors.txt", []byte(fmt.Sprintf("runner not ready: %v\n", err)))
+		return b
+	}
+
+	var errs strings.Builder
+	for _, c := range cmds {
+		out, err := r.Run(c.Cmd)
+		if err != nil {
+			fmt.Fprintf(&errs, "%s: %q failed: %v\n", c.File, c.Cmd, err)
+		}
+		b.add(c.File, []byte(out))
+	}
+
+	if errs.Len() > 0 {
+		b.add("errors.txt", []byte(errs.String()))
+	}
+
+	return b
+}
+
+/*
+Write the bundle as a gzipped tarball
+  - @param path Destination file
+  - @returns Nothing or an error
+*/
+func (b *Bundle) WriteTarball(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	for _, name := range b.order {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(b.Files[name])),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(b.Files[name]); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+/*
+Get the file name of the bundle of a spec
+  - @param specText Full text of the spec
+  - @returns A file name usable on any filesystem
+*/
+func FileName(specText string) string {
+	name := strings.Trim(unsafeChars.ReplaceAllString(specText, "-"), "-")
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	return "diagnostics-" + name + "-" + time.Now().Format("20060102-150405") + ".tar.gz"
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// fakeRunner returns the output of each command, and fails for the ones in errs
+type fakeRunner struct {
+	notReady error
+	outputs  map[string]string
+	errs     map[string]error
+	cmds     []string
+}
+
+func (r *fakeRunner) Ready() error { return r.notReady }
+
+func (r *fakeRunner) Run(cmd string) (string, error) {
+	r.cmds = append(r.cmds, cmd)
+	return r.outputs[cmd], r.errs[cmd]
+}
+
+// readTarball returns the names of the files, in order, and their content
+func readTarball(t *testing.T, path string) ([]string, map[string]string) {
+	g := NewWithT(t)
+
+	f, err := os.Open(path)
+	g.Expect(err).ToNot(HaveOccurred())
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	g.Expect(err).ToNot(HaveOccurred())
+	tr := tar.NewReader(gz)
+
+	names := []string{}
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		g.Expect(err).ToNot(HaveOccurred())
+		data, err := io.ReadAll(tr)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(hdr.Mode).To(BeEquivalentTo(0644))
+		names = append(names, hdr.Name)
+		files[hdr.Name] = string(data)
+	}
+	return names, files
+}
+
+func TestCollect(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &fakeRunner{
+		outputs: map[string]string{
+			"kubectl get pods -A": "NAME READY\n",
+			"kubectl get events":  "error: the server could not find the requested resource\n",
+		},
+		errs: map[string]error{"kubectl get events": errors.New("exit status 1")},
+	}
+	b := Collect(r, []Command{
+		{File: "pods.txt", Cmd: "kubectl get pods -A"},
+		{File: "events.txt", Cmd: "kubectl get events"},
+		{File: "empty.txt", Cmd: "true"},
+	})
+
+	g.Expect(r.cmds).To(Equal([]string{"kubectl get pods -A", "kubectl get events", "true"}))
+	g.Expect(b.Files).To(HaveLen(4))
+	g.Expect(string(b.Files["pods.txt"])).To(Equal("NAME READY\n"))
+	// The output of a failed command is kept
+	g.Expect(string(b.Files["events.txt"])).To(ContainSubstring("could not find"))
+	g.Expect(string(b.Files["errors.txt"])).To(Equal("events.txt: \"kubectl get events\" failed: exit status 1\n"))
+
+	file := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	g.Expect(b.WriteTarball(file)).To(Succeed())
+	names, files := readTarball(t, file)
+	g.Expect(names).To(Equal([]string{"pods.txt", "events.txt", "empty.txt", "errors.txt"}))
+	g.Expect(files["pods.txt"]).To(Equal("NAME READY\n"))
+	g.Expect(files["empty.txt"]).To(BeEmpty())
+
+	g.Expect(b.WriteTarball(filepath.Join(t.TempDir(), "missing", "bundle.tar.gz"))).ToNot(Succeed())
+}
+
+func TestCollectNotReady(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &fakeRunner{notReady: errors.New("ssh: connection refused")}
+	b := Collect(r, DefaultCommands("kubewarden"))
+
+	g.Expect(r.cmds).To(BeEmpty())
+	g.Expect(b.Files).To(HaveLen(1))
+	g.Expect(string(b.Files["errors.txt"])).To(Equal("runner not ready: ssh: connection refused\n"))
+
+	file := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	g.Expect(b.WriteTarball(file)).To(Succeed())
+	names, _ := readTarball(t, file)
+	g.Expect(names).To(Equal([]string{"errors.txt"}))
+}
+
+func TestDefaultCommands(t *testing.T) {
+	g := NewWithT(t)
+
+	files := []string{}
+	cmds := map[string]string{}
+	for _, c := range DefaultCommands("cattle-kubewarden-system", "cattle-resources-system") {
+		files = append(files, c.File)
+		cmds[c.File] = c.Cmd
+	}
+	g.Expect(files).To(ContainElements("pods.txt", "events.txt", "kubewarden-resources.yaml", "helm-values.yaml"))
+	g.Expect(files).To(ContainElements("logs-cattle-kubewarden-system.txt", "logs-cattle-resources-system.txt"))
+	g.Expect(files).ToNot(ContainElement("logs-kubewarden.txt"))
+	g.Expect(cmds["policy-server-configmaps.yaml"]).To(ContainSubstring("kubectl get cm -n cattle-kubewarden-system "))
+	g.Expect(cmds["policy-server-configmaps.yaml"]).To(ContainSubstring("kubectl get -n cattle-kubewarden-system -o yaml"))
+}
+
+func TestFileName(t *testing.T) {
+	g := NewWithT(t)
+
+	name := FileName("Airgap: deploy [airgap-rancher] with spaces/slashes")
+	g.Expect(name).To(MatchRegexp(`^diagnostics-Airgap-deploy-airgap-rancher-with-spaces-slashes-\d{8}-\d{6}\.tar\.gz$`))
+
+	name = FileName(strings.Repeat("a", 200))
+	g.Expect(name).To(HavePrefix("diagnostics-" + strings.Repeat("a", 100) + "-"))
+	g.Expect(name).ToNot(ContainSubstring(strings.Repeat("a", 101)))
+}
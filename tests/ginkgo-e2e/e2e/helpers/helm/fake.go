@@ -0,0 +1,86 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"io"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// Fake keeps the releases in memory, for the unit tests of the helpers using helm
+type Fake struct {
+	// Releases of all the namespaces
+	Releases *storage.Storage
+	// Logins made, e.g. "user@dp.apps.rancher.io"
+	Logins []string
+	// Errors returned in order by the next actions, before they succeed again
+	Errors []error
+}
+
+/*
+Create a Helm client without cluster
+  - @returns The client, with short retry timings, and its fake
+*/
+func NewFake() (*Client, *Fake) {
+	mem := driver.NewMemory()
+	f := &Fake{Releases: storage.Init(mem)}
+
+	c := &Client{
+		RetryTimeout:  time.Second,
+		RetryInterval: 10 * time.Millisecond,
+		settings:      cli.New(),
+	}
+	c.configure = func(namespace string) (*action.Configuration, error) {
+		if err := f.next(); err != nil {
+			return nil, err
+		}
+
+		mem.SetNamespace(namespace)
+		return &action.Configuration{
+			Releases:     f.Releases,
+			KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+			Capabilities: chartutil.DefaultCapabilities,
+			Log:          discard,
+		}, nil
+	}
+	c.login = func(host, username, _ string) error {
+		if err := f.next(); err != nil {
+			return err
+		}
+
+		f.Logins = append(f.Logins, username+"@"+host)
+		return nil
+	}
+
+	return c, f
+}
+
+// next pops the next error to return, if any
+func (f *Fake) next() error {
+	if len(f.Errors) == 0 {
+		return nil
+	}
+
+	err := f.Errors[0]
+	f.Errors = f.Errors[1:]
+	return err
+}
@@ -0,0 +1,658 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Release is a Helm release, with the fields of the JSON output of helm
+type Release struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Revision  int    `json:"version"`
+	Info      Info   `json:"info"`
+	Chart     struct {
+		Metadata ChartMetadata `json:"metadata"`
+	} `json:"chart"`
+	// Values set by the user, see Client.Values for the computed ones
+	Config   map[string]any `json:"config"`
+	Manifest string         `json:"manifest"`
+	Hooks    []Hook         `json:"hooks"`
+}
+
+// Info is the status of a release revision
+type Info struct {
+	Status       string    `json:"status"`
+	Description  string    `json:"description"`
+	Notes        string    `json:"notes"`
+	LastDeployed time.Time `json:"last_deployed"`
+}
+
+// ChartMetadata identifies the chart of a release
+type ChartMetadata struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	AppVersion string `json:"appVersion"`
+}
+
+// Hook is a chart hook and the result of its last run
+type Hook struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"`
+	Path     string   `json:"path"`
+	Manifest string   `json:"manifest"`
+	Events   []string `json:"events"`
+	LastRun  struct {
+		StartedAt   time.Time `json:"started_at"`
+		CompletedAt time.Time `json:"completed_at"`
+		Phase       string    `json:"phase"`
+	} `json:"last_run"`
+}
+
+// Deployed returns true if the release revision is deployed
+func (r *Release) Deployed() bool {
+	return r.Info.Status == "deployed"
+}
+
+// FailedHooks returns the hooks whose last run failed
+func (r *Release) FailedHooks() []Hook {
+	failed := []Hook{}
+	for _, h := range r.Hooks {
+		if h.LastRun.Phase == "Failed" {
+			failed = append(failed, h)
+		}
+	}
+	return failed
+}
+
+/*
+Convert a release of the Helm SDK
+  - @param r Release returned by an action
+  - @returns The release
+*/
+func fromRelease(r *release.Release) *Release {
+	rel := &Release{
+		Name:      r.Name,
+		Namespace: r.Namespace,
+		Revision:  r.Version,
+		Config:    r.Config,
+		Manifest:  r.Manifest,
+		Hooks:     []Hook{},
+	}
+	if r.Info != nil {
+		rel.Info = Info{
+			Status:       r.Info.Status.String(),
+			Description:  r.Info.Description,
+			Notes:        r.Info.Notes,
+			LastDeployed: r.Info.LastDeployed.Time,
+		}
+	}
+	if r.Chart != nil && r.Chart.Metadata != nil {
+		rel.Chart.Metadata = ChartMetadata{
+			Name:       r.Chart.Metadata.Name,
+			Version:    r.Chart.Metadata.Version,
+			AppVersion: r.Chart.Metadata.AppVersion,
+		}
+	}
+
+	for _, h := range r.Hooks {
+		hook := Hook{Name: h.Name, Kind: h.Kind, Path: h.Path, Manifest: h.Manifest}
+		for _, e := range h.Events {
+			hook.Events = append(hook.Events, e.String())
+		}
+		hook.LastRun.StartedAt = h.LastRun.StartedAt.Time
+		hook.LastRun.CompletedAt = h.LastRun.CompletedAt.Time
+		hook.LastRun.Phase = h.LastRun.Phase.String()
+		rel.Hooks = append(rel.Hooks, hook)
+	}
+
+	return rel
+}
+
+// Options are the chart options of an install or upgrade
+type Options struct {
+	// Chart reference: repo/chart, oci:// URL, URL or path
+	Chart     string
+	Version   string
+	Namespace string
+	// Values as given to --set, in order
+	Set []string
+	// Values read from files, as given to --set-file, e.g. certificates
+	SetFile []string
+	// Install the release if it does not exist, upgrade only
+	Install bool
+	// Keep the values of the current revision, upgrade only
+	ReuseValues     bool
+	CreateNamespace bool
+	// Wait for the resources and the jobs to be ready
+	Wait      bool
+	PlainHTTP bool
+	Devel     bool
+	// 5 minutes if not set, like helm
+	Timeout time.Duration
+	// CA of the chart registry, for a TLS registry with a private CA
+	CAFile string
+}
+
+// Default timeout of the actions, the one of helm
+const defaultTimeout = 5 * time.Minute
+
+func (o Options) timeout() time.Duration {
+	if o.Timeout > 0 {
+		return o.Timeout
+	}
+	return defaultTimeout
+}
+
+// chartPathOptions returns the options locating the chart
+func (o Options) chartPathOptions() action.ChartPathOptions {
+	opts := action.ChartPathOptions{Version: o.Version, CaFile: o.CAFile, PlainHTTP: o.PlainHTTP}
+	if opts.Version == "" && o.Devel {
+		opts.Version = ">0.0.0-0"
+	}
+	return opts
+}
+
+// Client runs helm actions against the cluster of KUBECONFIG
+type Client struct {
+	// Time during which transient errors are retried
+	RetryTimeout  time.Duration
+	RetryInterval time.Duration
+
+	// Configuration of the actions in a namespace, see Fake for a client without cluster
+	configure func(namespace string) (*action.Configuration, error)
+	// Logs in to a chart registry
+	login func(host, username, password string) error
+	// Repositories, registry credentials and caches, from the HELM_* variables like helm
+	settings *cli.EnvSettings
+}
+
+/*
+Create a Helm client
+  - @returns The client for the cluster of KUBECONFIG, with the default retry timings
+*/
+func New() *Client {
+	c := &Client{
+		RetryTimeout:  2 * time.Minute,
+		RetryInterval: 20 * time.Second,
+		settings:      cli.New(),
+	}
+	c.configure = c.configureCluster
+	c.login = c.loginRegistry
+	return c
+}
+
+// discard drops the debug logs of the actions
+func discard(string, ...any) {}
+
+// configureCluster is the configuration of the actions against the cluster of KUBECONFIG
+func (c *Client) configureCluster(namespace string) (*action.Configuration, error) {
+	// Read KUBECONFIG again, it can change during a spec
+	settings := cli.New()
+	settings.SetNamespace(namespace)
+
+	cfg := &action.Configuration{}
+	if err := cfg.Init(settings.RESTClientGetter(), namespace, os.Getenv("HELM_DRIVER"), discard); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loginRegistry logs in with the registry client of Helm, the credentials are stored like with helm
+func (c *Client) loginRegistry(host, username, password string) error {
+	rc, err := registry.NewClient(
+		registry.ClientOptWriter(io.Discard),
+		registry.ClientOptCredentialsFile(c.settings.RegistryConfig),
+	)
+	if err != nil {
+		return err
+	}
+	return rc.Login(host, registry.LoginOptBasicAuth(username, password))
+}
+
+// registryClient returns a client for the chart registry of the options
+func (c *Client) registryClient(opts Options) (*registry.Client, error) {
+	if opts.CAFile != "" {
+		return registry.NewRegistryClientWithTLS(io.Discard, "", "", opts.CAFile, false, c.settings.RegistryConfig, false)
+	}
+
+	options := []registry.ClientOption{
+		registry.ClientOptEnableCache(true),
+		registry.ClientOptWriter(io.Discard),
+		registry.ClientOptCredentialsFile(c.settings.RegistryConfig),
+	}
+	if opts.PlainHTTP {
+		options = append(options, registry.ClientOptPlainHTTP())
+	}
+	return registry.NewClient(options...)
+}
+
+// actionConfig returns the configuration of the actions on a chart
+func (c *Client) actionConfig(opts Options) (*action.Configuration, error) {
+	cfg, err := c.configure(opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RegistryClient, err = c.registryClient(opts); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// retry runs an action, the transient errors are retried
+func (c *Client) retry(ctx context.Context, args []string, run func(ctx context.Context) error) error {
+	var last error
+
+	err := wait.PollUntilContextTimeout(ctx, c.RetryInterval, c.RetryTimeout, true, func(ctx context.Context) (bool, error) {
+		err := run(ctx)
+		if err == nil {
+			return true, nil
+		}
+
+		last = newError(args, err)
+		if !IsTransient(last) {
+			return false, last
+		}
+		return false, nil
+	})
+	if err != nil && last != nil {
+		return last
+	}
+	return err
+}
+
+// chart loads the chart of the options, with its values
+func (c *Client) chart(p action.ChartPathOptions, opts Options) (*chartAndValues, error) {
+	chartPath, err := p.LocateChart(opts.Chart, c.settings)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	if req := ch.Metadata.Dependencies; req != nil {
+		if err := action.CheckDependencies(ch, req); err != nil {
+			return nil, err
+		}
+	}
+
+	vals, err := (&values.Options{Values: opts.Set, FileValues: opts.SetFile}).MergeValues(getter.All(c.settings))
+	if err != nil {
+		return nil, err
+	}
+	return &chartAndValues{chart: ch, values: vals}, nil
+}
+
+type chartAndValues struct {
+	chart  *chart.Chart
+	values map[string]any
+}
+
+/*
+Install a release
+  - @param name Name of the release
+  - @param opts Chart options
+  - @returns The installed release or an error
+*/
+func (c *Client) Install(ctx context.Context, name string, opts Options) (*Release, error) {
+	var rel *release.Release
+
+	err := c.retry(ctx, []string{"install", name, opts.Chart}, func(ctx context.Context) error {
+		cfg, err := c.actionConfig(opts)
+		if err != nil {
+			return err
+		}
+
+		rel, err = c.install(ctx, cfg, name, opts, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromRelease(rel), nil
+}
+
+// install runs the install action, replace reuses the name of an uninstalled release
+func (c *Client) install(ctx context.Context, cfg *action.Configuration, name string, opts Options, replace bool) (*release.Release, error) {
+	i := action.NewInstall(cfg)
+	i.ChartPathOptions = opts.chartPathOptions()
+	i.SetRegistryClient(cfg.RegistryClient)
+	i.ReleaseName = name
+	i.Namespace = opts.Namespace
+	i.CreateNamespace = opts.CreateNamespace
+	i.Wait = opts.Wait
+	i.WaitForJobs = opts.Wait
+	i.Timeout = opts.timeout()
+	i.Replace = replace
+
+	cv, err := c.chart(i.ChartPathOptions, opts)
+	if err != nil {
+		return nil, err
+	}
+	return i.RunWithContext(ctx, cv.chart, cv.values)
+}
+
+/*
+Upgrade a release
+  - @param name Name of the release
+  - @param opts Chart options, set Install to install the release if needed
+  - @returns The new revision of the release or an error
+*/
+func (c *Client) Upgrade(ctx context.Context, name string, opts Options) (*Release, error) {
+	var rel *release.Release
+
+	err := c.retry(ctx, []string{"upgrade", name, opts.Chart}, func(ctx context.Context) error {
+		cfg, err := c.actionConfig(opts)
+		if err != nil {
+			return err
+		}
+
+		// Install the release if it does not exist, like "helm upgrade --install"
+		if opts.Install {
+			h := action.NewHistory(cfg)
+			h.Max = 1
+			revisions, err := h.Run(name)
+			uninstalled := len(revisions) > 0 && revisions[len(revisions)-1].Info.Status == release.StatusUninstalled
+			if errors.Is(err, driver.ErrReleaseNotFound) || uninstalled {
+				rel, err = c.install(ctx, cfg, name, opts, uninstalled)
+				return err
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		u := action.NewUpgrade(cfg)
+		u.ChartPathOptions = opts.chartPathOptions()
+		u.SetRegistryClient(cfg.RegistryClient)
+		u.Namespace = opts.Namespace
+		u.ReuseValues = opts.ReuseValues
+		u.Wait = opts.Wait
+		u.WaitForJobs = opts.Wait
+		u.Timeout = opts.timeout()
+
+		cv, err := c.chart(u.ChartPathOptions, opts)
+		if err != nil {
+			return err
+		}
+		rel, err = u.RunWithContext(ctx, name, cv.chart, cv.values)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromRelease(rel), nil
+}
+
+/*
+Roll a release back
+  - @param name Name of the release
+  - @param namespace Namespace of the release
+  - @param revision Revision to roll back to, 0 for the previous one
+  - @returns The new revision of the release or an error
+*/
+func (c *Client) Rollback(ctx context.Context, name, namespace string, revision int) (*Release, error) {
+	err := c.retry(ctx, []string{"rollback", name}, func(context.Context) error {
+		cfg, err := c.configure(namespace)
+		if err != nil {
+			return err
+		}
+
+		r := action.NewRollback(cfg)
+		r.Version = revision
+		r.Wait = true
+		r.WaitForJobs = true
+		r.Timeout = defaultTimeout
+		return r.Run(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Get(ctx, name, namespace)
+}
+
+/*
+Uninstall a release
+  - @param name Name of the release
+  - @param namespace Namespace of the release
+  - @returns Nothing or an error
+*/
+func (c *Client) Uninstall(ctx context.Context, name, namespace string) error {
+	return c.retry(ctx, []string{"uninstall", name}, func(context.Context) error {
+		cfg, err := c.configure(namespace)
+		if err != nil {
+			return err
+		}
+
+		u := action.NewUninstall(cfg)
+		u.Wait = true
+		u.Timeout = defaultTimeout
+		_, err = u.Run(name)
+		return err
+	})
+}
+
+/*
+Get the current revision of a release
+  - @param name Name of the release
+  - @param namespace Namespace of the release
+  - @returns The release with its manifest and hooks, or an error
+*/
+func (c *Client) Get(ctx context.Context, name, namespace string) (*Release, error) {
+	var rel *release.Release
+
+	err := c.retry(ctx, []string{"status", name}, func(context.Context) error {
+		cfg, err := c.configure(namespace)
+		if err != nil {
+			return err
+		}
+
+		rel, err = action.NewStatus(cfg).Run(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromRelease(rel), nil
+}
+
+/*
+Get the values of a release
+  - @param name Name of the release
+  - @param namespace Namespace of the release
+  - @param all Return the computed values (chart defaults included) instead of the user supplied ones
+  - @returns The values or an error
+*/
+func (c *Client) Values(ctx context.Context, name, namespace string, all bool) (map[string]any, error) {
+	var vals map[string]any
+
+	err := c.retry(ctx, []string{"get", "values", name}, func(context.Context) error {
+		cfg, err := c.configure(namespace)
+		if err != nil {
+			return err
+		}
+
+		g := action.NewGetValues(cfg)
+		g.AllValues = all
+		vals, err = g.Run(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if vals == nil {
+		vals = map[string]any{}
+	}
+	return vals, nil
+}
+
+/*
+Add a chart repository and update the index
+  - @param name Name of the repository
+  - @param url URL of the repository
+  - @returns Nothing or an error
+*/
+func (c *Client) AddRepo(ctx context.Context, name, url string) error {
+	return c.retry(ctx, []string{"repo", "add", name, url}, func(context.Context) error {
+		entry := &repo.Entry{Name: name, URL: url}
+		r, err := repo.NewChartRepository(entry, getter.All(c.settings))
+		if err != nil {
+			return err
+		}
+		r.CachePath = c.settings.RepositoryCache
+		if _, err := r.DownloadIndexFile(); err != nil {
+			return err
+		}
+
+		// Replace the entry of the repository, like --force-update
+		f, err := repo.LoadFile(c.settings.RepositoryConfig)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if len(f.Repositories) == 0 {
+			f = repo.NewFile()
+		}
+		f.Update(entry)
+
+		if err := os.MkdirAll(filepath.Dir(c.settings.RepositoryConfig), 0755); err != nil {
+			return err
+		}
+		return f.WriteFile(c.settings.RepositoryConfig, 0600)
+	})
+}
+
+/*
+Download a chart and extract it
+  - @param chart Chart reference: repo/chart or oci:// URL
+  - @param version Chart version, the latest one if empty
+  - @param dir Directory receiving the chart
+  - @returns The directory of the extracted chart or an error
+*/
+func (c *Client) Pull(ctx context.Context, chart, version, dir string) (string, error) {
+	err := c.retry(ctx, []string{"pull", chart}, func(context.Context) error {
+		cfg := &action.Configuration{}
+		var err error
+		if cfg.RegistryClient, err = c.registryClient(Options{}); err != nil {
+			return err
+		}
+
+		p := action.NewPullWithOpts(action.WithConfig(cfg))
+		p.Settings = c.settings
+		p.Version = version
+		p.Untar = true
+		p.UntarDir = dir
+		p.DestDir = dir
+		_, err = p.Run(chart)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, path.Base(chart)), nil
+}
+
+/*
+Log in to an OCI registry hosting charts
+  - @param host Registry host
+  - @param username User name
+  - @param password Password, never passed on a command line nor returned in the errors
+  - @returns Nothing or an error
+*/
+func (c *Client) RegistryLogin(ctx context.Context, host, username, password string) error {
+	return c.retry(ctx, []string{"registry", "login", host, "--username", username}, func(context.Context) error {
+		return c.login(host, username, password)
+	})
+}
+
+// Error is a failed helm action
+type Error struct {
+	// Action and its main arguments, as for the helm command
+	Args []string
+	Err  error
+}
+
+func newError(args []string, err error) *Error {
+	return &Error{Args: append([]string{}, args...), Err: err}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("helm %s failed: %v", strings.Join(e.Args, " "), e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Messages of the errors worth a retry: network, API server or webhooks not ready yet, concurrent operation.
+// A DNS failure ("no such host") is not retried, it is most likely a wrong URL.
+var transientMessages = []string{
+	"connection refused",
+	"connection reset by peer",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"unexpected EOF",
+	"Kubernetes cluster unreachable",
+	"the server is currently unable to handle the request",
+	"etcdserver: request timed out",
+	"failed calling webhook",
+	"another operation (install/upgrade/rollback) is in progress",
+	"429 Too Many Requests",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+}
+
+/*
+Check if a helm failure is worth a retry
+  - @param err Error returned by the client
+  - @returns true for network and availability errors, false for errors in the chart or the values
+*/
+func IsTransient(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) || e.Err == nil {
+		return false
+	}
+
+	for _, msg := range transientMessages {
+		if strings.Contains(e.Err.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
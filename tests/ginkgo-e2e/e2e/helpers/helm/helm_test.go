@@ -0,0 +1,257 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/repo"
+	helmtime "helm.sh/helm/v3/pkg/time"
+)
+
+const configMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}
+data:
+  policyReporter: {{ .Values.auditScanner.policyReporter | quote }}
+`
+
+/*
+Package a minimal chart
+  - @param dir Directory receiving the archive
+  - @param name Name of the chart
+  - @param version Version of the chart
+  - @returns The path of the archive
+*/
+func saveChart(t *testing.T, dir, name, version string) string {
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: version, AppVersion: "v" + version},
+		Values:   map[string]any{"auditScanner": map[string]any{"policyReporter": false}},
+		Templates: []*chart.File{
+			{Name: "templates/configmap.yaml", Data: []byte(configMap)},
+		},
+		Raw: []*chart.File{
+			{Name: chartutil.ValuesfileName, Data: []byte("auditScanner:\n  policyReporter: false\n")},
+		},
+	}
+
+	path, err := chartutil.Save(ch, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUpgrade(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	c, _ := NewFake()
+	r, err := c.Upgrade(ctx, "kubewarden-controller", Options{
+		Chart:           saveChart(t, dir, "kubewarden-controller", "5.3.0"),
+		Namespace:       "kubewarden",
+		Set:             []string{"auditScanner.policyReporter=true"},
+		Install:         true,
+		CreateNamespace: true,
+		Wait:            true,
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	g.Expect(r.Deployed()).To(BeTrue())
+	g.Expect(r.Namespace).To(Equal("kubewarden"))
+	g.Expect(r.Revision).To(Equal(1))
+	g.Expect(r.Chart.Metadata.AppVersion).To(Equal("v5.3.0"))
+	g.Expect(r.Config).To(HaveKeyWithValue("auditScanner", HaveKeyWithValue("policyReporter", true)))
+	g.Expect(r.Manifest).To(ContainSubstring(`policyReporter: "true"`))
+
+	// Upgrade of the existing release, without values the previous ones are kept like with helm
+	r, err = c.Upgrade(ctx, "kubewarden-controller", Options{
+		Chart:     saveChart(t, dir, "kubewarden-controller", "5.4.0"),
+		Namespace: "kubewarden",
+		Install:   true,
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(r.Revision).To(Equal(2))
+	g.Expect(r.Chart.Metadata.Version).To(Equal("5.4.0"))
+
+	values, err := c.Values(ctx, "kubewarden-controller", "kubewarden", false)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(values).To(Equal(map[string]any{"auditScanner": map[string]any{"policyReporter": true}}))
+	g.Expect(r.Manifest).To(ContainSubstring(`policyReporter: "true"`))
+
+	// Computed values include the chart defaults
+	r, err = c.Upgrade(ctx, "kubewarden-controller", Options{
+		Chart:     saveChart(t, dir, "kubewarden-controller", "5.4.0"),
+		Namespace: "kubewarden",
+		Set:       []string{"image.tag=v1.34.0"},
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(r.Revision).To(Equal(3))
+	values, err = c.Values(ctx, "kubewarden-controller", "kubewarden", true)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(values).To(HaveKeyWithValue("auditScanner", HaveKeyWithValue("policyReporter", false)))
+	g.Expect(values).To(HaveKeyWithValue("image", HaveKeyWithValue("tag", "v1.34.0")))
+
+	r, err = c.Rollback(ctx, "kubewarden-controller", "kubewarden", 1)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(r.Revision).To(Equal(4))
+	g.Expect(r.Chart.Metadata.Version).To(Equal("5.3.0"))
+	g.Expect(r.Manifest).To(ContainSubstring(`policyReporter: "true"`))
+
+	// Releases are namespaced
+	_, err = c.Get(ctx, "kubewarden-controller", "default")
+	g.Expect(err).To(MatchError(ContainSubstring("release: not found")))
+
+	g.Expect(c.Uninstall(ctx, "kubewarden-controller", "kubewarden")).To(Succeed())
+	_, err = c.Get(ctx, "kubewarden-controller", "kubewarden")
+	g.Expect(err).To(MatchError(ContainSubstring("release: not found")))
+	g.Expect(IsTransient(err)).To(BeFalse())
+}
+
+func TestFromRelease(t *testing.T) {
+	g := NewWithT(t)
+
+	r := fromRelease(&release.Release{
+		Name:      "kubewarden-controller",
+		Namespace: "kubewarden",
+		Version:   2,
+		Info:      &release.Info{Status: release.StatusFailed, Description: "Upgrade failed", LastDeployed: helmtime.Now()},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "kubewarden-controller", Version: "5.3.0"}},
+		Hooks: []*release.Hook{
+			{Name: "pre-delete", Kind: "Job", Events: []release.HookEvent{release.HookPreDelete}, LastRun: release.HookExecution{Phase: release.HookPhaseSucceeded}},
+			{Name: "post-upgrade", Kind: "Job", Events: []release.HookEvent{release.HookPostUpgrade}, LastRun: release.HookExecution{Phase: release.HookPhaseFailed}},
+		},
+	})
+
+	g.Expect(r.Deployed()).To(BeFalse())
+	g.Expect(r.Info.Status).To(Equal("failed"))
+	g.Expect(r.Info.Description).To(Equal("Upgrade failed"))
+	g.Expect(r.Chart.Metadata.Version).To(Equal("5.3.0"))
+	g.Expect(r.FailedHooks()).To(HaveLen(1))
+	g.Expect(r.FailedHooks()[0].Name).To(Equal("post-upgrade"))
+	g.Expect(r.FailedHooks()[0].Events).To(Equal([]string{"post-upgrade"}))
+}
+
+func TestTransientErrorsAreRetried(t *testing.T) {
+	g := NewWithT(t)
+
+	c, f := NewFake()
+	f.Errors = []error{errors.New("Kubernetes cluster unreachable: dial tcp 127.0.0.1:6443: connect: connection refused")}
+
+	_, err := c.Install(context.Background(), "kubewarden-controller", Options{
+		Chart:     saveChart(t, t.TempDir(), "kubewarden-controller", "5.3.0"),
+		Namespace: "kubewarden",
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(f.Errors).To(BeEmpty())
+}
+
+func TestPermanentErrorsAreNotRetried(t *testing.T) {
+	g := NewWithT(t)
+
+	for _, msg := range []string{
+		"values don't meet the specifications of the schema(s): auditScanner: Additional property foo is not allowed",
+		// Most likely a wrong URL
+		"dial tcp: lookup charts.kubewarden.example: no such host",
+	} {
+		c, f := NewFake()
+		f.Errors = []error{errors.New(msg), errors.New(msg)}
+
+		_, err := c.Upgrade(context.Background(), "kubewarden-controller", Options{Chart: "kubewarden/kubewarden-controller", Namespace: "kubewarden"})
+		g.Expect(err).To(MatchError(ContainSubstring(msg)))
+		g.Expect(err).To(MatchError(HavePrefix("helm upgrade kubewarden-controller kubewarden/kubewarden-controller failed")))
+		g.Expect(IsTransient(err)).To(BeFalse())
+		g.Expect(f.Errors).To(HaveLen(1))
+	}
+}
+
+func TestTransientErrorTimeout(t *testing.T) {
+	g := NewWithT(t)
+
+	c, f := NewFake()
+	c.RetryTimeout = 100 * time.Millisecond
+	for range 100 {
+		f.Errors = append(f.Errors, errors.New("503 Service Unavailable"))
+	}
+
+	err := c.Uninstall(context.Background(), "kubewarden-controller", "kubewarden")
+	g.Expect(err).To(MatchError(ContainSubstring("503 Service Unavailable")))
+	g.Expect(IsTransient(err)).To(BeTrue())
+	g.Expect(len(f.Errors)).To(BeNumerically("<", 99))
+}
+
+func TestRegistryLogin(t *testing.T) {
+	g := NewWithT(t)
+
+	c, f := NewFake()
+	g.Expect(c.RegistryLogin(context.Background(), "dp.apps.rancher.io", "user", "s3cr3t")).To(Succeed())
+	g.Expect(f.Logins).To(Equal([]string{"user@dp.apps.rancher.io"}))
+
+	// The password is not in the errors
+	f.Errors = []error{errors.New("login attempt to https://dp.apps.rancher.io/v2/ failed with status: 401 Unauthorized")}
+	err := c.RegistryLogin(context.Background(), "dp.apps.rancher.io", "user", "s3cr3t")
+	g.Expect(err).To(MatchError(ContainSubstring("helm registry login dp.apps.rancher.io --username user failed")))
+	g.Expect(err.Error()).To(Not(ContainSubstring("s3cr3t")))
+}
+
+func TestAddRepoAndPull(t *testing.T) {
+	g := NewWithT(t)
+
+	home := t.TempDir()
+	t.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(home, "config", "repositories.yaml"))
+	t.Setenv("HELM_REPOSITORY_CACHE", filepath.Join(home, "cache"))
+	t.Setenv("HELM_REGISTRY_CONFIG", filepath.Join(home, "config", "registry.json"))
+
+	// Chart repository serving a chart
+	charts := t.TempDir()
+	saveChart(t, charts, "admission-controller", "5.3.0")
+	srv := httptest.NewServer(http.FileServer(http.Dir(charts)))
+	defer srv.Close()
+
+	index, err := repo.IndexDirectory(charts, srv.URL)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(index.WriteFile(filepath.Join(charts, "index.yaml"), 0644)).To(Succeed())
+
+	c, _ := NewFake()
+	g.Expect(c.AddRepo(context.Background(), "kubewarden", srv.URL)).To(Succeed())
+	// Adding again updates the repository
+	g.Expect(c.AddRepo(context.Background(), "kubewarden", srv.URL)).To(Succeed())
+
+	repos, err := repo.LoadFile(filepath.Join(home, "config", "repositories.yaml"))
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(repos.Repositories).To(HaveLen(1))
+	g.Expect(repos.Get("kubewarden").URL).To(Equal(srv.URL))
+
+	dir, err := c.Pull(context.Background(), "kubewarden/admission-controller", "5.3.0", t.TempDir())
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(filepath.Base(dir)).To(Equal("admission-controller"))
+	g.Expect(filepath.Join(dir, "Chart.yaml")).To(BeAnExistingFile())
+
+	_, err = c.Pull(context.Background(), "kubewarden/admission-controller", "9.9.9", t.TempDir())
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(IsTransient(err)).To(BeFalse())
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Array index at the end of a key segment, e.g. insecureSources[0]
+var indexRegexp = regexp.MustCompile(`\[(\d+)\]$`)
+
+// splitKey splits a --set key on the dots which are not escaped
+func splitKey(key string) []string {
+	segments := []string{}
+	current := strings.Builder{}
+
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '\\' && i+1 < len(key) && key[i+1] == '.':
+			current.WriteByte('.')
+			i++
+		case key[i] == '.':
+			segments = append(segments, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(key[i])
+		}
+	}
+	return append(segments, current.String())
+}
+
+/*
+Look a value up with a --set key
+  - @param values Values of a release, as returned by Client.Values
+  - @param key Key in the --set syntax: dots between levels, [n] for list items, \. for a literal dot
+  - @returns The value and true if the key exists
+*/
+func Lookup(values map[string]any, key string) (any, bool) {
+	var current any = values
+
+	for _, segment := range splitKey(key) {
+		// Collect the indexes, innermost last
+		indexes := []int{}
+		for m := indexRegexp.FindStringSubmatch(segment); m != nil; m = indexRegexp.FindStringSubmatch(segment) {
+			n, _ := strconv.Atoi(m[1])
+			indexes = append([]int{n}, indexes...)
+			segment = strings.TrimSuffix(segment, m[0])
+		}
+
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[segment]; !ok {
+			return nil, false
+		}
+
+		for _, n := range indexes {
+			list, ok := current.([]any)
+			if !ok || n >= len(list) {
+				return nil, false
+			}
+			current = list[n]
+		}
+	}
+
+	return current, true
+}
+
+// format prints a value the way it is written with --set
+func format(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+/*
+Compare the values of a release with the --set overrides requested for it
+  - @param values Values of the release, computed ones (Client.Values with all) to catch values dropped by the chart
+  - @param set Overrides as given in Options.Set, one key per entry
+  - @returns A description of each override not reflected in the values, empty if they all are
+*/
+func DiffSet(values map[string]any, set []string) []string {
+	diffs := []string{}
+
+	for _, s := range set {
+		key, want, found := strings.Cut(s, "=")
+		if !found {
+			diffs = append(diffs, fmt.Sprintf("%s: not a key=value override", s))
+			continue
+		}
+
+		got, ok := Lookup(values, key)
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("%s: requested %q, not set in the release", key, want))
+		case format(got) != want:
+			diffs = append(diffs, fmt.Sprintf("%s: requested %q, got %q", key, want, format(got)))
+		}
+	}
+
+	return diffs
+}
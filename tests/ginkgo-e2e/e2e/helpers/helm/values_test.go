@@ -0,0 +1,85 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// Trimmed output of "helm get values -a -o json kubewarden-controller"
+const valuesJSON = `{
+  "auditScanner": {
+    "policyReporter": true,
+    "reportCRDsKind": "openreports",
+    "cronJob": {"schedule": "*/2 * * * *", "failedJobsHistoryLimit": 5}
+  },
+  "policyServer": {"insecureSources": ["rancher-manager.test:5000"]},
+  "podAnnotations": {"example.com/team": "security"}
+}`
+
+func loadValues(t *testing.T) map[string]any {
+	values := map[string]any{}
+	if err := json.Unmarshal([]byte(valuesJSON), &values); err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestLookup(t *testing.T) {
+	g := NewWithT(t)
+	values := loadValues(t)
+
+	v, ok := Lookup(values, "auditScanner.cronJob.schedule")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(v).To(Equal("*/2 * * * *"))
+
+	v, ok = Lookup(values, "policyServer.insecureSources[0]")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(v).To(Equal("rancher-manager.test:5000"))
+
+	v, ok = Lookup(values, `podAnnotations.example\.com/team`)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(v).To(Equal("security"))
+
+	_, ok = Lookup(values, "policyServer.insecureSources[1]")
+	g.Expect(ok).To(BeFalse())
+	_, ok = Lookup(values, "auditScanner.policyReporter.enabled")
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestDiffSet(t *testing.T) {
+	g := NewWithT(t)
+	values := loadValues(t)
+
+	g.Expect(DiffSet(values, []string{
+		"auditScanner.policyReporter=true",
+		"auditScanner.cronJob.schedule=*/2 * * * *",
+		"auditScanner.cronJob.failedJobsHistoryLimit=5",
+		"auditScanner.reportCRDsKind=openreports",
+	})).To(BeEmpty())
+
+	g.Expect(DiffSet(values, []string{
+		"auditScanner.reportCRDsKind=policyreport",
+		"auditScanner.image.tag=v1.33.0",
+		"recommendedPolicies.enabled",
+	})).To(Equal([]string{
+		`auditScanner.reportCRDsKind: requested "policyreport", got "openreports"`,
+		`auditScanner.image.tag: requested "v1.33.0", not set in the release`,
+		"recommendedPolicies.enabled: not a key=value override",
+	}))
+}
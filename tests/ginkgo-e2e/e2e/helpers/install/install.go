@@ -0,0 +1,187 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/common"
+	"github.com/rancher/elemental/tests/e2e/helpers/helm"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Names of the install modes, as set in INSTALL_MODE
+const (
+	ModeUpstream = "upstream"
+	ModeAppCo    = "appco"
+	ModeRancher  = "rancher"
+)
+
+// Names of the upstream charts, used as keys of Values
+const (
+	ChartCRDs       = "kubewarden-crds"
+	ChartController = "kubewarden-controller"
+	ChartDefaults   = "kubewarden-defaults"
+)
+
+// Values are the --set overrides of the stack, keyed by upstream chart name
+type Values map[string][]string
+
+// Chart is a Helm release to install or upgrade
+type Chart struct {
+	// Name of the Helm release
+	Release string
+	Options helm.Options
+}
+
+// Mode is a way of installing the Kubewarden stack
+type Mode interface {
+	// Name of the mode
+	Name() string
+	// Namespace the stack is installed into
+	Namespace() string
+	// Prepare creates what the charts need: namespace, pull secrets, registry logins, repositories
+	Prepare(ctx context.Context, cl client.Client, h *helm.Client) error
+	// Charts returns the releases to install or upgrade, in order, with the values translated for the mode
+	Charts(release *versions.Release, values Values) []Chart
+	// Install installs or upgrades one of the charts and returns the deployed release
+	Install(ctx context.Context, h *helm.Client, chart Chart) (*helm.Release, error)
+	// PolicyServerImage returns the policy-server image of the mode with the given tag
+	PolicyServerImage(tag string) string
+	// ImagePullSecret returns the secret needed to pull the images of the mode, empty if none
+	ImagePullSecret() string
+}
+
+// Options configures the modes, unused fields are ignored
+type Options struct {
+	// Namespace of the stack, kubewarden (cattle-kubewarden-system for Rancher) if not set
+	Namespace string
+	// Version of the AppCo chart, latest if not set
+	AppCoVersion string
+	// Credentials of the Application Collection
+	AppCoUsername string
+	AppCoPassword string
+	// Hostname of Rancher Manager, read from the values of the rancher release if not set
+	RancherHostname string
+	// Password of the Rancher admin user, sa (the bootstrap password of the scripts) if not set
+	RancherPassword string
+	// Directory holding the ClusterRepo manifests and the install requests (resources/rancher)
+	RancherResources string
+	// Timeout and interval of the waits of the AppCo and Rancher modes, 5 minutes and 5 seconds if not set
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+/*
+Create an install mode
+  - @param name Name of the mode: upstream (default), appco or rancher
+  - @param opts Options of the mode
+  - @returns The mode or an error
+*/
+func New(name string, opts Options) (Mode, error) {
+	if opts.Namespace == "" {
+		opts.Namespace = "kubewarden"
+		if name == ModeRancher {
+			opts.Namespace = rancherNamespace
+		}
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Minute
+	}
+	if opts.Interval == 0 {
+		opts.Interval = 5 * time.Second
+	}
+
+	switch name {
+	case "", ModeUpstream:
+		return &Upstream{opts: opts}, nil
+	case ModeAppCo:
+		if opts.AppCoUsername == "" || opts.AppCoPassword == "" {
+			return nil, fmt.Errorf("%s install mode requires the Application Collection credentials", ModeAppCo)
+		}
+		return &AppCo{opts: opts}, nil
+	case ModeRancher:
+		if opts.RancherResources == "" {
+			return nil, fmt.Errorf("%s install mode requires the directory of its resources", ModeRancher)
+		}
+		if opts.RancherPassword == "" {
+			opts.RancherPassword = "sa"
+		}
+		return &Rancher{opts: opts}, nil
+	}
+
+	return nil, fmt.Errorf("unknown install mode %q", name)
+}
+
+// createNamespace creates the namespace of the stack if needed
+func createNamespace(ctx context.Context, cl client.Client, name string) error {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if err := cl.Create(ctx, ns); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// poll calls check until it returns true, the last error is kept to explain a timeout
+func poll(ctx context.Context, opts Options, what string, check func(context.Context) (bool, error)) error {
+	return common.Poll(ctx, opts.Interval, opts.Timeout, what, check)
+}
+
+// helmInstall is the Install implementation of the modes using Helm directly
+func helmInstall(ctx context.Context, h *helm.Client, chart Chart) (*helm.Release, error) {
+	return h.Upgrade(ctx, chart.Release, chart.Options)
+}
+
+/*
+Create or update a docker-registry secret
+  - @param cl Client of the cluster
+  - @param namespace Namespace of the secret
+  - @param name Name of the secret
+  - @param server Registry host
+  - @param username User name
+  - @param password Password
+  - @returns Nothing or an error
+*/
+func ApplyPullSecret(ctx context.Context, cl client.Client, namespace, name, server, username, password string) error {
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	config, err := json.Marshal(map[string]any{
+		"auths": map[string]any{
+			server: map[string]string{"username": username, "password": password, "auth": auth},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: config},
+	}
+
+	err = cl.Create(ctx, secret)
+	if apierrors.IsAlreadyExists(err) {
+		return cl.Update(ctx, secret)
+	}
+	return err
+}
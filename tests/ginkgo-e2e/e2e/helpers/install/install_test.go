@@ -0,0 +1,168 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/helm"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var values = Values{
+	ChartController: {"auditScanner.policyReporter=true"},
+	ChartDefaults:   {"recommendedPolicies.enabled=true"},
+}
+
+// ssacPod returns a pod of the AppCo release
+func ssacPod(name string, ready corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kubewarden", Name: name, Labels: map[string]string{"app.kubernetes.io/instance": "ssac"}},
+		Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}}},
+	}
+}
+
+// saveChart packages an empty chart and returns its path
+func saveChart(t *testing.T, name string) string {
+	path, err := chartutil.Save(&chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: "0.5.1"},
+	}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNew(t *testing.T) {
+	g := NewWithT(t)
+
+	m, err := New("", Options{})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(m.Name()).To(Equal(ModeUpstream))
+	g.Expect(m.Namespace()).To(Equal("kubewarden"))
+
+	_, err = New(ModeAppCo, Options{})
+	g.Expect(err).To(MatchError(ContainSubstring("requires the Application Collection credentials")))
+
+	_, err = New("carrier-pigeon", Options{})
+	g.Expect(err).To(MatchError(ContainSubstring("unknown install mode")))
+}
+
+func TestUpstreamCharts(t *testing.T) {
+	g := NewWithT(t)
+
+	m, _ := New(ModeUpstream, Options{})
+	release := &versions.Release{
+		Charts:   versions.Charts{CRDs: "1.15.0", Controller: "5.3.0", Defaults: "3.3.0"},
+		Images:   versions.Images{Controller: "v1.33.0", PolicyServer: "v1.33.0", AuditScanner: "v1.33.0"},
+		Policies: map[string]string{"podPrivilegedPolicy": "v1.0.6"},
+	}
+
+	charts := m.Charts(release, values)
+	g.Expect(charts).To(HaveLen(3))
+	g.Expect(charts[0].Release).To(Equal(ChartCRDs))
+	g.Expect(charts[0].Options.Version).To(Equal("1.15.0"))
+	g.Expect(charts[1].Options.Chart).To(Equal("kubewarden/kubewarden-controller"))
+	g.Expect(charts[1].Options.Set).To(Equal([]string{
+		"auditScanner.policyReporter=true", "image.tag=v1.33.0", "auditScanner.image.tag=v1.33.0",
+	}))
+	g.Expect(charts[2].Options.Set).To(ContainElements(
+		"recommendedPolicies.enabled=true", "recommendedPolicies.podPrivilegedPolicy.module.tag=v1.0.6",
+	))
+
+	// The requested values are not modified
+	g.Expect(values[ChartController]).To(HaveLen(1))
+
+	// Only the set versions are pinned
+	charts = m.Charts(&versions.Release{Images: versions.Images{PolicyServer: "v1.33.1"}}, values)
+	g.Expect(charts[0].Options.Version).To(BeEmpty())
+	g.Expect(charts[1].Options.Set).To(Equal([]string{"auditScanner.policyReporter=true"}))
+	g.Expect(charts[2].Options.Set).To(Equal([]string{"recommendedPolicies.enabled=true", "policyServer.image.tag=v1.33.1"}))
+
+	g.Expect(m.PolicyServerImage("v1.33.0")).To(Equal("ghcr.io/kubewarden/policy-server:v1.33.0"))
+	g.Expect(m.ImagePullSecret()).To(BeEmpty())
+}
+
+func TestAppCo(t *testing.T) {
+	g := NewWithT(t)
+
+	m, err := New(ModeAppCo, Options{
+		AppCoVersion: "0.5.1", AppCoUsername: "user", AppCoPassword: "s3cr3t",
+		Timeout: 100 * time.Millisecond, Interval: 10 * time.Millisecond,
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	charts := m.Charts(&versions.Release{Images: versions.Images{Controller: "v1.33.0"}}, values)
+	g.Expect(charts).To(HaveLen(1))
+	g.Expect(charts[0].Release).To(Equal("ssac"))
+	g.Expect(charts[0].Options.Chart).To(Equal("oci://dp.apps.rancher.io/charts/suse-security-admission-controller"))
+	g.Expect(charts[0].Options.Version).To(Equal("0.5.1"))
+	g.Expect(charts[0].Options.Set).To(Equal([]string{
+		"global.imagePullSecrets[0]=application-collection",
+		"kubewarden-controller.auditScanner.policyReporter=true",
+		"kubewarden-defaults.recommendedPolicies.enabled=true",
+	}))
+
+	h, f := helm.NewFake()
+
+	// Install is refused before Prepare
+	_, err = m.Install(context.Background(), h, charts[0])
+	g.Expect(err).To(MatchError(ContainSubstring("not prepared")))
+
+	// Secret and registry login
+	cl := fake.NewClientBuilder().WithObjects(ssacPod("kubewarden-controller-0", corev1.ConditionFalse)).Build()
+	g.Expect(m.Prepare(context.Background(), cl, h)).To(Succeed())
+	g.Expect(f.Logins).To(Equal([]string{"user@dp.apps.rancher.io"}))
+
+	secret := &corev1.Secret{}
+	g.Expect(cl.Get(context.Background(), client.ObjectKey{Namespace: "kubewarden", Name: "application-collection"}, secret)).To(Succeed())
+	g.Expect(secret.Type).To(Equal(corev1.SecretTypeDockerConfigJson))
+
+	config := map[string]map[string]map[string]string{}
+	g.Expect(json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config)).To(Succeed())
+	g.Expect(config["auths"]["dp.apps.rancher.io"]).To(HaveKeyWithValue("auth", "dXNlcjpzM2NyM3Q="))
+
+	// Preparing again updates the secret
+	g.Expect(m.Prepare(context.Background(), cl, h)).To(Succeed())
+
+	// The release is upgraded again with the same values once its pods are ready
+	chart := charts[0]
+	chart.Options.Chart = saveChart(t, "suse-security-admission-controller")
+	chart.Options.Version = ""
+	_, err = m.Install(context.Background(), h, chart)
+	g.Expect(err).To(MatchError(ContainSubstring("pod kubewarden-controller-0 is not ready")))
+
+	g.Expect(cl.Create(context.Background(), ssacPod("kubewarden-controller-1", corev1.ConditionTrue))).To(Succeed())
+	g.Expect(cl.Delete(context.Background(), ssacPod("kubewarden-controller-0", corev1.ConditionFalse))).To(Succeed())
+	r, err := m.Install(context.Background(), h, chart)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(r.Deployed()).To(BeTrue())
+	// Upgraded once by the first attempt, twice by the second one
+	g.Expect(r.Revision).To(Equal(3))
+	g.Expect(r.Config).To(HaveKeyWithValue("global", HaveKeyWithValue("imagePullSecrets", ConsistOf("application-collection"))))
+
+	g.Expect(m.PolicyServerImage("1.33.0")).To(Equal("dp.apps.rancher.io/containers/kubewarden-policy-server:1.33.0"))
+	g.Expect(m.ImagePullSecret()).To(Equal("application-collection"))
+}
@@ -0,0 +1,207 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/helm"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Upstream installs the charts of charts.kubewarden.io
+type Upstream struct {
+	opts Options
+}
+
+const upstreamRepo = "kubewarden"
+
+func (m *Upstream) Name() string { return ModeUpstream }
+
+func (m *Upstream) Namespace() string { return m.opts.Namespace }
+
+func (m *Upstream) Prepare(ctx context.Context, _ client.Client, h *helm.Client) error {
+	return h.AddRepo(ctx, upstreamRepo, "https://charts.kubewarden.io")
+}
+
+func (m *Upstream) Charts(release *versions.Release, values Values) []Chart {
+	charts := []Chart{}
+
+	for _, name := range []string{ChartCRDs, ChartController, ChartDefaults} {
+		opts := helm.Options{
+			Chart:           upstreamRepo + "/" + name,
+			Namespace:       m.opts.Namespace,
+			Set:             append([]string{}, values[name]...),
+			Install:         true,
+			CreateNamespace: true,
+			Wait:            true,
+		}
+
+		// Pin the whole stack to the selected release, unset versions are the ones of the chart
+		if release != nil {
+			switch name {
+			case ChartCRDs:
+				opts.Version = release.Charts.CRDs
+			case ChartController:
+				opts.Version = release.Charts.Controller
+				opts.Set = appendTag(opts.Set, "image.tag", release.Images.Controller)
+				opts.Set = appendTag(opts.Set, "auditScanner.image.tag", release.Images.AuditScanner)
+			case ChartDefaults:
+				opts.Version = release.Charts.Defaults
+				opts.Set = appendTag(opts.Set, "policyServer.image.tag", release.Images.PolicyServer)
+				opts.Set = append(opts.Set, release.PolicyValues()...)
+			}
+		}
+
+		charts = append(charts, Chart{Release: name, Options: opts})
+	}
+
+	return charts
+}
+
+// appendTag adds the --set value of an image tag, if set
+func appendTag(set []string, key, tag string) []string {
+	if tag == "" {
+		return set
+	}
+	return append(set, key+"="+tag)
+}
+
+func (m *Upstream) Install(ctx context.Context, h *helm.Client, chart Chart) (*helm.Release, error) {
+	return helmInstall(ctx, h, chart)
+}
+
+func (m *Upstream) PolicyServerImage(tag string) string {
+	return "ghcr.io/kubewarden/policy-server:" + tag
+}
+
+func (m *Upstream) ImagePullSecret() string { return "" }
+
+// AppCo installs the SUSE Security Admission Controller chart of the Rancher Application Collection
+type AppCo struct {
+	opts Options
+
+	// Set by Prepare
+	cl client.Client
+}
+
+const (
+	appCoRegistry   = "dp.apps.rancher.io"
+	appCoChart      = "oci://" + appCoRegistry + "/charts/suse-security-admission-controller"
+	appCoRelease    = "ssac"
+	appCoPullSecret = "application-collection"
+)
+
+func (m *AppCo) Name() string { return ModeAppCo }
+
+func (m *AppCo) Namespace() string { return m.opts.Namespace }
+
+func (m *AppCo) Prepare(ctx context.Context, cl client.Client, h *helm.Client) error {
+	m.cl = cl
+
+	if err := createNamespace(ctx, cl, m.opts.Namespace); err != nil {
+		return err
+	}
+
+	if err := ApplyPullSecret(ctx, cl, m.opts.Namespace, appCoPullSecret,
+		appCoRegistry, m.opts.AppCoUsername, m.opts.AppCoPassword); err != nil {
+		return err
+	}
+
+	return h.RegistryLogin(ctx, appCoRegistry, m.opts.AppCoUsername, m.opts.AppCoPassword)
+}
+
+// Charts returns the single AppCo release, the upstream charts are its subcharts.
+// The AppCo chart pins its own images and policies, the images of the release are not used.
+func (m *AppCo) Charts(_ *versions.Release, values Values) []Chart {
+	opts := helm.Options{
+		Chart:           appCoChart,
+		Version:         m.opts.AppCoVersion,
+		Namespace:       m.opts.Namespace,
+		Set:             []string{"global.imagePullSecrets[0]=" + appCoPullSecret},
+		Install:         true,
+		CreateNamespace: true,
+		Wait:            true,
+	}
+
+	// Values of the upstream charts go to the subcharts
+	for _, name := range []string{ChartCRDs, ChartController, ChartDefaults} {
+		for _, v := range values[name] {
+			opts.Set = append(opts.Set, name+"."+v)
+		}
+	}
+
+	return []Chart{{Release: appCoRelease, Options: opts}}
+}
+
+// Install installs or upgrades the release, then upgrades it again once its pods are ready:
+// the default policy-server is only deployed once the controller runs. Prepare must have been called.
+func (m *AppCo) Install(ctx context.Context, h *helm.Client, chart Chart) (*helm.Release, error) {
+	if m.cl == nil {
+		return nil, fmt.Errorf("%s install mode is not prepared", ModeAppCo)
+	}
+
+	if _, err := helmInstall(ctx, h, chart); err != nil {
+		return nil, err
+	}
+
+	selector := client.MatchingLabels{"app.kubernetes.io/instance": chart.Release}
+	if err := poll(ctx, m.opts, "pods of the "+chart.Release+" release", func(ctx context.Context) (bool, error) {
+		pods := &corev1.PodList{}
+		if err := m.cl.List(ctx, pods, client.InNamespace(chart.Options.Namespace), selector); err != nil {
+			return false, err
+		}
+		if len(pods.Items) == 0 {
+			return false, fmt.Errorf("no pod of the %s release yet", chart.Release)
+		}
+
+		for _, pod := range pods.Items {
+			// Completed hook jobs are never ready
+			if pod.Status.Phase != corev1.PodSucceeded && !podReady(&pod) {
+				return false, fmt.Errorf("pod %s is not ready (%s)", pod.Name, pod.Status.Phase)
+			}
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Same chart and values, like "helm upgrade --reuse-values"
+	opts := chart.Options
+	opts.Set = nil
+	opts.SetFile = nil
+	opts.Install = false
+	opts.ReuseValues = true
+	return h.Upgrade(ctx, chart.Release, opts)
+}
+
+// podReady tells if the Ready condition of a pod is true
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (m *AppCo) PolicyServerImage(tag string) string {
+	return appCoRegistry + "/containers/kubewarden-policy-server:" + tag
+}
+
+func (m *AppCo) ImagePullSecret() string { return appCoPullSecret }
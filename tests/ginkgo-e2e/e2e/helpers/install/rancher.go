@@ -0,0 +1,355 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/helm"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+	"helm.sh/helm/v3/pkg/strvals"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	rancherNamespace = "cattle-kubewarden-system"
+	// ClusterRepo of the Kubewarden charts, see resources/rancher/repo-kubewarden-charts.yaml
+	rancherChartsRepo = "kubewarden-charts"
+	// Prefix Rancher gives to the release names, see resources/rancher/curl-data-*.json
+	rancherReleasePrefix = "rancher-"
+)
+
+// Lines of the helm container log reported when an operation fails
+const rancherOperationLogLines = 20
+
+// Rancher installs the charts as Rancher Manager apps, through the catalog API
+type Rancher struct {
+	opts Options
+
+	// Set by Prepare
+	url   string
+	token string
+	http  *http.Client
+	cl    client.Client
+	// Returns the end of the log of a container, reads it from the cluster of KUBECONFIG if not set
+	logs func(ctx context.Context, namespace, pod, container string) (string, error)
+}
+
+func (m *Rancher) Name() string { return ModeRancher }
+
+func (m *Rancher) Namespace() string { return m.opts.Namespace }
+
+// Prepare logs in to Rancher, creates the ClusterRepos and installs the Kubewarden UI extension
+func (m *Rancher) Prepare(ctx context.Context, cl client.Client, h *helm.Client) error {
+	m.cl = cl
+
+	hostname := m.opts.RancherHostname
+	if hostname == "" {
+		values, err := h.Values(ctx, "rancher", "cattle-system", false)
+		if err != nil {
+			return fmt.Errorf("cannot get the Rancher hostname: %w", err)
+		}
+		hostname, _ = values["hostname"].(string)
+	}
+	if !strings.Contains(hostname, "://") {
+		hostname = "https://" + hostname
+	}
+	m.url = strings.TrimSuffix(hostname, "/")
+
+	if m.logs == nil {
+		m.logs = containerLogs
+	}
+
+	// Rancher is deployed with the private CA of the tests
+	if m.http == nil {
+		m.http = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	}
+
+	login := struct {
+		Token string `json:"token"`
+	}{}
+	if err := m.request(ctx, http.MethodPost, "/v3-public/localProviders/local?action=login",
+		map[string]string{"username": "admin", "password": m.opts.RancherPassword}, &login); err != nil {
+		return fmt.Errorf("cannot log in to Rancher: %w", err)
+	}
+	m.token = login.Token
+
+	// Prime uses the official extension repository
+	version := struct {
+		Prime string `json:"RancherPrime"`
+	}{}
+	if err := m.request(ctx, http.MethodGet, "/rancherversion", nil, &version); err != nil {
+		return err
+	}
+	extensionRepo := "kubewarden-extension-github"
+	if version.Prime == "true" {
+		extensionRepo = "rancher-ui-plugins"
+	}
+
+	for _, repo := range []string{extensionRepo, rancherChartsRepo} {
+		if err := m.applyRepo(ctx, repo); err != nil {
+			return err
+		}
+	}
+
+	return m.installApp(ctx, extensionRepo, "curl-data-extension.json", "kubewarden", "", nil)
+}
+
+func (m *Rancher) Charts(release *versions.Release, values Values) []Chart {
+	upstream := &Upstream{opts: m.opts}
+
+	// Same values as upstream, only the release names and the way to install differ
+	charts := upstream.Charts(release, values)
+	for i := range charts {
+		charts[i].Options.Chart = charts[i].Release
+		charts[i].Release = rancherReleasePrefix + charts[i].Release
+	}
+	return charts
+}
+
+// Install installs the chart as a Rancher app, Prepare must have been called
+func (m *Rancher) Install(ctx context.Context, h *helm.Client, chart Chart) (*helm.Release, error) {
+	if m.token == "" {
+		return nil, fmt.Errorf("%s install mode is not prepared", ModeRancher)
+	}
+
+	file := "curl-data-" + strings.TrimPrefix(chart.Options.Chart, "kubewarden-") + ".json"
+	if err := m.installApp(ctx, rancherChartsRepo, file, chart.Options.Chart, chart.Options.Version, chart.Options.Set); err != nil {
+		return nil, err
+	}
+
+	return h.Get(ctx, chart.Release, m.opts.Namespace)
+}
+
+func (m *Rancher) PolicyServerImage(tag string) string {
+	return "ghcr.io/kubewarden/policy-server:" + tag
+}
+
+func (m *Rancher) ImagePullSecret() string { return "" }
+
+// request calls the Rancher API, in and out are JSON encoded
+func (m *Rancher) request(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, m.url+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if m.token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.token)
+	}
+
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// applyRepo creates a ClusterRepo from resources/rancher/repo-<name>.yaml and waits for its index
+func (m *Rancher) applyRepo(ctx context.Context, name string) error {
+	data, err := os.ReadFile(filepath.Join(m.opts.RancherResources, "repo-"+name+".yaml"))
+	if err != nil {
+		return err
+	}
+
+	repo := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(data, &repo.Object); err != nil {
+		return fmt.Errorf("cannot parse ClusterRepo %s: %w", name, err)
+	}
+	if err := m.cl.Create(ctx, repo); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return poll(ctx, m.opts, "ClusterRepo "+name+" to be downloaded", func(ctx context.Context) (bool, error) {
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(repo.GroupVersionKind())
+		if err := m.cl.Get(ctx, client.ObjectKey{Name: name}, current); err != nil {
+			return false, err
+		}
+
+		if downloaded, _, _ := unstructured.NestedString(current.Object, "status", "downloadTime"); downloaded == "" {
+			return false, fmt.Errorf("index of %s not downloaded yet", name)
+		}
+		return true, nil
+	})
+}
+
+// latestVersion returns the latest version of a chart in the index of a ClusterRepo
+func (m *Rancher) latestVersion(ctx context.Context, repo, chart string) (string, error) {
+	index := struct {
+		Entries map[string][]struct {
+			Version string `json:"version"`
+		} `json:"entries"`
+	}{}
+	if err := m.request(ctx, http.MethodGet, "/v1/catalog.cattle.io.clusterrepos/"+repo+"?link=index", nil, &index); err != nil {
+		return "", err
+	}
+
+	if len(index.Entries[chart]) == 0 {
+		return "", fmt.Errorf("chart %s not found in ClusterRepo %s", chart, repo)
+	}
+	return index.Entries[chart][0].Version, nil
+}
+
+/*
+Set --set overrides in the values of an install request
+  - @param values Values of the chart in the request
+  - @param set Overrides, parsed like helm --set: only booleans and integers are typed, [i] indexes lists
+  - @returns Nothing or an error, values is modified
+*/
+func mergeValues(values map[string]any, set []string) error {
+	for _, s := range set {
+		if err := strvals.ParseInto(s, values); err != nil {
+			return fmt.Errorf("cannot parse value %q: %w", s, err)
+		}
+	}
+	return nil
+}
+
+// installApp sends an install request from resources/rancher and waits for the Helm operation
+func (m *Rancher) installApp(ctx context.Context, repo, file, chart, version string, set []string) error {
+	data, err := os.ReadFile(filepath.Join(m.opts.RancherResources, file))
+	if err != nil {
+		return err
+	}
+
+	request := struct {
+		Charts    []map[string]any `json:"charts"`
+		Namespace string           `json:"namespace"`
+	}{}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return fmt.Errorf("cannot parse %s: %w", file, err)
+	}
+	if len(request.Charts) != 1 {
+		return fmt.Errorf("%s must install exactly one chart", file)
+	}
+
+	if version == "" {
+		if version, err = m.latestVersion(ctx, repo, chart); err != nil {
+			return err
+		}
+	}
+	request.Charts[0]["version"] = version
+
+	values, ok := request.Charts[0]["values"].(map[string]any)
+	if !ok {
+		values = map[string]any{}
+	}
+	if err := mergeValues(values, set); err != nil {
+		return err
+	}
+	request.Charts[0]["values"] = values
+
+	operation := struct {
+		Name      string `json:"operationName"`
+		Namespace string `json:"operationNamespace"`
+	}{}
+	if err := m.request(ctx, http.MethodPost, "/v1/catalog.cattle.io.clusterrepos/"+repo+"?action=install", request, &operation); err != nil {
+		return fmt.Errorf("cannot install %s: %w", chart, err)
+	}
+
+	return m.waitOperation(ctx, operation.Namespace, operation.Name)
+}
+
+// waitOperation waits for the helm container of a Rancher operation pod to succeed
+func (m *Rancher) waitOperation(ctx context.Context, namespace, name string) error {
+	var failed error
+
+	err := poll(ctx, m.opts, "Helm operation "+namespace+"/"+name, func(ctx context.Context) (bool, error) {
+		pod := &corev1.Pod{}
+		if err := m.cl.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, pod); err != nil {
+			return false, err
+		}
+
+		for _, c := range pod.Status.ContainerStatuses {
+			if c.Name != "helm" || c.State.Terminated == nil {
+				continue
+			}
+
+			if c.State.Terminated.ExitCode != 0 {
+				// The termination message is usually empty, the reason is in the log
+				log, err := m.logs(ctx, namespace, name, c.Name)
+				if err != nil {
+					log = "cannot read the log: " + err.Error()
+				}
+				failed = fmt.Errorf("helm operation %s/%s failed with exit code %d: %s", namespace, name,
+					c.State.Terminated.ExitCode, strings.TrimSpace(log))
+			}
+			return true, nil
+		}
+		return false, fmt.Errorf("helm operation %s/%s still running (%s)", namespace, name, pod.Status.Phase)
+	})
+	if err != nil {
+		return err
+	}
+	return failed
+}
+
+// containerLogs returns the end of the log of a container, from the cluster of KUBECONFIG
+func containerLogs(ctx context.Context, namespace, pod, container string) (string, error) {
+	restConfig, err := config.GetConfig()
+	if err != nil {
+		return "", err
+	}
+	cs, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return "", err
+	}
+
+	tail := int64(rancherOperationLogLines)
+	data, err := cs.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{Container: container, TailLines: &tail}).DoRaw(ctx)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,195 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/helm"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+const rancherResources = "../../../../../resources/rancher"
+
+// fakeRancher records the install requests and answers with an operation per request
+type fakeRancher struct {
+	installs map[string]map[string]any
+}
+
+func (f *fakeRancher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v3-public/localProviders/local" && r.Header.Get("Authorization") != "Bearer token-abc:xyz" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v3-public/localProviders/local":
+		_, _ = w.Write([]byte(`{"token": "token-abc:xyz"}`))
+	case r.URL.Path == "/rancherversion":
+		_, _ = w.Write([]byte(`{"RancherPrime": "false", "Version": "v2.12.0"}`))
+	case r.URL.Query().Get("link") == "index":
+		_, _ = w.Write([]byte(`{"entries": {"kubewarden": [{"version": "3.4.0"}, {"version": "3.3.0"}]}}`))
+	case r.URL.Query().Get("action") == "install":
+		request := map[string]any{}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		chart := request["charts"].([]any)[0].(map[string]any)
+		f.installs[chart["chartName"].(string)] = chart
+		_, _ = w.Write([]byte(`{"operationName": "helm-operation-` + chart["chartName"].(string) + `", "operationNamespace": "cattle-system"}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// operationPod returns a finished Rancher operation pod
+func operationPod(chart string, exitCode int32) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cattle-system", Name: "helm-operation-" + chart},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "helm",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode}},
+		}}},
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	g := NewWithT(t)
+
+	values := map[string]any{"auditScanner": map[string]any{"policyReporter": true}}
+	g.Expect(mergeValues(values, []string{
+		"auditScanner.cronJob.schedule=*/2 * * * *",
+		"auditScanner.cronJob.failedJobsHistoryLimit=5",
+		"recommendedPolicies.enabled=true",
+		"image.tag=v1.33.0",
+		// Versions are not numbers
+		"policyServer.image.tag=1.10",
+		"global.imagePullSecrets[0]=application-collection",
+	})).To(Succeed())
+
+	g.Expect(values).To(Equal(map[string]any{
+		"auditScanner": map[string]any{
+			"policyReporter": true,
+			"cronJob":        map[string]any{"schedule": "*/2 * * * *", "failedJobsHistoryLimit": int64(5)},
+		},
+		"recommendedPolicies": map[string]any{"enabled": true},
+		"image":               map[string]any{"tag": "v1.33.0"},
+		"policyServer":        map[string]any{"image": map[string]any{"tag": "1.10"}},
+		"global":              map[string]any{"imagePullSecrets": []any{"application-collection"}},
+	}))
+
+	g.Expect(mergeValues(values, []string{"global.imagePullSecrets[x]=foo"})).To(MatchError(ContainSubstring("cannot parse value")))
+}
+
+func TestRancher(t *testing.T) {
+	g := NewWithT(t)
+
+	f := &fakeRancher{installs: map[string]map[string]any{}}
+	srv := httptest.NewTLSServer(f)
+	defer srv.Close()
+
+	// Rancher downloads the index of the repositories
+	downloaded := interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if err := cl.Get(ctx, key, obj, opts...); err != nil {
+				return err
+			}
+			if u, ok := obj.(*unstructured.Unstructured); ok && u.GetKind() == "ClusterRepo" {
+				return unstructured.SetNestedField(u.Object, "2025-06-01T10:00:00Z", "status", "downloadTime")
+			}
+			return nil
+		},
+	}
+	cl := fake.NewClientBuilder().
+		WithObjects(operationPod("kubewarden", 0), operationPod("kubewarden-controller", 0), operationPod("kubewarden-defaults", 1)).
+		WithInterceptorFuncs(downloaded).
+		Build()
+
+	// Release deployed by the Helm operation of Rancher
+	h, hf := helm.NewFake()
+	g.Expect(hf.Releases.Create(&release.Release{
+		Name:      "rancher-kubewarden-controller",
+		Namespace: "cattle-kubewarden-system",
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "kubewarden-controller", Version: "5.3.0"}},
+	})).To(Succeed())
+
+	mode, err := New(ModeRancher, Options{
+		RancherHostname:  srv.URL,
+		RancherResources: rancherResources,
+		Timeout:          time.Second,
+		Interval:         10 * time.Millisecond,
+	})
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(mode.Namespace()).To(Equal("cattle-kubewarden-system"))
+
+	m := mode.(*Rancher)
+	m.http = srv.Client()
+	m.logs = func(_ context.Context, namespace, pod, container string) (string, error) {
+		return "Error: UPGRADE FAILED: " + namespace + "/" + pod + "/" + container + "\n", nil
+	}
+
+	// Install is refused before Prepare
+	_, err = m.Install(context.Background(), h, Chart{})
+	g.Expect(err).To(MatchError(ContainSubstring("not prepared")))
+
+	g.Expect(m.Prepare(context.Background(), cl, h)).To(Succeed())
+
+	repo := &unstructured.Unstructured{}
+	repo.SetAPIVersion("catalog.cattle.io/v1")
+	repo.SetKind("ClusterRepo")
+	g.Expect(cl.Get(context.Background(), client.ObjectKey{Name: "kubewarden-charts"}, repo)).To(Succeed())
+	g.Expect(cl.Get(context.Background(), client.ObjectKey{Name: "kubewarden-extension-github"}, repo)).To(Succeed())
+
+	// The extension is installed with the latest version of the index
+	g.Expect(f.installs["kubewarden"]).To(HaveKeyWithValue("version", "3.4.0"))
+
+	charts := m.Charts(nil, Values{ChartController: {"auditScanner.cronJob.schedule=*/2 * * * *"}})
+	g.Expect(charts).To(HaveLen(3))
+	g.Expect(charts[1].Release).To(Equal("rancher-kubewarden-controller"))
+	g.Expect(charts[1].Options.Chart).To(Equal("kubewarden-controller"))
+	charts[1].Options.Version = "5.3.0"
+
+	r, err := m.Install(context.Background(), h, charts[1])
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(r.Deployed()).To(BeTrue())
+	g.Expect(r.Chart.Metadata.Version).To(Equal("5.3.0"))
+
+	// Values of the request file are kept, the overrides are merged
+	controller := f.installs["kubewarden-controller"]
+	g.Expect(controller).To(HaveKeyWithValue("version", "5.3.0"))
+	g.Expect(controller).To(HaveKeyWithValue("releaseName", "rancher-kubewarden-controller"))
+	g.Expect(controller["values"]).To(HaveKeyWithValue("auditScanner", Equal(map[string]any{
+		"policyReporter": true,
+		"cronJob":        map[string]any{"schedule": "*/2 * * * *"},
+	})))
+
+	// A failed Helm operation fails the install
+	charts[2].Options.Version = "3.3.0"
+	_, err = m.Install(context.Background(), h, charts[2])
+	g.Expect(err).To(MatchError(ContainSubstring("helm operation cattle-system/helm-operation-kubewarden-defaults failed with exit code 1: Error: UPGRADE FAILED: cattle-system/helm-operation-kubewarden-defaults/helm")))
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubewarden
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Report CRDs the audit scanner can write to, as set with the auditScanner.reportCRDsKind chart value
+const (
+	ReportCRDsOpenReports  = "openreports"
+	ReportCRDsPolicyReport = "policyreport"
+)
+
+// Name of the audit scanner CronJob deployed by the kubewarden-controller chart
+const AuditScannerCronJob = "audit-scanner"
+
+// Kinds of the reports for each kind of report CRDs
+var reportKinds = map[string][]schema.GroupVersionKind{
+	ReportCRDsOpenReports: {
+		{Group: "openreports.io", Version: "v1alpha1", Kind: "Report"},
+		{Group: "openreports.io", Version: "v1alpha1", Kind: "ClusterReport"},
+	},
+	ReportCRDsPolicyReport: {
+		{Group: "wgpolicyk8s.io", Version: "v1alpha2", Kind: "PolicyReport"},
+		{Group: "wgpolicyk8s.io", Version: "v1alpha2", Kind: "ClusterPolicyReport"},
+	},
+}
+
+// Label set by the audit scanner on its reports
+var reportLabels = client.MatchingLabels{"app.kubernetes.io/managed-by": "kubewarden"}
+
+/*
+Get the schedule of the audit scanner
+  - @param namespace Namespace of the kubewarden-controller release
+  - @returns The cron schedule of the CronJob or an error
+*/
+func (c *Client) AuditScannerSchedule(ctx context.Context, namespace string) (string, error) {
+	cronJob := &batchv1.CronJob{}
+	if err := c.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: AuditScannerCronJob}, cronJob); err != nil {
+		return "", err
+	}
+
+	return cronJob.Spec.Schedule, nil
+}
+
+/*
+Count the reports written by the audit scanner
+  - @param crds Kind of report CRDs: ReportCRDsOpenReports or ReportCRDsPolicyReport
+  - @returns The number of namespaced and cluster-wide reports, an error wrapping a NoKindMatchError if the CRDs are not installed
+*/
+func (c *Client) CountReports(ctx context.Context, crds string) (int, error) {
+	gvks, ok := reportKinds[crds]
+	if !ok {
+		return 0, fmt.Errorf("unknown report CRDs %q", crds)
+	}
+
+	count := 0
+	for _, gvk := range gvks {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+
+		if err := c.Client.List(ctx, list, reportLabels); err != nil {
+			return 0, fmt.Errorf("cannot list %s: %w", gvk.Kind, err)
+		}
+		count += len(list.Items)
+	}
+
+	return count, nil
+}
+
+/*
+Wait for the audit scanner to write its reports to the expected CRDs only
+  - @param crds Kind of report CRDs the audit scanner is configured with
+  - @returns An error on timeout, telling which CRDs are missing or wrongly used
+*/
+func (c *Client) WaitReports(ctx context.Context, crds string) error {
+	others := []string{}
+	for kind := range reportKinds {
+		if kind != crds {
+			others = append(others, kind)
+		}
+	}
+	sort.Strings(others)
+
+	return c.poll(ctx, "audit reports in "+crds+" CRDs", func(ctx context.Context) (bool, error) {
+		count, err := c.CountReports(ctx, crds)
+		if err != nil {
+			return false, err
+		}
+		if count == 0 {
+			return false, fmt.Errorf("no %s report written yet", crds)
+		}
+
+		// The other CRDs may not even be installed
+		for _, other := range others {
+			count, err := c.CountReports(ctx, other)
+			if err != nil && !meta.IsNoMatchError(err) {
+				return false, err
+			}
+			if count > 0 {
+				return false, fmt.Errorf("%d reports written in %s CRDs instead of %s", count, other, crds)
+			}
+		}
+		return true, nil
+	})
+}
@@ -0,0 +1,98 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubewarden
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func newReport(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "kubewarden"})
+	return obj
+}
+
+func TestAuditScannerSchedule(t *testing.T) {
+	g := NewWithT(t)
+
+	c := newFakeClient(&batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kubewarden", Name: AuditScannerCronJob},
+		Spec:       batchv1.CronJobSpec{Schedule: "*/2 * * * *"},
+	})
+
+	schedule, err := c.AuditScannerSchedule(context.Background(), "kubewarden")
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(schedule).To(Equal("*/2 * * * *"))
+}
+
+func TestWaitReports(t *testing.T) {
+	g := NewWithT(t)
+
+	// wgpolicyk8s CRDs are not installed
+	noPolicyReport := interceptor.Funcs{
+		List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if list.GetObjectKind().GroupVersionKind().Group == "wgpolicyk8s.io" {
+				return &meta.NoKindMatchError{GroupKind: list.GetObjectKind().GroupVersionKind().GroupKind()}
+			}
+			return cl.List(ctx, list, opts...)
+		},
+	}
+
+	c := NewForClient(fake.NewClientBuilder().
+		WithObjects(
+			newReport("openreports.io/v1alpha1", "Report", "default", "pod-1"),
+			newReport("openreports.io/v1alpha1", "ClusterReport", "", "namespace-default"),
+		).
+		WithInterceptorFuncs(noPolicyReport).
+		Build())
+	c.Timeout = 200 * time.Millisecond
+	c.Interval = 10 * time.Millisecond
+
+	g.Expect(c.CountReports(context.Background(), ReportCRDsOpenReports)).To(Equal(2))
+	g.Expect(c.WaitReports(context.Background(), ReportCRDsOpenReports)).To(Succeed())
+	g.Expect(c.WaitReports(context.Background(), ReportCRDsPolicyReport)).
+		To(MatchError(ContainSubstring("no matches for kind")))
+}
+
+func TestWaitReportsWrongCRDs(t *testing.T) {
+	g := NewWithT(t)
+
+	c := newFakeClient(newReport("wgpolicyk8s.io/v1alpha2", "PolicyReport", "default", "pod-1"))
+
+	g.Expect(c.WaitReports(context.Background(), ReportCRDsOpenReports)).
+		To(MatchError(ContainSubstring("no openreports report written yet")))
+
+	c = newFakeClient(
+		newReport("openreports.io/v1alpha1", "Report", "default", "pod-1"),
+		newReport("wgpolicyk8s.io/v1alpha2", "PolicyReport", "default", "pod-1"),
+	)
+	g.Expect(c.WaitReports(context.Background(), ReportCRDsOpenReports)).
+		To(MatchError(ContainSubstring("1 reports written in policyreport CRDs instead of openreports")))
+}
@@ -0,0 +1,408 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubewarden
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/elemental/tests/e2e/helpers/common"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+const (
+	// Group and version of the Kubewarden CRDs
+	Group   = "policies.kubewarden.io"
+	Version = "v1"
+
+	// Status reported by an active policy
+	PolicyStatusActive = "active"
+)
+
+// Kind is a Kubewarden custom resource kind
+type Kind string
+
+const (
+	KindPolicyServer                Kind = "PolicyServer"
+	KindAdmissionPolicy             Kind = "AdmissionPolicy"
+	KindClusterAdmissionPolicy      Kind = "ClusterAdmissionPolicy"
+	KindAdmissionPolicyGroup        Kind = "AdmissionPolicyGroup"
+	KindClusterAdmissionPolicyGroup Kind = "ClusterAdmissionPolicyGroup"
+)
+
+// PolicyKinds lists all the policy kinds, policy groups included
+var PolicyKinds = []Kind{
+	KindAdmissionPolicy,
+	KindClusterAdmissionPolicy,
+	KindAdmissionPolicyGroup,
+	KindClusterAdmissionPolicyGroup,
+}
+
+// GroupVersionKind returns the GVK of the kind
+func (k Kind) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: Group, Version: Version, Kind: string(k)}
+}
+
+// Plural resource names of the kinds, as declared by the CRDs
+var kindResources = map[Kind]string{
+	KindPolicyServer:                "policyservers",
+	KindAdmissionPolicy:             "admissionpolicies",
+	KindClusterAdmissionPolicy:      "clusteradmissionpolicies",
+	KindAdmissionPolicyGroup:        "admissionpolicygroups",
+	KindClusterAdmissionPolicyGroup: "clusteradmissionpolicygroups",
+}
+
+// Resource returns the plural resource name of the kind, e.g. clusteradmissionpolicies, empty for an unknown kind
+func (k Kind) Resource() string {
+	return kindResources[k]
+}
+
+/*
+Get the kind of a plural resource name
+  - @param resource Plural resource name, e.g. clusteradmissionpolicies
+  - @returns The kind, false if not a Kubewarden resource
+*/
+func KindForResource(resource string) (Kind, bool) {
+	for _, k := range append([]Kind{KindPolicyServer}, PolicyKinds...) {
+		if k.Resource() == resource {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// Namespaced returns true if the kind is a namespaced resource
+func (k Kind) Namespaced() bool {
+	return k == KindAdmissionPolicy || k == KindAdmissionPolicyGroup
+}
+
+// PolicyRef identifies a policy of any kind
+type PolicyRef struct {
+	Kind      Kind
+	Namespace string
+	Name      string
+}
+
+// ClusterPolicy returns a reference to a ClusterAdmissionPolicy
+func ClusterPolicy(name string) PolicyRef {
+	return PolicyRef{Kind: KindClusterAdmissionPolicy, Name: name}
+}
+
+// Policy returns a reference to a namespaced AdmissionPolicy
+func Policy(namespace, name string) PolicyRef {
+	return PolicyRef{Kind: KindAdmissionPolicy, Namespace: namespace, Name: name}
+}
+
+func (r PolicyRef) String() string {
+	if r.Namespace != "" {
+		return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+	}
+	return fmt.Sprintf("%s %s", r.Kind, r.Name)
+}
+
+// Client gives typed access to the Kubewarden resources
+type Client struct {
+	client.Client
+
+	// Timeout and interval used by the Wait* functions
+	Timeout  time.Duration
+	Interval time.Duration
+
+	// Returns the log of a pod, the one of its previous run included
+	logs func(ctx context.Context, namespace, pod string) (string, error)
+}
+
+/*
+Create a Kubewarden client for the current kubeconfig (KUBECONFIG, then ~/.kube/config)
+  - @returns The client or an error
+*/
+func New() (*Client, error) {
+	restConfig, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(restConfig, client.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewForClient(c), nil
+}
+
+/*
+Create a Kubewarden client on top of an existing controller-runtime client
+  - @param c controller-runtime client, can be a fake one
+  - @returns The client with default timeouts
+*/
+func NewForClient(c client.Client) *Client {
+	return &Client{
+		Client:   c,
+		Timeout:  5 * time.Minute,
+		Interval: 10 * time.Second,
+		logs:     podLogs,
+	}
+}
+
+// Lines of the pod logs searched by WaitPolicyServerError
+const podLogLines = 50
+
+// podLogs returns the end of the log of a pod, from the cluster of KUBECONFIG
+func podLogs(ctx context.Context, namespace, pod string) (string, error) {
+	restConfig, err := config.GetConfig()
+	if err != nil {
+		return "", err
+	}
+	cs, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return "", err
+	}
+
+	tail := int64(podLogLines)
+	data, err := cs.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{TailLines: &tail}).DoRaw(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// A crashing policy-server logs its error before a restart, there is no previous run otherwise
+	previous, _ := cs.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{TailLines: &tail, Previous: true}).DoRaw(ctx)
+	return string(previous) + string(data), nil
+}
+
+/*
+Get a Kubewarden resource
+  - @param kind Kind of the resource
+  - @param namespace Namespace of the resource, empty for cluster-wide kinds
+  - @param name Name of the resource
+  - @returns The resource or an error
+*/
+func (c *Client) Get(ctx context.Context, kind Kind, namespace, name string) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(kind.GroupVersionKind())
+
+	if err := c.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+/*
+List Kubewarden resources of one kind
+  - @param kind Kind of the resources
+  - @param opts Usual controller-runtime list options (namespace, labels, ...)
+  - @returns The resources or an error
+*/
+func (c *Client) List(ctx context.Context, kind Kind, opts ...client.ListOption) ([]unstructured.Unstructured, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(kind.GroupVersionKind().GroupVersion().WithKind(string(kind) + "List"))
+
+	if err := c.Client.List(ctx, list, opts...); err != nil {
+		return nil, err
+	}
+
+	return list.Items, nil
+}
+
+// GetPolicy returns the policy pointed by the reference
+func (c *Client) GetPolicy(ctx context.Context, ref PolicyRef) (*unstructured.Unstructured, error) {
+	return c.Get(ctx, ref.Kind, ref.Namespace, ref.Name)
+}
+
+// GetPolicyServer returns the named PolicyServer
+func (c *Client) GetPolicyServer(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+	return c.Get(ctx, KindPolicyServer, "", name)
+}
+
+/*
+Get a condition from the status of a resource
+  - @param obj Resource to look into
+  - @param condType Type of the condition
+  - @returns The condition status and message, found is false if the condition is not set
+*/
+func Condition(obj *unstructured.Unstructured, condType string) (status, message string, found bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]any)
+		if !ok || cond["type"] != condType {
+			continue
+		}
+
+		status, _ = cond["status"].(string)
+		message, _ = cond["message"].(string)
+		return status, message, true
+	}
+
+	return "", "", false
+}
+
+// PolicyStatus returns the .status.policyStatus field of a policy
+func PolicyStatus(obj *unstructured.Unstructured) string {
+	status, _, _ := unstructured.NestedString(obj.Object, "status", "policyStatus")
+	return status
+}
+
+// poll calls check until it returns true, the last error is kept to explain a timeout
+func (c *Client) poll(ctx context.Context, what string, check func(context.Context) (bool, error)) error {
+	return common.Poll(ctx, c.Interval, c.Timeout, what, check)
+}
+
+/*
+Wait for a policy to be active
+  - @param ref Policy to wait for
+  - @returns An error with the last seen status on timeout
+*/
+func (c *Client) WaitPolicyActive(ctx context.Context, ref PolicyRef) error {
+	return c.poll(ctx, ref.String()+" to be active", func(ctx context.Context) (bool, error) {
+		obj, err := c.GetPolicy(ctx, ref)
+		if err != nil {
+			return false, err
+		}
+
+		if status := PolicyStatus(obj); status != PolicyStatusActive {
+			return false, fmt.Errorf("policyStatus is %q", status)
+		}
+		return true, nil
+	})
+}
+
+/*
+Wait for the deployment of a PolicyServer to be reconciled
+  - @param name Name of the PolicyServer
+  - @returns An error with the last seen condition on timeout
+*/
+func (c *Client) WaitPolicyServerReconciled(ctx context.Context, name string) error {
+	return c.poll(ctx, "PolicyServer "+name+" to be reconciled", func(ctx context.Context) (bool, error) {
+		obj, err := c.GetPolicyServer(ctx, name)
+		if err != nil {
+			return false, err
+		}
+
+		status, message, found := Condition(obj, "DeploymentReconciled")
+		if !found {
+			return false, fmt.Errorf("DeploymentReconciled condition not set")
+		}
+		if status != "True" {
+			return false, fmt.Errorf("DeploymentReconciled is %s: %s", status, message)
+		}
+		return true, nil
+	})
+}
+
+/*
+Wait for the replicas of a PolicyServer to be ready on distinct nodes
+  - @param name Name of the PolicyServer
+  - @param nodes Number of nodes the replicas must run on
+  - @returns An error with the last seen placement on timeout
+*/
+func (c *Client) WaitPolicyServerSpread(ctx context.Context, name string, nodes int) error {
+	return c.poll(ctx, fmt.Sprintf("PolicyServer %s to run on %d nodes", name, nodes), func(ctx context.Context) (bool, error) {
+		pods := &corev1.PodList{}
+		if err := c.Client.List(ctx, pods, client.MatchingLabels{PolicyServerLabel: name}); err != nil {
+			return false, err
+		}
+
+		placement := map[string]string{}
+		for _, p := range pods.Items {
+			ready := false
+			for _, cond := range p.Status.Conditions {
+				ready = ready || (cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue)
+			}
+			if p.DeletionTimestamp != nil || !ready {
+				return false, fmt.Errorf("pod %s/%s not ready on node %q", p.Namespace, p.Name, p.Spec.NodeName)
+			}
+			placement[p.Spec.NodeName] = p.Name
+		}
+
+		if len(placement) != nodes {
+			return false, fmt.Errorf("%d ready pods on %d nodes: %v", len(pods.Items), len(placement), placement)
+		}
+		return true, nil
+	})
+}
+
+// messages returns the messages of the conditions of a resource
+func messages(obj *unstructured.Unstructured) []string {
+	msgs := []string{}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		if cond, ok := c.(map[string]any); ok {
+			if message, _ := cond["message"].(string); message != "" {
+				msgs = append(msgs, message)
+			}
+		}
+	}
+	return msgs
+}
+
+/*
+Wait for a PolicyServer to fail loading a policy with an expected error
+  - @param name Name of the PolicyServer
+  - @param ref Policy served by the PolicyServer
+  - @param pattern Expected error, e.g. a certificate error
+  - @returns The source and the line of the matching error: a condition of the policy or of the PolicyServer, or the log of a pod, or an error on timeout
+*/
+func (c *Client) WaitPolicyServerError(ctx context.Context, name string, ref PolicyRef, pattern *regexp.Regexp) (string, error) {
+	var found string
+
+	err := c.poll(ctx, fmt.Sprintf("PolicyServer %s to report %q", name, pattern), func(ctx context.Context) (bool, error) {
+		sources := map[string][]string{}
+		if obj, err := c.GetPolicy(ctx, ref); err == nil {
+			sources[ref.String()] = messages(obj)
+		}
+		if obj, err := c.GetPolicyServer(ctx, name); err == nil {
+			sources["PolicyServer "+name] = messages(obj)
+		}
+
+		pods := &corev1.PodList{}
+		if err := c.Client.List(ctx, pods, client.MatchingLabels{PolicyServerLabel: name}); err != nil {
+			return false, err
+		}
+		for _, p := range pods.Items {
+			log, err := c.logs(ctx, p.Namespace, p.Name)
+			if err != nil {
+				return false, fmt.Errorf("cannot get the log of pod %s/%s: %w", p.Namespace, p.Name, err)
+			}
+			sources["pod "+p.Namespace+"/"+p.Name] = strings.Split(log, "\n")
+		}
+
+		// Sorted for a stable result
+		keys := make([]string, 0, len(sources))
+		for k := range sources {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, line := range sources[k] {
+				if pattern.MatchString(line) {
+					found = k + ": " + strings.TrimSpace(line)
+					return true, nil
+				}
+			}
+		}
+		return false, fmt.Errorf("no matching error in %v", keys)
+	})
+
+	return found, err
+}
@@ -0,0 +1,182 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubewarden
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newObject(kind Kind, namespace, name string, status map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{"status": status}}
+	obj.SetGroupVersionKind(kind.GroupVersionKind())
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func newFakeClient(objs ...client.Object) *Client {
+	c := NewForClient(fake.NewClientBuilder().WithObjects(objs...).Build())
+	c.Timeout = 200 * time.Millisecond
+	c.Interval = 10 * time.Millisecond
+	return c
+}
+
+func TestWaitPolicyActive(t *testing.T) {
+	g := NewWithT(t)
+
+	c := newFakeClient(
+		newObject(KindClusterAdmissionPolicy, "", "do-not-run-as-root", map[string]any{"policyStatus": "active"}),
+		newObject(KindAdmissionPolicy, "kubewarden", "pod-privileged", map[string]any{"policyStatus": "pending"}),
+	)
+
+	g.Expect(c.WaitPolicyActive(context.Background(), ClusterPolicy("do-not-run-as-root"))).To(Succeed())
+
+	err := c.WaitPolicyActive(context.Background(), Policy("kubewarden", "pod-privileged"))
+	g.Expect(err).To(MatchError(ContainSubstring(`policyStatus is "pending"`)))
+
+	err = c.WaitPolicyActive(context.Background(), ClusterPolicy("missing"))
+	g.Expect(err).To(MatchError(ContainSubstring("not found")))
+}
+
+func TestWaitPolicyServerReconciled(t *testing.T) {
+	g := NewWithT(t)
+
+	reconciled := []any{map[string]any{"type": "DeploymentReconciled", "status": "True"}}
+	failed := []any{map[string]any{"type": "DeploymentReconciled", "status": "False", "message": "image pull error"}}
+
+	c := newFakeClient(
+		newObject(KindPolicyServer, "", "default", map[string]any{"conditions": reconciled}),
+		newObject(KindPolicyServer, "", "production", map[string]any{"conditions": failed}),
+	)
+
+	g.Expect(c.WaitPolicyServerReconciled(context.Background(), "default")).To(Succeed())
+	g.Expect(c.WaitPolicyServerReconciled(context.Background(), "production")).
+		To(MatchError(ContainSubstring("DeploymentReconciled is False: image pull error")))
+}
+
+func TestList(t *testing.T) {
+	g := NewWithT(t)
+
+	c := newFakeClient(
+		newObject(KindClusterAdmissionPolicy, "", "a", nil),
+		newObject(KindClusterAdmissionPolicy, "", "b", nil),
+		newObject(KindAdmissionPolicy, "default", "c", nil),
+	)
+
+	caps, err := c.List(context.Background(), KindClusterAdmissionPolicy)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(caps).To(HaveLen(2))
+
+	aps, err := c.List(context.Background(), KindAdmissionPolicy, client.InNamespace("default"))
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(aps).To(HaveLen(1))
+}
+
+func TestKindResource(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(KindPolicyServer.Resource()).To(Equal("policyservers"))
+	g.Expect(KindClusterAdmissionPolicy.Resource()).To(Equal("clusteradmissionpolicies"))
+	g.Expect(KindAdmissionPolicyGroup.Resource()).To(Equal("admissionpolicygroups"))
+	g.Expect(Kind("Unknown").Resource()).To(BeEmpty())
+
+	kind, found := KindForResource("clusteradmissionpolicygroups")
+	g.Expect(found).To(BeTrue())
+	g.Expect(kind).To(Equal(KindClusterAdmissionPolicyGroup))
+	_, found = KindForResource("configmaps")
+	g.Expect(found).To(BeFalse())
+}
+
+func policyServerPod(name, node string, ready corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kubewarden", Name: name, Labels: map[string]string{PolicyServerLabel: "spread"}},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}}},
+	}
+}
+
+func TestWaitPolicyServerSpread(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	ps := NewPolicyServer("spread", "policy-server", 3)
+	g.Expect(SpreadAcrossNodes(ps)).To(Succeed())
+	terms, _, _ := unstructured.NestedSlice(ps.Object, "spec", "affinity", "podAntiAffinity", "requiredDuringSchedulingIgnoredDuringExecution")
+	g.Expect(terms).To(ConsistOf(HaveKeyWithValue("topologyKey", "kubernetes.io/hostname")))
+
+	c := newFakeClient(
+		policyServerPod("spread-a", "rancher-manager", corev1.ConditionTrue),
+		policyServerPod("spread-b", "agent-1", corev1.ConditionTrue),
+		policyServerPod("spread-c", "agent-2", corev1.ConditionTrue),
+	)
+	g.Expect(c.WaitPolicyServerSpread(ctx, "spread", 3)).To(Succeed())
+
+	c = newFakeClient(
+		policyServerPod("spread-a", "rancher-manager", corev1.ConditionTrue),
+		policyServerPod("spread-b", "rancher-manager", corev1.ConditionTrue),
+	)
+	g.Expect(c.WaitPolicyServerSpread(ctx, "spread", 2)).To(MatchError(ContainSubstring("2 ready pods on 1 nodes")))
+
+	c = newFakeClient(
+		policyServerPod("spread-a", "rancher-manager", corev1.ConditionTrue),
+		policyServerPod("spread-b", "agent-1", corev1.ConditionFalse),
+	)
+	g.Expect(c.WaitPolicyServerSpread(ctx, "spread", 2)).To(MatchError(ContainSubstring(`pod kubewarden/spread-b not ready on node "agent-1"`)))
+}
+
+func TestWaitPolicyServerError(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	certificate := regexp.MustCompile(`(?i)x509|certificate`)
+
+	pending := []any{map[string]any{"type": "PolicyActive", "status": "False", "message": "The policy webhook has not been created"}}
+	c := newFakeClient(
+		newObject(KindClusterAdmissionPolicy, "", "untrusted", map[string]any{"conditions": pending}),
+		newObject(KindPolicyServer, "", "spread", nil),
+		policyServerPod("spread-a", "rancher-manager", corev1.ConditionFalse),
+	)
+
+	// The policy-server fails to download the module
+	c.logs = func(context.Context, string, string) (string, error) {
+		return "INFO policy download\nERROR cannot download policy: error sending request: invalid peer certificate: UnknownIssuer\n", nil
+	}
+	found, err := c.WaitPolicyServerError(ctx, "spread", ClusterPolicy("untrusted"), certificate)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(found).To(Equal("pod kubewarden/spread-a: ERROR cannot download policy: error sending request: invalid peer certificate: UnknownIssuer"))
+
+	// Any other failure is not the expected one
+	c.logs = func(context.Context, string, string) (string, error) {
+		return "ERROR cannot download policy: connection refused\n", nil
+	}
+	_, err = c.WaitPolicyServerError(ctx, "spread", ClusterPolicy("untrusted"), certificate)
+	g.Expect(err).To(MatchError(ContainSubstring("no matching error in [ClusterAdmissionPolicy untrusted PolicyServer spread pod kubewarden/spread-a]")))
+
+	// The error can be reported in the status too
+	failed := []any{map[string]any{"type": "PolicyActive", "status": "False", "message": "tls: failed to verify certificate: x509: certificate signed by unknown authority"}}
+	c = newFakeClient(newObject(KindClusterAdmissionPolicy, "", "untrusted", map[string]any{"conditions": failed}))
+	found, err = c.WaitPolicyServerError(ctx, "untrusted", ClusterPolicy("untrusted"), certificate)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(found).To(HavePrefix("ClusterAdmissionPolicy untrusted: tls: failed to verify certificate"))
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubewarden
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// FieldChange is a field of an object which has been dropped or changed, e.g. by a newer controller
+type FieldChange struct {
+	// Path of the field, e.g. spec.env[0].value
+	Path   string
+	Before any
+	// Value after the change, nil if dropped
+	After   any
+	Dropped bool
+}
+
+func (c FieldChange) String() string {
+	if c.Dropped {
+		return fmt.Sprintf("%s dropped (was %v)", c.Path, c.Before)
+	}
+	return fmt.Sprintf("%s changed from %v to %v", c.Path, c.Before, c.After)
+}
+
+/*
+Compare the spec of two versions of an object
+  - @param before Object as stored, e.g. in a backup
+  - @param after Object as served now
+  - @returns The fields of the spec of before which are missing or different in after, sorted by path.
+    Fields only in after, e.g. defaulted by a newer CRD, are not reported.
+*/
+func CompareSpec(before, after *unstructured.Unstructured) []FieldChange {
+	changes := diffFields("spec", before.Object["spec"], after.Object["spec"], true)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func diffFields(path string, before, after any, found bool) []FieldChange {
+	if !found {
+		return []FieldChange{{Path: path, Before: before, Dropped: true}}
+	}
+
+	switch b := before.(type) {
+	case map[string]any:
+		a, ok := after.(map[string]any)
+		if !ok {
+			break
+		}
+		changes := []FieldChange{}
+		for k, v := range b {
+			av, found := a[k]
+			changes = append(changes, diffFields(joinPath(path, k), v, av, found)...)
+		}
+		return changes
+
+	case []any:
+		a, ok := after.([]any)
+		if !ok || len(a) != len(b) {
+			break
+		}
+		changes := []FieldChange{}
+		for i := range b {
+			changes = append(changes, diffFields(fmt.Sprintf("%s[%d]", path, i), b[i], a[i], true)...)
+		}
+		return changes
+
+	default:
+		// JSON numbers can be decoded as int64 or float64
+		if fmt.Sprint(before) == fmt.Sprint(after) {
+			return nil
+		}
+	}
+
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	return []FieldChange{{Path: path, Before: before, After: after}}
+}
+
+// joinPath quotes the keys holding dots, e.g. annotations or policy names
+func joinPath(path, key string) string {
+	if strings.Contains(key, ".") {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	return path + "." + key
+}
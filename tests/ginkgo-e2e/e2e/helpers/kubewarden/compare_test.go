@@ -0,0 +1,64 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubewarden
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCompareSpec(t *testing.T) {
+	g := NewWithT(t)
+
+	before := NewPolicyServer("migration", "ghcr.io/kubewarden/policy-server:v1.32.0", 2)
+	g.Expect(unstructured.SetNestedSlice(before.Object, []any{
+		map[string]any{"name": "KUBEWARDEN_LOG_LEVEL", "value": "debug"},
+	}, "spec", "env")).To(Succeed())
+	g.Expect(unstructured.SetNestedField(before.Object, "system-cluster-critical", "spec", "priorityClassName")).To(Succeed())
+	g.Expect(unstructured.SetNestedField(before.Object, "e2e", "spec", "annotations", "example.com/owner")).To(Succeed())
+
+	after := before.DeepCopy()
+	g.Expect(CompareSpec(before, after)).To(BeEmpty())
+
+	// Numbers decoded from JSON by another client
+	g.Expect(unstructured.SetNestedField(after.Object, float64(2), "spec", "replicas")).To(Succeed())
+	// New defaults are not reported
+	g.Expect(unstructured.SetNestedField(after.Object, "default", "spec", "serviceAccountName")).To(Succeed())
+	g.Expect(CompareSpec(before, after)).To(BeEmpty())
+
+	unstructured.RemoveNestedField(after.Object, "spec", "priorityClassName")
+	unstructured.RemoveNestedField(after.Object, "spec", "annotations", "example.com/owner")
+	g.Expect(unstructured.SetNestedSlice(after.Object, []any{map[string]any{"name": "KUBEWARDEN_LOG_LEVEL", "value": "info"}}, "spec", "env")).To(Succeed())
+
+	changes := CompareSpec(before, after)
+	g.Expect(changes).To(HaveLen(3))
+	g.Expect(changes[0].String()).To(Equal(`spec.annotations["example.com/owner"] dropped (was e2e)`))
+	g.Expect(changes[1].String()).To(Equal("spec.env[0].value changed from debug to info"))
+	g.Expect(changes[2]).To(And(HaveField("Path", "spec.priorityClassName"), HaveField("Dropped", true)))
+}
+
+func TestComparePolicyGroup(t *testing.T) {
+	g := NewWithT(t)
+
+	before := NewPodClusterPolicyGroup("migration-group", "default", "registry://ghcr.io/kubewarden/tests/pod-privileged:v0.2.5")
+	after := before.DeepCopy()
+	g.Expect(CompareSpec(before, after)).To(BeEmpty())
+
+	// A whole member dropped is reported once
+	unstructured.RemoveNestedField(after.Object, "spec", "policies", "privileged")
+	g.Expect(CompareSpec(before, after)).To(ConsistOf(HaveField("Path", "spec.policies.privileged")))
+}
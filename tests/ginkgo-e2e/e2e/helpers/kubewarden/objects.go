@@ -0,0 +1,113 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubewarden
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+/*
+Build a PolicyServer
+  - @param name Name of the PolicyServer
+  - @param image policy-server image
+  - @param replicas Number of replicas
+  - @returns The PolicyServer, other spec fields can be added with unstructured.SetNestedField
+*/
+func NewPolicyServer(name, image string, replicas int64) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"spec": map[string]any{
+			"image":    image,
+			"replicas": replicas,
+		},
+	}}
+	obj.SetGroupVersionKind(KindPolicyServer.GroupVersionKind())
+	obj.SetName(name)
+
+	return obj
+}
+
+// Label set by the controller on the pods of a PolicyServer
+const PolicyServerLabel = "kubewarden/policy-server"
+
+/*
+Require the replicas of a PolicyServer to run on different nodes
+  - @param obj PolicyServer, e.g. built with NewPolicyServer
+  - @returns Nothing or an error if the spec cannot be set
+*/
+func SpreadAcrossNodes(obj *unstructured.Unstructured) error {
+	affinity := map[string]any{
+		"podAntiAffinity": map[string]any{
+			"requiredDuringSchedulingIgnoredDuringExecution": []any{
+				map[string]any{
+					"labelSelector": map[string]any{"matchLabels": map[string]any{PolicyServerLabel: obj.GetName()}},
+					"topologyKey":   "kubernetes.io/hostname",
+				},
+			},
+		},
+	}
+	return unstructured.SetNestedField(obj.Object, affinity, "spec", "affinity")
+}
+
+/*
+Build a ClusterAdmissionPolicy validating pod creation and update
+  - @param name Name of the policy
+  - @param policyServer PolicyServer hosting the policy
+  - @param module URL of the policy module
+  - @returns The policy, other spec fields can be added with unstructured.SetNestedField
+*/
+func NewPodClusterPolicy(name, policyServer, module string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"spec": map[string]any{
+			"policyServer": policyServer,
+			"module":       module,
+			"mutating":     false,
+			"rules": []any{
+				map[string]any{
+					"apiGroups":   []any{""},
+					"apiVersions": []any{"v1"},
+					"resources":   []any{"pods"},
+					"operations":  []any{"CREATE", "UPDATE"},
+				},
+			},
+		},
+	}}
+	obj.SetGroupVersionKind(KindClusterAdmissionPolicy.GroupVersionKind())
+	obj.SetName(name)
+
+	return obj
+}
+
+/*
+Build a ClusterAdmissionPolicyGroup with a single member, validating pod creation and update
+  - @param name Name of the policy group
+  - @param policyServer PolicyServer hosting the policy group
+  - @param module URL of the module of the "privileged" member
+  - @returns The policy group, other spec fields can be added with unstructured.SetNestedField
+*/
+func NewPodClusterPolicyGroup(name, policyServer, module string) *unstructured.Unstructured {
+	obj := NewPodClusterPolicy(name, policyServer, module)
+	obj.SetGroupVersionKind(KindClusterAdmissionPolicyGroup.GroupVersionKind())
+
+	spec := obj.Object["spec"].(map[string]any)
+	delete(spec, "module")
+	delete(spec, "mutating")
+	spec["policies"] = map[string]any{
+		"privileged": map[string]any{"module": module},
+	}
+	spec["expression"] = "privileged()"
+	spec["message"] = "privileged pods are not allowed"
+
+	return obj
+}
@@ -0,0 +1,271 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubewarden
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Namespaces never deleted by a revert, even if created again after a cluster reset
+var protectedNamespaces = map[string]bool{
+	"default":         true,
+	"kube-node-lease": true,
+	"kube-public":     true,
+	"kube-system":     true,
+}
+
+// Snapshot is the state of the Kubewarden resources, bare pods and namespaces at a given time
+//
+// Resources managed by Helm are left out: they belong to a release and are reverted with it.
+// Only the pods without owner are tracked, the others are handled by their controller.
+type Snapshot struct {
+	// Kubewarden resources keyed by "kind/namespace/name"
+	Objects map[string]*unstructured.Unstructured
+	// Pods and namespaces keyed by UID, the ones not seen are deleted by a revert
+	Pods       map[types.UID]bool
+	Namespaces map[types.UID]bool
+}
+
+func objectKey(kind Kind, namespace, name string) string {
+	return string(kind) + "/" + namespace + "/" + name
+}
+
+func managedByHelm(obj client.Object) bool {
+	return obj.GetLabels()["app.kubernetes.io/managed-by"] == "Helm"
+}
+
+// snapshotKinds are the kinds in creation order, PolicyServers first
+func snapshotKinds() []Kind {
+	return append([]Kind{KindPolicyServer}, PolicyKinds...)
+}
+
+// listKind lists the resources of a kind, an uninstalled kind has no resources
+func (c *Client) listKind(ctx context.Context, kind Kind) ([]unstructured.Unstructured, error) {
+	objs, err := c.List(ctx, kind)
+	if meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	return objs, err
+}
+
+/*
+Record the current state of the cluster
+  - @returns The snapshot or an error
+*/
+func (c *Client) Snapshot(ctx context.Context) (*Snapshot, error) {
+	s := &Snapshot{
+		Objects:    map[string]*unstructured.Unstructured{},
+		Pods:       map[types.UID]bool{},
+		Namespaces: map[types.UID]bool{},
+	}
+
+	for _, kind := range snapshotKinds() {
+		objs, err := c.listKind(ctx, kind)
+		if err != nil {
+			return nil, err
+		}
+		for i := range objs {
+			if !managedByHelm(&objs[i]) {
+				s.Objects[objectKey(kind, objs[i].GetNamespace(), objs[i].GetName())] = objs[i].DeepCopy()
+			}
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := c.Client.List(ctx, pods); err != nil {
+		return nil, err
+	}
+	for _, p := range pods.Items {
+		if len(p.OwnerReferences) == 0 {
+			s.Pods[p.UID] = true
+		}
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := c.Client.List(ctx, namespaces); err != nil {
+		return nil, err
+	}
+	for _, ns := range namespaces.Items {
+		s.Namespaces[ns.UID] = true
+	}
+
+	return s, nil
+}
+
+// recreate prepares a recorded object to be created again
+func recreate(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	o := obj.DeepCopy()
+	o.SetResourceVersion("")
+	o.SetUID("")
+	o.SetCreationTimestamp(metav1.Time{})
+	o.SetManagedFields(nil)
+	o.SetFinalizers(nil)
+	unstructured.RemoveNestedField(o.Object, "status")
+	return o
+}
+
+/*
+Put the cluster back to a snapshot
+  - @param s Snapshot to revert to
+  - @returns Nothing or the errors met, the revert goes as far as possible
+*/
+func (c *Client) Revert(ctx context.Context, s *Snapshot) error {
+	var errs []error
+	kinds := snapshotKinds()
+
+	// Delete the new resources, policies before their PolicyServer
+	for i := len(kinds) - 1; i >= 0; i-- {
+		objs, err := c.listKind(ctx, kinds[i])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for j := range objs {
+			key := objectKey(kinds[i], objs[j].GetNamespace(), objs[j].GetName())
+			if s.Objects[key] != nil || managedByHelm(&objs[j]) {
+				continue
+			}
+			if err := c.Delete(ctx, &objs[j]); client.IgnoreNotFound(err) != nil {
+				errs = append(errs, fmt.Errorf("cannot delete %s: %w", key, err))
+			}
+		}
+	}
+
+	// Create the deleted resources and restore the modified ones
+	for _, kind := range kinds {
+		for _, key := range s.keys(kind) {
+			recorded := s.Objects[key]
+			current, err := c.Get(ctx, kind, recorded.GetNamespace(), recorded.GetName())
+			switch {
+			case apierrors.IsNotFound(err):
+				err = c.Create(ctx, recreate(recorded))
+			case err == nil && !equality.Semantic.DeepEqual(current.Object["spec"], recorded.Object["spec"]):
+				current.Object["spec"] = recorded.DeepCopy().Object["spec"]
+				err = c.Update(ctx, current)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("cannot revert %s: %w", key, err))
+			}
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := c.Client.List(ctx, pods); err != nil {
+		errs = append(errs, err)
+	}
+	for i := range pods.Items {
+		p := &pods.Items[i]
+		if len(p.OwnerReferences) > 0 || s.Pods[p.UID] {
+			continue
+		}
+		if err := c.Delete(ctx, p); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, fmt.Errorf("cannot delete pod %s/%s: %w", p.Namespace, p.Name, err))
+		}
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := c.Client.List(ctx, namespaces); err != nil {
+		errs = append(errs, err)
+	}
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		if s.Namespaces[ns.UID] || protectedNamespaces[ns.Name] {
+			continue
+		}
+		if err := c.Delete(ctx, ns); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, fmt.Errorf("cannot delete namespace %s: %w", ns.Name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return c.WaitSnapshot(ctx, s)
+}
+
+// keys returns the sorted keys of the recorded objects of a kind
+func (s *Snapshot) keys(kind Kind) []string {
+	keys := []string{}
+	for key, obj := range s.Objects {
+		if obj.GetKind() == string(kind) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/*
+Wait for the Kubewarden resources to match a snapshot and the PolicyServers to serve their recorded policies
+  - @param s Snapshot to wait for
+  - @returns An error with the differences on timeout
+*/
+func (c *Client) WaitSnapshot(ctx context.Context, s *Snapshot) error {
+	err := c.poll(ctx, "Kubewarden resources to match the snapshot", func(ctx context.Context) (bool, error) {
+		for _, kind := range snapshotKinds() {
+			objs, err := c.listKind(ctx, kind)
+			if err != nil {
+				return false, err
+			}
+
+			found := 0
+			for i := range objs {
+				if managedByHelm(&objs[i]) {
+					continue
+				}
+				key := objectKey(kind, objs[i].GetNamespace(), objs[i].GetName())
+				if s.Objects[key] == nil {
+					return false, fmt.Errorf("%s still exists", key)
+				}
+				found++
+			}
+			if found != len(s.keys(kind)) {
+				return false, fmt.Errorf("%d %s found, %d expected", found, kind, len(s.keys(kind)))
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The PolicyServers are rolled out again with their previous policy set
+	policies := 0
+	for _, key := range s.keys(KindPolicyServer) {
+		if err := c.WaitPolicyServerReconciled(ctx, s.Objects[key].GetName()); err != nil {
+			return err
+		}
+	}
+	for _, kind := range PolicyKinds {
+		policies += len(s.keys(kind))
+	}
+	if policies == 0 {
+		return nil
+	}
+
+	return c.WaitPolicies(ctx, DefaultPolicyConditions)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubewarden
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	reconciledStatus = map[string]any{
+		"conditions": []any{map[string]any{"type": "DeploymentReconciled", "status": "True"}},
+	}
+	readyPolicyStatus = map[string]any{
+		"policyStatus": "active",
+		"conditions": []any{
+			map[string]any{"type": ConditionPolicyActive, "status": "True"},
+			map[string]any{"type": ConditionPolicyUniquelyReachable, "status": "True"},
+		},
+	}
+)
+
+func withSpec(obj *unstructured.Unstructured, spec map[string]any) *unstructured.Unstructured {
+	obj.Object["spec"] = spec
+	return obj
+}
+
+func TestSnapshotRevert(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	helmPolicy := newObject(KindClusterAdmissionPolicy, "", "no-privileged-pod", readyPolicyStatus)
+	helmPolicy.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "Helm"})
+
+	c := newFakeClient(
+		newObject(KindPolicyServer, "", "production", reconciledStatus),
+		helmPolicy,
+		withSpec(newObject(KindAdmissionPolicy, "kubewarden", "pod-privileged", readyPolicyStatus),
+			map[string]any{"policyServer": "production", "mutating": false}),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kubewarden", UID: "ns-kubewarden"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "old", UID: "ns-old"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-privileged", Namespace: "kubewarden", UID: "pod-old"}},
+	)
+
+	s, err := c.Snapshot(ctx)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(s.Objects).To(HaveLen(2))
+	g.Expect(s.Namespaces).To(HaveKey(types.UID("ns-kubewarden")))
+	g.Expect(s.Pods).To(ConsistOf(true))
+
+	// Change the cluster during the spec
+	g.Expect(c.Create(ctx, newObject(KindPolicyServer, "", "extra", reconciledStatus))).To(Succeed())
+	g.Expect(c.Create(ctx, newObject(KindClusterAdmissionPolicy, "", "extra-policy", readyPolicyStatus))).To(Succeed())
+	policy, err := c.GetPolicy(ctx, Policy("kubewarden", "pod-privileged"))
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(unstructured.SetNestedField(policy.Object, true, "spec", "mutating")).To(Succeed())
+	g.Expect(c.Update(ctx, policy)).To(Succeed())
+	g.Expect(c.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tmp", UID: "ns-tmp"}})).To(Succeed())
+	g.Expect(c.Create(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-tmp", Namespace: "tmp", UID: "pod-tmp"}})).To(Succeed())
+	// Same names as before the snapshot, but created again during the spec
+	g.Expect(c.Client.Delete(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "old"}})).To(Succeed())
+	g.Expect(c.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "old", UID: "ns-new"}})).To(Succeed())
+	g.Expect(c.Create(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-new", Namespace: "kubewarden", UID: "pod-new"}})).To(Succeed())
+	g.Expect(c.Create(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            "policy-server-extra",
+		Namespace:       "kubewarden",
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "rs", UID: "1"}},
+	}})).To(Succeed())
+
+	g.Expect(c.Revert(ctx, s)).To(Succeed())
+
+	_, err = c.GetPolicyServer(ctx, "extra")
+	g.Expect(err).To(MatchError(ContainSubstring("not found")))
+	_, err = c.GetPolicy(ctx, ClusterPolicy("extra-policy"))
+	g.Expect(err).To(MatchError(ContainSubstring("not found")))
+	_, err = c.GetPolicy(ctx, ClusterPolicy("no-privileged-pod"))
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	policy, err = c.GetPolicy(ctx, Policy("kubewarden", "pod-privileged"))
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(policy.Object).To(HaveKeyWithValue("spec", HaveKeyWithValue("mutating", false)))
+
+	pods := &corev1.PodList{}
+	g.Expect(c.Client.List(ctx, pods)).To(Succeed())
+	g.Expect(pods.Items).To(HaveLen(2))
+	g.Expect(pods.Items).To(ContainElement(HaveField("Name", "policy-server-extra")))
+	g.Expect(pods.Items).To(ContainElement(HaveField("UID", types.UID("pod-old"))))
+
+	g.Expect(c.Client.Get(ctx, client.ObjectKey{Name: "tmp"}, &corev1.Namespace{})).To(MatchError(ContainSubstring("not found")))
+	g.Expect(c.Client.Get(ctx, client.ObjectKey{Name: "old"}, &corev1.Namespace{})).To(MatchError(ContainSubstring("not found")))
+	g.Expect(c.Client.Get(ctx, client.ObjectKey{Name: "kubewarden"}, &corev1.Namespace{})).To(Succeed())
+}
+
+func TestRevertRecreatesDeletedResources(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	production := newObject(KindPolicyServer, "", "production", reconciledStatus)
+	c := newFakeClient(production)
+
+	s, err := c.Snapshot(ctx)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(c.Delete(ctx, production)).To(Succeed())
+
+	// Nothing reconciles the PolicyServer in a fake cluster
+	g.Expect(c.Revert(ctx, s)).To(MatchError(ContainSubstring("DeploymentReconciled condition not set")))
+
+	ps, err := c.GetPolicyServer(ctx, "production")
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(ps.Object).To(Not(HaveKey("status")))
+}
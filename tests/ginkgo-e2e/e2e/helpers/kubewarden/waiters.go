@@ -0,0 +1,137 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubewarden
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Conditions set by the controller on the policies
+const (
+	ConditionPolicyActive            = "PolicyActive"
+	ConditionPolicyUniquelyReachable = "PolicyUniquelyReachable"
+)
+
+// DefaultPolicyConditions are the conditions of a policy ready to handle requests
+var DefaultPolicyConditions = []string{ConditionPolicyActive, ConditionPolicyUniquelyReachable}
+
+// StuckPolicy describes a policy which does not have the expected conditions
+type StuckPolicy struct {
+	Ref       PolicyRef
+	Condition string
+	Status    string
+	Message   string
+}
+
+func (s StuckPolicy) String() string {
+	if s.Status == "" {
+		return fmt.Sprintf("%s: condition %s not set", s.Ref, s.Condition)
+	}
+	return fmt.Sprintf("%s: condition %s is %s (%s)", s.Ref, s.Condition, s.Status, s.Message)
+}
+
+// PoliciesNotReadyError is returned when the policies do not reach the expected conditions in time
+type PoliciesNotReadyError struct {
+	Stuck []StuckPolicy
+	// Last error returned by the API server, if any
+	Err error
+}
+
+func (e *PoliciesNotReadyError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("policies not ready: %v", e.Err)
+	}
+
+	lines := []string{fmt.Sprintf("%d policies not ready:", len(e.Stuck))}
+	for _, s := range e.Stuck {
+		lines = append(lines, "  - "+s.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *PoliciesNotReadyError) Unwrap() error {
+	return e.Err
+}
+
+/*
+Check the conditions of all the policies, of every kind
+  - @param conditions Conditions that must be True
+  - @param opts List options to select a subset of the policies (labels, namespace, ...)
+  - @returns The policies without the expected conditions, or an error if nothing was found
+*/
+func (c *Client) StuckPolicies(ctx context.Context, conditions []string, opts ...client.ListOption) ([]StuckPolicy, error) {
+	var found int
+	stuck := []StuckPolicy{}
+
+	for _, kind := range PolicyKinds {
+		policies, err := c.List(ctx, kind, opts...)
+		if err != nil {
+			// Policy groups are not available on older Kubewarden versions
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for i := range policies {
+			found++
+			ref := PolicyRef{Kind: kind, Namespace: policies[i].GetNamespace(), Name: policies[i].GetName()}
+
+			for _, condType := range conditions {
+				status, message, _ := Condition(&policies[i], condType)
+				if status != "True" {
+					stuck = append(stuck, StuckPolicy{Ref: ref, Condition: condType, Status: status, Message: message})
+				}
+			}
+		}
+	}
+
+	if found == 0 {
+		return nil, errors.New("no policy found")
+	}
+
+	return stuck, nil
+}
+
+/*
+Wait for all the policies, or a selected subset, to have the expected conditions
+  - @param conditions Conditions that must be True, DefaultPolicyConditions if empty
+  - @param opts List options to select a subset of the policies (labels, namespace, ...)
+  - @returns A PoliciesNotReadyError listing the stuck policies on timeout
+*/
+func (c *Client) WaitPolicies(ctx context.Context, conditions []string, opts ...client.ListOption) error {
+	if len(conditions) == 0 {
+		conditions = DefaultPolicyConditions
+	}
+
+	notReady := &PoliciesNotReadyError{}
+	err := wait.PollUntilContextTimeout(ctx, c.Interval, c.Timeout, true, func(ctx context.Context) (bool, error) {
+		stuck, err := c.StuckPolicies(ctx, conditions, opts...)
+		notReady.Stuck, notReady.Err = stuck, err
+		return err == nil && len(stuck) == 0, nil
+	})
+	if err != nil {
+		return notReady
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubewarden
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func conditions(active, reachable string) map[string]any {
+	return map[string]any{"conditions": []any{
+		map[string]any{"type": ConditionPolicyActive, "status": active, "message": "active: " + active},
+		map[string]any{"type": ConditionPolicyUniquelyReachable, "status": reachable, "message": "reachable: " + reachable},
+	}}
+}
+
+func TestWaitPolicies(t *testing.T) {
+	g := NewWithT(t)
+
+	ready := newObject(KindClusterAdmissionPolicy, "", "ready", conditions("True", "True"))
+	ready.SetLabels(map[string]string{"e2e": "ready"})
+
+	c := newFakeClient(
+		ready,
+		newObject(KindAdmissionPolicy, "kubewarden", "unreachable", conditions("True", "False")),
+		newObject(KindClusterAdmissionPolicyGroup, "", "group", nil),
+	)
+
+	// Label selected subset
+	g.Expect(c.WaitPolicies(context.Background(), nil, client.MatchingLabels{"e2e": "ready"})).To(Succeed())
+
+	// All policies: report exactly the stuck ones
+	err := c.WaitPolicies(context.Background(), nil)
+	g.Expect(err).To(HaveOccurred())
+
+	var notReady *PoliciesNotReadyError
+	g.Expect(err).To(BeAssignableToTypeOf(notReady))
+	notReady = err.(*PoliciesNotReadyError)
+	g.Expect(notReady.Stuck).To(ConsistOf(
+		StuckPolicy{Ref: Policy("kubewarden", "unreachable"), Condition: ConditionPolicyUniquelyReachable, Status: "False", Message: "reachable: False"},
+		StuckPolicy{Ref: PolicyRef{Kind: KindClusterAdmissionPolicyGroup, Name: "group"}, Condition: ConditionPolicyActive},
+		StuckPolicy{Ref: PolicyRef{Kind: KindClusterAdmissionPolicyGroup, Name: "group"}, Condition: ConditionPolicyUniquelyReachable},
+	))
+	g.Expect(err.Error()).To(ContainSubstring("AdmissionPolicy kubewarden/unreachable: condition PolicyUniquelyReachable is False (reachable: False)"))
+
+	// Nothing selected
+	err = c.WaitPolicies(context.Background(), []string{ConditionPolicyActive}, client.MatchingLabels{"e2e": "none"})
+	g.Expect(err).To(MatchError(ContainSubstring("no policy found")))
+}
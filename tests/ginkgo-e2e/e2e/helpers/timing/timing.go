@@ -0,0 +1,134 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Budgets maps the text of a By step to its maximum duration
+type Budgets map[string]time.Duration
+
+// Step is a timed By step of a spec
+type Step struct {
+	Spec     string        `json:"spec"`
+	Text     string        `json:"text"`
+	Duration time.Duration `json:"duration"`
+	Budget   time.Duration `json:"budget,omitempty"`
+}
+
+// OverBudget returns true if the step has a budget and exceeded it
+func (s Step) OverBudget() bool {
+	return s.Budget > 0 && s.Duration > s.Budget
+}
+
+func (s Step) String() string {
+	return fmt.Sprintf("%q in %q took %s (budget %s)", s.Text, s.Spec, s.Duration.Round(time.Second), s.Budget)
+}
+
+/*
+Load the step budgets
+  - @param file YAML file with one "By text: duration" entry per step, ignored if empty
+  - @returns The budgets or an error
+*/
+func LoadBudgets(file string) (Budgets, error) {
+	budgets := Budgets{}
+	if file == "" {
+		return budgets, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read step budgets: %w", err)
+	}
+
+	raw := map[string]string{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("cannot parse step budgets %s: %w", file, err)
+	}
+
+	for text, value := range raw {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid budget for step %q: %w", text, err)
+		}
+		budgets[text] = d
+	}
+
+	return budgets, nil
+}
+
+/*
+Extract the By steps of all the specs
+  - @param report Ginkgo report of the suite
+  - @param budgets Budgets to attach to the steps, can be nil
+  - @returns The steps, in execution order
+*/
+func Steps(report types.Report, budgets Budgets) []Step {
+	steps := []Step{}
+
+	for _, spec := range report.SpecReports {
+		for _, event := range spec.SpecEvents.WithType(types.SpecEventByEnd) {
+			steps = append(steps, Step{
+				Spec:     spec.FullText(),
+				Text:     event.Message,
+				Duration: event.Duration,
+				Budget:   budgets[event.Message],
+			})
+		}
+	}
+
+	return steps
+}
+
+/*
+Get the steps over budget
+  - @param steps Steps to check
+  - @returns An error listing the steps over budget, nil if none
+*/
+func CheckBudgets(steps []Step) error {
+	over := []string{}
+	for _, s := range steps {
+		if s.OverBudget() {
+			over = append(over, s.String())
+		}
+	}
+
+	if len(over) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d steps over budget:\n  - %s", len(over), strings.Join(over, "\n  - "))
+}
+
+/*
+Write the steps in a JSON file
+  - @param steps Steps to write
+  - @param path Destination file
+  - @returns Nothing or an error
+*/
+func WriteJSON(steps []Step, path string) error {
+	data, err := json.MarshalIndent(steps, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timing
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onsi/ginkgo/v2/types"
+	. "github.com/onsi/gomega"
+)
+
+// byEnd is the event of a By step ending after d
+func byEnd(text string, d time.Duration) types.SpecEvent {
+	return types.SpecEvent{SpecEventType: types.SpecEventByEnd, Message: text, Duration: d}
+}
+
+func TestLoadBudgets(t *testing.T) {
+	g := NewWithT(t)
+
+	budgets, err := LoadBudgets("")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(budgets).To(BeEmpty())
+
+	file := filepath.Join(t.TempDir(), "step-budgets.yaml")
+	g.Expect(os.WriteFile(file, []byte("# comment\nInstalling Kubewarden stack: 10m\n\"Waiting: for nodes\": 1h30s\n"), 0644)).To(Succeed())
+	budgets, err = LoadBudgets(file)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(budgets).To(Equal(Budgets{
+		"Installing Kubewarden stack": 10 * time.Minute,
+		"Waiting: for nodes":          time.Hour + 30*time.Second,
+	}))
+
+	g.Expect(os.WriteFile(file, []byte("Installing Kubewarden stack: ten minutes\n"), 0644)).To(Succeed())
+	_, err = LoadBudgets(file)
+	g.Expect(err).To(MatchError(ContainSubstring(`invalid budget for step "Installing Kubewarden stack"`)))
+
+	g.Expect(os.WriteFile(file, []byte("- not a map\n"), 0644)).To(Succeed())
+	_, err = LoadBudgets(file)
+	g.Expect(err).To(MatchError(ContainSubstring("cannot parse step budgets")))
+
+	_, err = LoadBudgets(filepath.Join(t.TempDir(), "missing.yaml"))
+	g.Expect(err).To(MatchError(ContainSubstring("cannot read step budgets")))
+}
+
+func TestShippedBudgets(t *testing.T) {
+	g := NewWithT(t)
+
+	budgets, err := LoadBudgets("../../../assets/step-budgets.yaml")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(budgets).ToNot(BeEmpty())
+}
+
+func TestCheckBudgets(t *testing.T) {
+	g := NewWithT(t)
+
+	report := types.Report{SpecReports: types.SpecReports{
+		{
+			ContainerHierarchyTexts: []string{"Install"},
+			LeafNodeText:            "deploys Kubewarden",
+			SpecEvents: types.SpecEvents{
+				byEnd("Installing Kubewarden stack", 12*time.Minute),
+				{SpecEventType: types.SpecEventByStart, Message: "Installing Kubewarden stack"},
+				byEnd("Checking the policies", time.Minute),
+			},
+		},
+		{
+			LeafNodeText: "upgrades Kubewarden",
+			SpecEvents:   types.SpecEvents{byEnd("Upgrading admission controller", 4*time.Minute)},
+		},
+	}}
+	budgets := Budgets{
+		"Installing Kubewarden stack":    10 * time.Minute,
+		"Upgrading admission controller": 5 * time.Minute,
+	}
+
+	steps := Steps(report, budgets)
+	g.Expect(steps).To(Equal([]Step{
+		{Spec: "Install deploys Kubewarden", Text: "Installing Kubewarden stack", Duration: 12 * time.Minute, Budget: 10 * time.Minute},
+		// No budget, never over budget
+		{Spec: "Install deploys Kubewarden", Text: "Checking the policies", Duration: time.Minute},
+		{Spec: "upgrades Kubewarden", Text: "Upgrading admission controller", Duration: 4 * time.Minute, Budget: 5 * time.Minute},
+	}))
+	g.Expect(steps[1].OverBudget()).To(BeFalse())
+
+	err := CheckBudgets(steps)
+	g.Expect(err).To(MatchError(HavePrefix("1 steps over budget:")))
+	g.Expect(err.Error()).To(ContainSubstring(`"Installing Kubewarden stack" in "Install deploys Kubewarden" took 12m0s (budget 10m0s)`))
+	g.Expect(err.Error()).ToNot(ContainSubstring("Checking the policies"))
+
+	g.Expect(CheckBudgets(Steps(report, nil))).To(Succeed())
+	g.Expect(CheckBudgets(steps[1:])).To(Succeed())
+
+	file := filepath.Join(t.TempDir(), "steps.json")
+	g.Expect(WriteJSON(steps, file)).To(Succeed())
+	data, err := os.ReadFile(file)
+	g.Expect(err).ToNot(HaveOccurred())
+	written := []Step{}
+	g.Expect(json.Unmarshal(data, &written)).To(Succeed())
+	g.Expect(written).To(Equal(steps))
+}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package versions
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Charts holds the chart versions of a Kubewarden release
+type Charts struct {
+	CRDs       string `yaml:"crds"`
+	Controller string `yaml:"controller"`
+	Defaults   string `yaml:"defaults"`
+	// Single chart used by the airgap tests
+	AdmissionController string `yaml:"admissionController"`
+}
+
+// Images holds the image tags of a Kubewarden release
+type Images struct {
+	Controller   string `yaml:"controller"`
+	PolicyServer string `yaml:"policyServer"`
+	AuditScanner string `yaml:"auditScanner"`
+}
+
+// Release is a consistent set of Kubewarden versions
+type Release struct {
+	Version string `yaml:"-"`
+	Charts  Charts `yaml:"charts"`
+	Images  Images `yaml:"images"`
+	// Module tag of each recommended policy, keyed by its name in the chart values
+	Policies map[string]string `yaml:"policies"`
+}
+
+// Matrix maps a Kubewarden release to its versions
+type Matrix struct {
+	Releases map[string]*Release `yaml:"releases"`
+}
+
+/*
+Load the version matrix
+  - @param file YAML manifest
+  - @returns The matrix or an error
+*/
+func Load(file string) (*Matrix, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read version matrix: %w", err)
+	}
+
+	m := &Matrix{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("cannot parse version matrix %s: %w", file, err)
+	}
+
+	for v, r := range m.Releases {
+		if _, err := semver.NewVersion(v); err != nil {
+			return nil, fmt.Errorf("invalid release %q in version matrix: %w", v, err)
+		}
+		r.Version = v
+	}
+
+	return m, nil
+}
+
+// sorted returns the releases, highest version first
+func (m *Matrix) sorted() []*Release {
+	releases := make([]*Release, 0, len(m.Releases))
+	for _, r := range m.Releases {
+		releases = append(releases, r)
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		return semver.MustParse(releases[j].Version).LessThan(semver.MustParse(releases[i].Version))
+	})
+	return releases
+}
+
+/*
+Resolve a release
+  - @param release Exact version (1.33.1), partial version (1.33 for the latest 1.33.x) or "latest"
+  - @returns The highest matching release or an error
+*/
+func (m *Matrix) Resolve(release string) (*Release, error) {
+	release = strings.TrimPrefix(release, "v")
+
+	if r, ok := m.Releases[release]; ok {
+		return r, nil
+	}
+
+	constraint := "*"
+	if release != "latest" {
+		constraint = "~" + release
+	}
+
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid release %q: %w", release, err)
+	}
+
+	for _, r := range m.sorted() {
+		if c.Check(semver.MustParse(r.Version)) {
+			return r, nil
+		}
+	}
+
+	return nil, fmt.Errorf("release %q not found in version matrix", release)
+}
+
+/*
+Get the release preceding another one
+  - @param r Reference release
+  - @returns The highest release lower than r or an error
+*/
+func (m *Matrix) Previous(r *Release) (*Release, error) {
+	current := semver.MustParse(r.Version)
+	for _, p := range m.sorted() {
+		if semver.MustParse(p.Version).LessThan(current) {
+			return p, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no release before %s in version matrix", r.Version)
+}
+
+/*
+Get the Helm values setting the recommended policies module tags
+  - @returns --set values, sorted by policy name
+*/
+func (r *Release) PolicyValues() []string {
+	names := make([]string, 0, len(r.Policies))
+	for name := range r.Policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := []string{}
+	for _, name := range names {
+		values = append(values, "recommendedPolicies."+name+".module.tag="+r.Policies[name])
+	}
+	return values
+}
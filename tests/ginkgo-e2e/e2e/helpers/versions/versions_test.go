@@ -0,0 +1,91 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package versions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const matrix = `
+releases:
+  "1.32.0":
+    images:
+      controller: v1.32.0
+  "1.33.0":
+    images:
+      controller: v1.33.0
+  "1.33.1":
+    images:
+      controller: v1.33.1
+    policies:
+      podPrivilegedPolicy: v1.0.6
+      capabilitiesPolicy: v1.0.5
+`
+
+func TestResolve(t *testing.T) {
+	g := NewWithT(t)
+
+	file := filepath.Join(t.TempDir(), "versions.yaml")
+	g.Expect(os.WriteFile(file, []byte(matrix), 0644)).To(Succeed())
+
+	m, err := Load(file)
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	for release, expected := range map[string]string{
+		"1.33.0": "1.33.0",
+		"v1.32":  "1.32.0",
+		"1.33":   "1.33.1",
+		"1":      "1.33.1",
+		"latest": "1.33.1",
+	} {
+		r, err := m.Resolve(release)
+		g.Expect(err).To(Not(HaveOccurred()), release)
+		g.Expect(r.Version).To(Equal(expected), release)
+	}
+
+	_, err = m.Resolve("1.40")
+	g.Expect(err).To(MatchError(ContainSubstring("not found")))
+
+	r, _ := m.Resolve("latest")
+	prev, err := m.Previous(r)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(prev.Version).To(Equal("1.33.0"))
+
+	g.Expect(r.PolicyValues()).To(Equal([]string{
+		"recommendedPolicies.capabilitiesPolicy.module.tag=v1.0.5",
+		"recommendedPolicies.podPrivilegedPolicy.module.tag=v1.0.6",
+	}))
+}
+
+func TestShippedMatrix(t *testing.T) {
+	g := NewWithT(t)
+
+	m, err := Load("../../../assets/versions.yaml")
+	g.Expect(err).To(Not(HaveOccurred()))
+
+	for v, r := range m.Releases {
+		g.Expect(r.Charts.CRDs).To(Not(BeEmpty()), v)
+		g.Expect(r.Charts.Controller).To(Not(BeEmpty()), v)
+		g.Expect(r.Charts.Defaults).To(Not(BeEmpty()), v)
+		g.Expect(r.Images.Controller).To(Not(BeEmpty()), v)
+		g.Expect(r.Images.PolicyServer).To(Not(BeEmpty()), v)
+		g.Expect(r.Images.AuditScanner).To(Not(BeEmpty()), v)
+		g.Expect(r.Policies).To(HaveLen(6), v)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+)
+
+// Fake is an in-memory Provider, for the unit tests of the VM orchestration
+type Fake struct {
+	// Calls made, e.g. "CreateVM rancher-manager"
+	Calls     []string
+	Networks  map[string]assets.Network
+	VMs       map[string]Spec
+	Snapshots map[string][]string
+	// Errors to return, keyed like the calls
+	Errors map[string]error
+}
+
+// NewFake returns a Fake without networks nor VMs
+func NewFake() *Fake {
+	return &Fake{
+		Networks:  map[string]assets.Network{},
+		VMs:       map[string]Spec{},
+		Snapshots: map[string][]string{},
+		Errors:    map[string]error{},
+	}
+}
+
+// call records a call and returns its error, if any
+func (f *Fake) call(method, name string) error {
+	c := method + " " + name
+	f.Calls = append(f.Calls, c)
+	return f.Errors[c]
+}
+
+func (f *Fake) DefineNetwork(_ context.Context, net assets.Network) error {
+	if err := f.call("DefineNetwork", net.Name); err != nil {
+		return err
+	}
+	f.Networks[net.Name] = net
+	return nil
+}
+
+func (f *Fake) CreateVM(_ context.Context, spec Spec) error {
+	if err := f.call("CreateVM", spec.Name); err != nil {
+		return err
+	}
+	if _, found := f.VMs[spec.Name]; found {
+		return fmt.Errorf("VM %s already exists", spec.Name)
+	}
+	if _, found := f.Networks[spec.Network]; !found {
+		return fmt.Errorf("network %s not found", spec.Network)
+	}
+	f.VMs[spec.Name] = spec
+	return nil
+}
+
+func (f *Fake) WaitSSH(_ context.Context, spec Spec) (*tools.Client, error) {
+	if err := f.call("WaitSSH", spec.Name); err != nil {
+		return nil, err
+	}
+	if _, found := f.VMs[spec.Name]; !found {
+		return nil, fmt.Errorf("VM %s not found", spec.Name)
+	}
+	return spec.SSHClient(), nil
+}
+
+func (f *Fake) ListVMs(_ context.Context, network string) ([]string, error) {
+	if err := f.call("ListVMs", network); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name, spec := range f.VMs {
+		if spec.Network == network {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *Fake) Destroy(_ context.Context, name string) error {
+	if err := f.call("Destroy", name); err != nil {
+		return err
+	}
+	delete(f.VMs, name)
+	delete(f.Snapshots, name)
+	return nil
+}
+
+func (f *Fake) Snapshot(_ context.Context, name, snapshot string) error {
+	if err := f.call("Snapshot", name); err != nil {
+		return err
+	}
+	if _, found := f.VMs[name]; !found {
+		return fmt.Errorf("VM %s not found", name)
+	}
+	f.Snapshots[name] = append(f.Snapshots[name], snapshot)
+	return nil
+}
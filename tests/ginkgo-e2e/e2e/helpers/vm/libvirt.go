@@ -0,0 +1,169 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+	"github.com/rancher/elemental/tests/e2e/helpers/common"
+)
+
+// Libvirt manages the VMs with virsh and virt-install
+type Libvirt struct {
+	// Template of the networks, see assets.Network
+	NetworkTemplate string
+	// Directory of the rendered networks
+	Dir string
+	// Run virsh and virt-install with sudo
+	Sudo bool
+	Exec common.Executor
+	// Time given to a destroyed network to disappear, and to a VM to accept SSH connections
+	NetworkTimeout time.Duration
+	SSHTimeout     time.Duration
+	Interval       time.Duration
+}
+
+/*
+Create a libvirt provider
+  - @param networkTemplate Path of assets/net-default-airgap.xml
+  - @param dir Directory of the rendered networks
+  - @returns The provider, running the commands with sudo
+*/
+func NewLibvirt(networkTemplate, dir string) *Libvirt {
+	return &Libvirt{
+		NetworkTemplate: networkTemplate,
+		Dir:             dir,
+		Sudo:            true,
+		Exec:            common.Run,
+		NetworkTimeout:  2 * time.Minute,
+		SSHTimeout:      10 * time.Minute,
+		Interval:        5 * time.Second,
+	}
+}
+
+func (l *Libvirt) run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if l.Sudo {
+		return l.Exec(ctx, "sudo", append([]string{name}, args...)...)
+	}
+	return l.Exec(ctx, name, args...)
+}
+
+func (l *Libvirt) DefineNetwork(ctx context.Context, net assets.Network) error {
+	// Don't check the errors, as the network could be already removed
+	for _, c := range []string{"net-destroy", "net-undefine"} {
+		_, _ = l.run(ctx, "virsh", c, net.Name)
+	}
+
+	// net-create fails while the previous network is being removed
+	err := common.Poll(ctx, l.Interval, l.NetworkTimeout, "network "+net.Name+" to be removed", func(ctx context.Context) (bool, error) {
+		_, err := l.run(ctx, "virsh", "net-info", net.Name)
+		if err == nil {
+			return false, fmt.Errorf("network %s still exists", net.Name)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r := &assets.Renderer{Dir: l.Dir}
+	file, err := r.RenderFile(l.NetworkTemplate, net)
+	if err != nil {
+		return err
+	}
+	_, err = l.run(ctx, "virsh", "net-create", file)
+	return err
+}
+
+func (l *Libvirt) CreateVM(ctx context.Context, spec Spec) error {
+	if spec.BaseImage != "" {
+		if _, err := l.run(ctx, "qemu-img", "create", "-f", "qcow2", "-F", "qcow2", "-b", spec.BaseImage, spec.Disk); err != nil {
+			return err
+		}
+	}
+
+	_, err := l.run(ctx, "virt-install",
+		"--name", spec.Name,
+		"--memory", strconv.Itoa(spec.MemoryMiB),
+		"--vcpus", strconv.Itoa(spec.VCPUs),
+		"--disk", "path="+spec.Disk+",bus=sata",
+		"--import",
+		"--os-variant", spec.OSVariant,
+		"--network="+spec.Network+",mac="+spec.MAC,
+		"--noautoconsole")
+	return err
+}
+
+func (l *Libvirt) WaitSSH(ctx context.Context, spec Spec) (*tools.Client, error) {
+	c := spec.SSHClient()
+
+	err := common.Poll(ctx, l.Interval, l.SSHTimeout, "SSH on "+spec.Name, func(context.Context) (bool, error) {
+		out, err := c.RunSSH("echo SSH_OK")
+		if err != nil {
+			return false, err
+		}
+		return strings.TrimSpace(out) == "SSH_OK", nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (l *Libvirt) ListVMs(ctx context.Context, network string) ([]string, error) {
+	out, err := l.run(ctx, "virsh", "list", "--all", "--name")
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, name := range strings.Fields(string(out)) {
+		// The columns are Interface, Type, Source, Model and MAC
+		ifaces, err := l.run(ctx, "virsh", "domiflist", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(ifaces), "\n") {
+			if f := strings.Fields(line); len(f) >= 3 && f[1] == "network" && f[2] == network {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+func (l *Libvirt) Destroy(ctx context.Context, name string) error {
+	if _, err := l.run(ctx, "virsh", "dominfo", name); err != nil {
+		// No such VM
+		return nil
+	}
+
+	// Don't check the error, as the VM could be already stopped
+	_, _ = l.run(ctx, "virsh", "destroy", name)
+	_, err := l.run(ctx, "virsh", "undefine", name, "--snapshots-metadata")
+	return err
+}
+
+func (l *Libvirt) Snapshot(ctx context.Context, name, snapshot string) error {
+	_, err := l.run(ctx, "virsh", "snapshot-create-as", "--domain", name, "--name", snapshot)
+	return err
+}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vm
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+)
+
+// Spec describes a VM booted from an existing disk image
+type Spec struct {
+	Name      string
+	MemoryMiB int
+	VCPUs     int
+	// Disk image, imported as is
+	Disk string
+	// Optional image shared by several VMs, Disk is then created as a copy-on-write overlay of it
+	BaseImage string
+	OSVariant string
+	// Network the VM is attached to, with a fixed address
+	Network string
+	MAC     string
+	IP      string
+	// SSH credentials
+	User     string
+	Password string
+}
+
+// SSHClient returns the SSH client of the VM
+func (s Spec) SSHClient() *tools.Client {
+	return &tools.Client{Host: s.IP + ":22", Username: s.User, Password: s.Password}
+}
+
+// Provider manages the networks and the VMs of the specs
+type Provider interface {
+	// DefineNetwork creates the network, replacing the one of the same name
+	DefineNetwork(ctx context.Context, net assets.Network) error
+	// CreateVM creates and starts the VM
+	CreateVM(ctx context.Context, spec Spec) error
+	// WaitSSH waits for the VM to accept SSH connections
+	WaitSSH(ctx context.Context, spec Spec) (*tools.Client, error)
+	// ListVMs lists the VMs attached to the network, running or not
+	ListVMs(ctx context.Context, network string) ([]string, error)
+	// Destroy stops and removes the VM, nothing is done if it does not exist
+	Destroy(ctx context.Context, name string) error
+	// Snapshot takes a named snapshot of the VM
+	Snapshot(ctx context.Context, name, snapshot string) error
+}
+
+/*
+Check that the VMs have the fixed addresses of the network
+  - @param net Network of the VMs
+  - @param vms VMs to deploy
+  - @returns Nothing or an error for the first VM without a matching host
+*/
+func Validate(net assets.Network, vms ...Spec) error {
+	for _, v := range vms {
+		if v.Network != net.Name {
+			return fmt.Errorf("VM %s is attached to network %q, expected %q", v.Name, v.Network, net.Name)
+		}
+
+		found := false
+		for _, h := range net.Hosts {
+			found = found || (h.Name == v.Name && h.MAC == v.MAC && h.IP == v.IP)
+		}
+		if !found {
+			return fmt.Errorf("no host %s with MAC %s and IP %s in network %s", v.Name, v.MAC, v.IP, net.Name)
+		}
+	}
+	return nil
+}
+
+/*
+Deploy VMs on a new network, the leftovers of a previous run are removed first, with any other VM of the network
+  - @param p Provider of the VMs
+  - @param net Network of the VMs, it must list their addresses
+  - @param vms VMs to deploy
+  - @returns The SSH clients of the VMs, in the same order, or an error
+*/
+func Deploy(ctx context.Context, p Provider, net assets.Network, vms ...Spec) ([]*tools.Client, error) {
+	if err := Validate(net, vms...); err != nil {
+		return nil, err
+	}
+
+	// The network cannot be replaced while VMs are attached to it,
+	// e.g. the agents of a previous run with more agents
+	attached, err := p.ListVMs(ctx, net.Name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list the VMs of network %s: %w", net.Name, err)
+	}
+	names := []string{}
+	for _, v := range vms {
+		names = append(names, v.Name)
+	}
+	for _, name := range attached {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if err := p.Destroy(ctx, name); err != nil {
+			return nil, fmt.Errorf("cannot destroy VM %s: %w", name, err)
+		}
+	}
+
+	if err := p.DefineNetwork(ctx, net); err != nil {
+		return nil, fmt.Errorf("cannot define network %s: %w", net.Name, err)
+	}
+
+	for _, v := range vms {
+		if err := p.CreateVM(ctx, v); err != nil {
+			return nil, fmt.Errorf("cannot create VM %s: %w", v.Name, err)
+		}
+	}
+
+	// The VMs boot in parallel, wait for them once all are created
+	clients := []*tools.Client{}
+	for _, v := range vms {
+		c, err := p.WaitSSH(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("VM %s is not reachable: %w", v.Name, err)
+		}
+		clients = append(clients, c)
+	}
+
+	return clients, nil
+}
@@ -0,0 +1,205 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+)
+
+const networkTemplate = "../../../assets/net-default-airgap.xml"
+
+func testNetwork() assets.Network {
+	return assets.Network{
+		Name: "default", Bridge: "virbr0", ForwardDev: "eth0",
+		Address: "192.168.122.1", Netmask: "255.255.255.0", DHCPStart: "192.168.122.2", DHCPEnd: "192.168.122.191",
+		Hosts: []assets.NetworkHost{
+			{Name: "rancher-manager", Hostname: "rancher-manager.test", MAC: "52:54:00:00:00:10", IP: "192.168.122.102"},
+			{Name: "agent-1", Hostname: "agent-1.test", MAC: "52:54:00:00:00:11", IP: "192.168.122.103"},
+		},
+	}
+}
+
+func testVMs() []Spec {
+	return []Spec{
+		{Name: "rancher-manager", MemoryMiB: 16384, VCPUs: 4, Disk: "/tmp/server.qcow2", OSVariant: "opensuse-unknown",
+			Network: "default", MAC: "52:54:00:00:00:10", IP: "192.168.122.102", User: "root", Password: "root"},
+		{Name: "agent-1", MemoryMiB: 4096, VCPUs: 2, Disk: "/tmp/agent-1.qcow2", BaseImage: "/tmp/server.qcow2", OSVariant: "opensuse-unknown",
+			Network: "default", MAC: "52:54:00:00:00:11", IP: "192.168.122.103", User: "root", Password: "root"},
+	}
+}
+
+func TestDeploy(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	f := NewFake()
+	// Leftovers of a previous run, with more agents, and a VM of another network
+	f.VMs["rancher-manager"] = Spec{Name: "rancher-manager", Network: "default"}
+	f.VMs["agent-2"] = Spec{Name: "agent-2", Network: "default"}
+	f.VMs["builder"] = Spec{Name: "builder", Network: "isolated"}
+
+	clients, err := Deploy(ctx, f, testNetwork(), testVMs()...)
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(f.Calls).To(Equal([]string{
+		"ListVMs default",
+		"Destroy rancher-manager", "Destroy agent-1", "Destroy agent-2",
+		"DefineNetwork default",
+		"CreateVM rancher-manager", "CreateVM agent-1",
+		"WaitSSH rancher-manager", "WaitSSH agent-1",
+	}))
+	g.Expect(clients).To(HaveLen(2))
+	g.Expect(clients[0].Host).To(Equal("192.168.122.102:22"))
+	g.Expect(clients[1].Host).To(Equal("192.168.122.103:22"))
+	g.Expect(f.VMs["rancher-manager"].Disk).To(Equal("/tmp/server.qcow2"))
+	g.Expect(f.VMs).To(HaveKey("builder"))
+	g.Expect(f.VMs).To(Not(HaveKey("agent-2")))
+
+	g.Expect(f.Snapshot(ctx, "agent-1", "installed")).To(Succeed())
+	g.Expect(f.Snapshots["agent-1"]).To(Equal([]string{"installed"}))
+}
+
+func TestDeployErrors(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// Nothing is done for an address missing from the network
+	f := NewFake()
+	vms := testVMs()
+	vms[1].IP = "192.168.122.104"
+	_, err := Deploy(ctx, f, testNetwork(), vms...)
+	g.Expect(err).To(MatchError(ContainSubstring("no host agent-1 with MAC 52:54:00:00:00:11 and IP 192.168.122.104")))
+	g.Expect(f.Calls).To(BeEmpty())
+
+	vms = testVMs()
+	vms[0].Network = "isolated"
+	_, err = Deploy(ctx, f, testNetwork(), vms...)
+	g.Expect(err).To(MatchError(ContainSubstring(`attached to network "isolated"`)))
+
+	// A VM failing to boot is reported, the others are still created
+	f.Errors["WaitSSH agent-1"] = errors.New("timed out")
+	_, err = Deploy(ctx, f, testNetwork(), testVMs()...)
+	g.Expect(err).To(MatchError("VM agent-1 is not reachable: timed out"))
+	g.Expect(f.VMs).To(HaveLen(2))
+
+	f = NewFake()
+	f.Errors["ListVMs default"] = errors.New("virsh list failed")
+	_, err = Deploy(ctx, f, testNetwork(), testVMs()...)
+	g.Expect(err).To(MatchError(ContainSubstring("cannot list the VMs of network default")))
+	g.Expect(f.Calls).To(Equal([]string{"ListVMs default"}))
+
+	f = NewFake()
+	f.Errors["CreateVM rancher-manager"] = errors.New("no space left")
+	_, err = Deploy(ctx, f, testNetwork(), testVMs()...)
+	g.Expect(err).To(MatchError(ContainSubstring("cannot create VM rancher-manager")))
+	g.Expect(f.Calls).To(Not(ContainElement("CreateVM agent-1")))
+}
+
+// recorder is an Executor keeping the commands, the ones in failing return an error, the ones in outputs their output
+type recorder struct {
+	commands []string
+	failing  map[string]bool
+	outputs  map[string]string
+}
+
+func (r *recorder) exec(_ context.Context, name string, args ...string) ([]byte, error) {
+	cmd := name + " " + strings.Join(args, " ")
+	r.commands = append(r.commands, cmd)
+	if r.failing[cmd] {
+		return nil, errors.New(cmd + " failed")
+	}
+	return []byte(r.outputs[cmd]), nil
+}
+
+func TestLibvirt(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	l := NewLibvirt(networkTemplate, t.TempDir())
+	l.Interval = time.Millisecond
+	r := &recorder{failing: map[string]bool{
+		"sudo virsh net-destroy default": true,
+		"sudo virsh net-info default":    true,
+		"sudo virsh dominfo agent-1":     true,
+	}}
+	l.Exec = r.exec
+
+	g.Expect(l.DefineNetwork(ctx, testNetwork())).To(Succeed())
+	g.Expect(r.commands).To(HaveLen(4))
+	g.Expect(r.commands[:3]).To(Equal([]string{
+		"sudo virsh net-destroy default",
+		"sudo virsh net-undefine default",
+		"sudo virsh net-info default",
+	}))
+	g.Expect(r.commands[3]).To(HavePrefix("sudo virsh net-create " + l.Dir))
+
+	// The network is rendered from the typed spec
+	data, err := os.ReadFile(strings.TrimPrefix(r.commands[3], "sudo virsh net-create "))
+	g.Expect(err).To(Not(HaveOccurred()))
+	g.Expect(string(data)).To(ContainSubstring("<host mac='52:54:00:00:00:11' name='agent-1' ip='192.168.122.103'/>"))
+
+	r.commands = nil
+	g.Expect(l.CreateVM(ctx, testVMs()[0])).To(Succeed())
+	g.Expect(l.CreateVM(ctx, testVMs()[1])).To(Succeed())
+	g.Expect(l.Destroy(ctx, "agent-1")).To(Succeed())
+	g.Expect(l.Destroy(ctx, "rancher-manager")).To(Succeed())
+	g.Expect(l.Snapshot(ctx, "rancher-manager", "installed")).To(Succeed())
+	g.Expect(r.commands).To(Equal([]string{
+		"sudo virt-install --name rancher-manager --memory 16384 --vcpus 4 --disk path=/tmp/server.qcow2,bus=sata" +
+			" --import --os-variant opensuse-unknown --network=default,mac=52:54:00:00:00:10 --noautoconsole",
+		"sudo qemu-img create -f qcow2 -F qcow2 -b /tmp/server.qcow2 /tmp/agent-1.qcow2",
+		"sudo virt-install --name agent-1 --memory 4096 --vcpus 2 --disk path=/tmp/agent-1.qcow2,bus=sata" +
+			" --import --os-variant opensuse-unknown --network=default,mac=52:54:00:00:00:11 --noautoconsole",
+		"sudo virsh dominfo agent-1",
+		"sudo virsh dominfo rancher-manager",
+		"sudo virsh destroy rancher-manager",
+		"sudo virsh undefine rancher-manager --snapshots-metadata",
+		"sudo virsh snapshot-create-as --domain rancher-manager --name installed",
+	}))
+
+	// VMs of the network, whatever their state
+	r = &recorder{outputs: map[string]string{
+		"sudo virsh list --all --name": "rancher-manager\nagent-2\nbuilder\n\n",
+		"sudo virsh domiflist rancher-manager": ` Interface   Type      Source    Model    MAC
+-------------------------------------------------------------
+ vnet0       network   default   virtio   52:54:00:00:00:10
+`,
+		// Stopped VM
+		"sudo virsh domiflist agent-2": ` Interface   Type      Source    Model    MAC
+-------------------------------------------------------------
+ -           network   default   virtio   52:54:00:00:00:12
+`,
+		"sudo virsh domiflist builder": ` Interface   Type      Source     Model    MAC
+-------------------------------------------------------------
+ vnet1       network   isolated   virtio   52:54:00:00:00:20
+`,
+	}}
+	l.Exec = r.exec
+	g.Expect(l.ListVMs(ctx, "default")).To(Equal([]string{"rancher-manager", "agent-2"}))
+
+	// The previous network must be gone before the new one is created
+	l.NetworkTimeout = 20 * time.Millisecond
+	r = &recorder{}
+	l.Exec = r.exec
+	g.Expect(l.DefineNetwork(ctx, testNetwork())).To(MatchError("timed out waiting for network default to be removed: network default still exists"))
+	g.Expect(r.commands).To(Not(ContainElement(HavePrefix("sudo virsh net-create"))))
+}
@@ -0,0 +1,192 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/backup"
+	"github.com/rancher/elemental/tests/e2e/helpers/install"
+	"github.com/rancher/elemental/tests/e2e/helpers/kubewarden"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	migrationPolicyServer     = "migration"
+	migrationPolicy           = "migration-no-privileged-pod"
+	migrationPolicyGroup      = "migration-group"
+	migrationNamespacedPolicy = "migration-namespaced"
+)
+
+// Fields which must survive a migration, a change in any other field is only reported
+var migrationKeyFields = []string{
+	"spec.image",
+	"spec.replicas",
+	"spec.env",
+	"spec.module",
+	"spec.policyServer",
+	"spec.rules",
+	"spec.settings",
+	"spec.policies",
+	"spec.expression",
+	"spec.mode",
+}
+
+func isMigrationKeyField(path string) bool {
+	for _, f := range migrationKeyFields {
+		if path == f || strings.HasPrefix(path, f+".") || strings.HasPrefix(path, f+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+var _ = Describe("E2E - Restore a backup onto a newer Kubewarden release", Label("test-migration-backup-restore"), func() {
+	// Create kubectl context
+	// Default timeout is too small, so New() cannot be used
+	k := &kubectl.Kubectl{
+		Namespace:    "",
+		PollTimeout:  tools.SetTimeout(300 * time.Second),
+		PollInterval: 500 * time.Millisecond,
+	}
+
+	It("Restore the Kubewarden resources of release N-1 onto release N", func(ctx SpecContext) {
+		// Other install modes pin their own versions, not the ones of the matrix
+		if cfg.InstallMode != "" && cfg.InstallMode != install.ModeUpstream {
+			Skip("migration between matrix releases requires the upstream install mode")
+		}
+
+		var (
+			from, to   *versions.Release
+			backupFile string
+		)
+
+		By("Selecting the releases from the version matrix", func() {
+			from, to = SelectReleases()
+			GinkgoWriter.Printf("Restoring a backup of Kubewarden %s onto %s\n", from.Version, to.Version)
+		})
+
+		By("Installing Kubewarden N-1 on a new cluster", func() {
+			ResetCluster(ctx)
+			InstallBackupOperator(ctx, k)
+			InstallKubewarden(ctx, k, from)
+		})
+
+		By("Deploying a policy-server, a policy group and policies on release N-1", func() {
+			kw := NewKubewardenClient()
+
+			ps := kubewarden.NewPolicyServer(migrationPolicyServer, "ghcr.io/kubewarden/policy-server:"+from.Images.PolicyServer, 1)
+			Expect(unstructured.SetNestedSlice(ps.Object, []any{
+				map[string]any{"name": "KUBEWARDEN_LOG_LEVEL", "value": "debug"},
+			}, "spec", "env")).To(Succeed())
+			Expect(unstructured.SetNestedField(ps.Object, "e2e", "spec", "annotations", "kubewarden.io/migration")).To(Succeed())
+			Expect(unstructured.SetNestedField(ps.Object, map[string]any{"cpu": "100m", "memory": "64Mi"}, "spec", "requests")).To(Succeed())
+			Expect(unstructured.SetNestedField(ps.Object, map[string]any{"memory": "512Mi"}, "spec", "limits")).To(Succeed())
+			Expect(unstructured.SetNestedSlice(ps.Object, []any{
+				map[string]any{"key": "kubewarden.io/migration", "operator": "Exists", "effect": "NoSchedule"},
+			}, "spec", "tolerations")).To(Succeed())
+			Expect(kw.Create(ctx, ps)).To(Succeed())
+
+			Expect(kw.Create(ctx, kubewarden.NewPodClusterPolicy(migrationPolicy, migrationPolicyServer, podPrivilegedModule))).To(Succeed())
+			Expect(kw.Create(ctx, kubewarden.NewPodClusterPolicyGroup(migrationPolicyGroup, migrationPolicyServer, podPrivilegedModule))).To(Succeed())
+
+			policy := kubewarden.NewPodClusterPolicy(migrationNamespacedPolicy, migrationPolicyServer, podPrivilegedModule)
+			policy.SetGroupVersionKind(kubewarden.KindAdmissionPolicy.GroupVersionKind())
+			policy.SetNamespace("default")
+			Expect(kw.Create(ctx, policy)).To(Succeed())
+
+			Expect(kw.WaitPolicyServerReconciled(ctx, migrationPolicyServer)).To(Succeed())
+			Expect(kw.WaitPolicies(ctx, kubewarden.DefaultPolicyConditions)).To(Succeed())
+		})
+
+		By("Backing up the Kubewarden resources of release N-1", func() {
+			backupFile = FetchBackup(BackupKubewarden(ctx, "kubewarden-migration-backup"))
+		})
+
+		By("Installing Kubewarden N on a new cluster", func() {
+			ResetCluster(ctx)
+			InstallBackupOperator(ctx, k)
+			InstallKubewarden(ctx, k, to)
+		})
+
+		// Remove the restored resources once done
+		SnapshotKubewarden(ctx)
+
+		By("Restoring the backup onto release N", func() {
+			PutBackup(backupFile)
+			RestoreKubewarden(ctx, "kubewarden-migration-restore", filepath.Base(backupFile), false)
+		})
+
+		By("Checking that release N serves the restored resources as v1", func() {
+			kw := NewKubewardenClient()
+
+			archive, err := backup.ReadArchive(backupFile)
+			Expect(err).To(Not(HaveOccurred()))
+
+			report := []string{}
+			keyChanges := []string{}
+			for _, e := range archive.Entries {
+				kind, found := kubewarden.KindForResource(e.Resource)
+				if e.Group != kubewarden.Group || !found {
+					continue
+				}
+
+				stored := &unstructured.Unstructured{}
+				Expect(stored.UnmarshalJSON(e.Data)).To(Succeed(), e.String())
+				if e.Version != kubewarden.Version {
+					report = append(report, fmt.Sprintf("%s: backed up as %s", e, e.Version))
+				}
+
+				restored, err := kw.Get(ctx, kind, e.Namespace, e.Name)
+				Expect(err).To(Not(HaveOccurred()), e.String())
+				Expect(restored.GetAPIVersion()).To(Equal(kubewarden.Group + "/" + kubewarden.Version))
+
+				for _, c := range kubewarden.CompareSpec(stored, restored) {
+					report = append(report, fmt.Sprintf("%s: %s", e, c))
+					if isMigrationKeyField(c.Path) {
+						keyChanges = append(keyChanges, fmt.Sprintf("%s: %s", e, c))
+					}
+				}
+			}
+
+			// Fields dropped by a newer CRD are expected, but must be known
+			AddReportEntry(fmt.Sprintf("Fields not restored by Kubewarden %s from a %s backup", to.Version, from.Version), report)
+			GinkgoWriter.Printf("Fields not restored from the %s backup:\n%s\n", from.Version, strings.Join(report, "\n"))
+			Expect(keyChanges).To(BeEmpty())
+		})
+
+		By("Checking that the restored policies are active on release N", func() {
+			kw := NewKubewardenClient()
+
+			Expect(kw.WaitPolicyServerReconciled(ctx, migrationPolicyServer)).To(Succeed())
+			for _, ref := range []kubewarden.PolicyRef{
+				kubewarden.ClusterPolicy(migrationPolicy),
+				{Kind: kubewarden.KindClusterAdmissionPolicyGroup, Name: migrationPolicyGroup},
+				kubewarden.Policy("default", migrationNamespacedPolicy),
+			} {
+				Expect(kw.WaitPolicyActive(ctx, ref)).To(Succeed())
+			}
+			Expect(kw.WaitPolicies(ctx, kubewarden.DefaultPolicyConditions)).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,167 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+	"github.com/rancher/elemental/tests/e2e/helpers/backup"
+	"github.com/rancher/elemental/tests/e2e/helpers/kubewarden"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	scheduledBackupName = "kubewarden-scheduled"
+	// One run per minute, the policies are changed between two runs
+	scheduledBackupSchedule  = "@every 1m"
+	scheduledBackupRetention = 2
+)
+
+/*
+Change the settings of a ClusterAdmissionPolicy and wait for the new settings to be served
+  - @param kw Kubewarden client
+  - @param name Name of the policy
+  - @param settings New settings of the policy
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func SetClusterPolicySettings(ctx context.Context, kw *kubewarden.Client, name string, settings map[string]any) {
+	policy, err := kw.GetPolicy(ctx, kubewarden.ClusterPolicy(name))
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(unstructured.SetNestedField(policy.Object, settings, "spec", "settings")).To(Succeed())
+	Expect(kw.Update(ctx, policy)).To(Succeed())
+
+	Expect(kw.WaitPolicyActive(ctx, kubewarden.ClusterPolicy(name))).To(Succeed())
+}
+
+var _ = Describe("E2E - Test scheduled Backup/Restore", Label("test-scheduled-backup-restore"), func() {
+	const (
+		keptPolicy    = "scheduled-kept"
+		removedPolicy = "scheduled-removed"
+	)
+
+	It("Restore an intermediate run of a recurring backup", func(ctx SpecContext) {
+		var (
+			first, intermediate, last string
+			intermediateCopy          string
+			intermediateState         *kubewarden.Snapshot
+		)
+		kw := NewKubewardenClient()
+		bc := NewBackupClient()
+
+		SnapshotKubewarden(ctx)
+
+		By("Creating a first policy", func() {
+			policy := kubewarden.NewPodClusterPolicy(removedPolicy, "default", podPrivilegedModule)
+			Expect(unstructured.SetNestedField(policy.Object, map[string]any{"skip_init_containers": false}, "spec", "settings")).To(Succeed())
+			Expect(kw.Create(ctx, policy)).To(Succeed())
+			Expect(kw.WaitPolicyActive(ctx, kubewarden.ClusterPolicy(removedPolicy))).To(Succeed())
+		})
+
+		By("Scheduling a recurring backup of the Kubewarden resources", func() {
+			changed := time.Now()
+
+			DeferDeleteBackup(scheduledBackupName)
+			ApplyAsset("", resourceSetYaml, assets.ResourceSet{Name: kubewardenResourceSet})
+			ApplyAsset("", backupYaml, assets.Backup{
+				Name:            scheduledBackupName,
+				ResourceSetName: kubewardenResourceSet,
+				RetentionCount:  scheduledBackupRetention,
+				Schedule:        scheduledBackupSchedule,
+			})
+
+			file, err := bc.WaitScheduledBackup(ctx, scheduledBackupName, changed)
+			Expect(err).To(Not(HaveOccurred()))
+			first = file
+		})
+
+		By("Changing the settings of the policy and adding another one", func() {
+			SetClusterPolicySettings(ctx, kw, removedPolicy, map[string]any{"skip_init_containers": true})
+
+			policy := kubewarden.NewPodClusterPolicy(keptPolicy, "default", podPrivilegedModule)
+			Expect(unstructured.SetNestedField(policy.Object, map[string]any{"skip_ephemeral_containers": false}, "spec", "settings")).To(Succeed())
+			Expect(kw.Create(ctx, policy)).To(Succeed())
+			Expect(kw.WaitPolicyActive(ctx, kubewarden.ClusterPolicy(keptPolicy))).To(Succeed())
+
+			state, err := kw.Snapshot(ctx)
+			Expect(err).To(Not(HaveOccurred()))
+			intermediateState = state
+		})
+
+		By("Waiting for the intermediate backup", func() {
+			file, err := bc.WaitScheduledBackup(ctx, scheduledBackupName, time.Now())
+			Expect(err).To(Not(HaveOccurred()))
+			intermediate = file
+
+			// Keep a copy, later runs can prune it
+			intermediateCopy = FetchBackup(intermediate)
+		})
+
+		By("Removing the first policy and changing the settings of the other one", func() {
+			policy, err := kw.GetPolicy(ctx, kubewarden.ClusterPolicy(removedPolicy))
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(kw.Delete(ctx, policy)).To(Succeed())
+
+			SetClusterPolicySettings(ctx, kw, keptPolicy, map[string]any{"skip_ephemeral_containers": true})
+		})
+
+		By("Waiting for the last backup and stopping the schedule", func() {
+			file, err := bc.WaitScheduledBackup(ctx, scheduledBackupName, time.Now())
+			Expect(err).To(Not(HaveOccurred()))
+			last = file
+
+			Expect(bc.DeleteResource(ctx, backup.KindBackup, scheduledBackupName)).To(Succeed())
+		})
+
+		By("Checking that the retention pruned the oldest backups", func() {
+			storage := NewBackupStorage()
+
+			Eventually(func() ([]string, error) {
+				files, err := storage.List(ctx)
+				return backup.Files(files, scheduledBackupName), err
+			}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(And(
+				HaveLen(scheduledBackupRetention),
+				ContainElement(last),
+				Not(ContainElement(first)),
+			))
+		})
+
+		By("Restoring the intermediate backup with prune", func() {
+			PutBackup(intermediateCopy)
+			RestoreKubewarden(ctx, "kubewarden-scheduled-restore", filepath.Base(intermediateCopy), true)
+		})
+
+		By("Checking that the policies and their settings are the intermediate ones", func() {
+			// Same resources, no more, no less
+			Expect(kw.WaitSnapshot(ctx, intermediateState)).To(Succeed())
+
+			for key, recorded := range intermediateState.Objects {
+				current, err := kw.Get(ctx, kubewarden.Kind(recorded.GetKind()), recorded.GetNamespace(), recorded.GetName())
+				Expect(err).To(Not(HaveOccurred()), key)
+				Expect(kubewarden.CompareSpec(recorded, current)).To(BeEmpty(), key)
+			}
+
+			for _, name := range []string{removedPolicy, keptPolicy} {
+				Expect(kw.WaitPolicyActive(ctx, kubewarden.ClusterPolicy(name))).To(Succeed())
+			}
+			Expect(kw.WaitPolicies(ctx, kubewarden.DefaultPolicyConditions)).To(Succeed())
+		})
+	})
+})
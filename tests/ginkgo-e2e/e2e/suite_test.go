@@ -15,50 +15,72 @@ limitations under the License.
 package e2e_test
 
 import (
+	"context"
+	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
+	"github.com/onsi/ginkgo/v2/reporters"
 	. "github.com/onsi/gomega"
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/admission"
+	"github.com/rancher/elemental/tests/e2e/helpers/assets"
+	"github.com/rancher/elemental/tests/e2e/helpers/backup"
+	"github.com/rancher/elemental/tests/e2e/helpers/cluster"
+	"github.com/rancher/elemental/tests/e2e/helpers/config"
+	"github.com/rancher/elemental/tests/e2e/helpers/diagnostics"
+	"github.com/rancher/elemental/tests/e2e/helpers/helm"
+	"github.com/rancher/elemental/tests/e2e/helpers/install"
+	"github.com/rancher/elemental/tests/e2e/helpers/kubewarden"
+	"github.com/rancher/elemental/tests/e2e/helpers/timing"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+	"github.com/rancher/elemental/tests/e2e/helpers/vm"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
-	airgapBuildScript   = "../scripts/build-airgap"
-	airgapUpgradeScript = "../scripts/upgrade-airgap"
+	airgapDeployScript  = "../assets/deploy-airgap"
+	airgapHaulerBinary  = "/usr/local/bin/hauler"
 	backupYaml          = "../assets/backup.yaml"
 	ciTokenYaml         = "../assets/local-kubeconfig-token-skel.yaml"
 	installConfigYaml   = "../../install-config.yaml"
 	localKubeconfigYaml = "../assets/local-kubeconfig-skel.yaml"
+	netDefaultAirgapXml = "../assets/net-default-airgap.xml"
 	policyServerYaml    = "../assets/policy-server.yaml"
+	privateRegistryYaml = "../../../resources/private-registry-deploy.yaml"
+	resourceSetYaml     = "../assets/resource-set-kubewarden.yaml"
+	podPrivilegedModule = "registry://ghcr.io/kubewarden/tests/pod-privileged:v0.2.5"
 	podPrivilegedYaml   = "../assets/pod-privileged.yaml"
+	rancherResourcesDir = "../../../resources/rancher"
 	restoreYaml         = "../assets/restore.yaml"
 	upgradeSkelYaml     = "../assets/upgrade_skel.yaml"
+	versionMatrixYaml   = "../assets/versions.yaml"
 	userName            = "root"
 	userPassword        = "r0s@pwd1"
 	vmNameRoot          = "node"
 )
 
+// Audit scanner settings requested when installing Kubewarden
+const (
+	auditScannerSchedule   = "*/2 * * * *"
+	auditScannerReportCRDs = kubewarden.ReportCRDsOpenReports
+)
+
 var (
-	allowPrivilegeEscalationPolicyVersion string
-	auditScannerVersion                   string
-	backupRestoreVersion                  string
-	capabilitiesPolicyVersion             string
-	hostNamespacePolicyVersion            string
-	hostPathsPolicyVersion                string
-	admControllerVersion                  string
-	k3sVersion                            string
-	podPrivilegedPolicyVersion            string
-	policyServerVersion                   string
-	netDefaultFileName                    string
-	rancherHostname                       string
-	testType                              string
-	userGroupPolicyVersion                string
+	cfg *config.SuiteConfig
+
+	// Release selected with KUBEWARDEN_RELEASE, nil if not set
+	kwRelease *versions.Release
 )
 
 func CheckBackupRestore(v string) {
@@ -71,21 +93,271 @@ func CheckBackupRestore(v string) {
 }
 
 /*
-Get configured backup directory
-  - @returns Configured backup directory
+Create the rancher-backup storage selected with BACKUP_STORAGE
+  - @returns The storage, the function will fail through Ginkgo in case of issue
+*/
+func NewBackupStorage() backup.Storage {
+	s, err := backup.NewStorage(cfg.BackupStorage, NewKubewardenClient().Client, backup.StorageOptions{
+		Timeout: tools.SetTimeout(5 * time.Minute),
+	})
+	Expect(err).To(Not(HaveOccurred()))
+	return s
+}
+
+/*
+Copy a backup file out of the rancher-backup storage
+  - @param filename Name of the backup file, as reported in the Backup status
+  - @returns The path of the copy in the temporary directory of the spec
+*/
+func FetchBackup(filename string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), tools.SetTimeout(5*time.Minute))
+	defer cancel()
+
+	file, err := NewBackupStorage().Fetch(ctx, filename, GinkgoT().TempDir())
+	Expect(err).To(Not(HaveOccurred()))
+	return file
+}
+
+/*
+Copy a backup file into the rancher-backup storage, to be restored
+  - @param file Backup file, e.g. returned by FetchBackup
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func PutBackup(file string) {
+	ctx, cancel := context.WithTimeout(context.Background(), tools.SetTimeout(5*time.Minute))
+	defer cancel()
+
+	Expect(NewBackupStorage().Put(ctx, file)).To(Succeed())
+}
+
+/*
+Create a rancher-backup client for the current KUBECONFIG
+  - @returns The client, the function will fail through Ginkgo in case of issue
+*/
+func NewBackupClient() *backup.Client {
+	c, err := backup.New()
+	Expect(err).To(Not(HaveOccurred()))
+
+	c.Timeout = tools.SetTimeout(5 * time.Minute)
+	return c
+}
+
+/*
+Create a Kubewarden client for the current KUBECONFIG
+  - @returns The client, the function will fail through Ginkgo in case of issue
+*/
+func NewKubewardenClient() *kubewarden.Client {
+	kw, err := kubewarden.New()
+	Expect(err).To(Not(HaveOccurred()))
+
+	kw.Timeout = tools.SetTimeout(5 * time.Minute)
+	return kw
+}
+
+/*
+Create the provider of the cluster selected with CLUSTER_PROVIDER
+  - @returns The provider, the function will fail through Ginkgo in case of issue
+*/
+func NewClusterProvider() cluster.Provider {
+	opts := cluster.Options{
+		Name:    cfg.ClusterName,
+		Timeout: tools.SetTimeout(4 * time.Minute),
+	}
+
+	// INSTALL_K3S_VERSION is only meaningful for the K3s based providers
+	if cfg.ClusterProvider != cluster.ProviderKind {
+		opts.Version = cfg.K3sVersion
+	}
+
+	p, err := cluster.New(cfg.ClusterProvider, opts)
+	Expect(err).To(Not(HaveOccurred()))
+	return p
+}
+
+/*
+Destroy and create the cluster again, then use its kubeconfig
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func ResetCluster(ctx context.Context) {
+	provider := NewClusterProvider()
+	Expect(provider.Reset(ctx)).To(Succeed())
+
+	// Use the new Kube config
+	kubeconfig, err := provider.Kubeconfig(ctx)
+	Expect(err).To(Not(HaveOccurred()))
+	err = os.Setenv("KUBECONFIG", kubeconfig)
+	Expect(err).To(Not(HaveOccurred()))
+}
+
+/*
+Get the release to test with the versions of the configuration, see SuiteConfig.TargetRelease
+  - @param r Release of the version matrix, nil for the latest charts
+  - @returns A copy of the release, the versions set in the configuration take precedence
+*/
+func TargetRelease(r *versions.Release) *versions.Release {
+	return cfg.TargetRelease(r)
+}
+
+/*
+Select the releases N-1 and N from the version matrix
+  - @returns The release to start from (UPGRADE_FROM_RELEASE or the previous one) and the target one (KUBEWARDEN_RELEASE or the latest one, see TargetRelease)
 */
-func GetBackupDir() string {
-	claimName, err := kubectl.RunWithoutErr("get", "pod", "-l", "app.kubernetes.io/name=rancher-backup",
-		"--namespace", "cattle-resources-system",
-		"-o", "jsonpath={.items[*].spec.volumes[?(@.name==\"pv-storage\")].persistentVolumeClaim.claimName}")
+func SelectReleases() (from, to *versions.Release) {
+	matrixFile := cfg.VersionMatrixFile
+	if matrixFile == "" {
+		matrixFile = versionMatrixYaml
+	}
+	matrix, err := versions.Load(matrixFile)
 	Expect(err).To(Not(HaveOccurred()))
 
-	out, err := kubectl.RunWithoutErr("get", "pv",
-		"--namespace", "cattle-resources-system",
-		"-o", "jsonpath={.items[?(@.spec.claimRef.name==\""+claimName+"\")].spec.local.path}")
+	to = kwRelease
+	if to == nil {
+		to, err = matrix.Resolve("latest")
+		Expect(err).To(Not(HaveOccurred()))
+	}
+
+	if cfg.UpgradeFromRelease != "" {
+		from, err = matrix.Resolve(cfg.UpgradeFromRelease)
+	} else {
+		from, err = matrix.Previous(to)
+	}
+	Expect(err).To(Not(HaveOccurred()))
+
+	return from, TargetRelease(to)
+}
+
+/*
+Record the Kubewarden resources, bare pods and namespaces, and put them back when the spec ends
+  - @param ctx Context of the spec
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func SnapshotKubewarden(ctx SpecContext) {
+	snapshot, err := NewKubewardenClient().Snapshot(ctx)
 	Expect(err).To(Not(HaveOccurred()))
 
-	return out
+	DeferCleanup(func(ctx SpecContext) {
+		By("Reverting Kubewarden resources to their initial state")
+
+		// The client is created again, as KUBECONFIG can change during the spec
+		Expect(NewKubewardenClient().Revert(ctx, snapshot)).To(Succeed())
+	}, NodeTimeout(tools.SetTimeout(10*time.Minute)))
+}
+
+/*
+Render a template asset in the temporary directory of the current spec
+  - @param file Asset file
+  - @param params Typed parameters of the asset, e.g. assets.Restore
+  - @returns The path of the rendered file, the function will fail through Ginkgo in case of issue
+*/
+func RenderAsset(file string, params any) string {
+	r := &assets.Renderer{Dir: GinkgoT().TempDir()}
+
+	path, err := r.RenderFile(file, params)
+	Expect(err).To(Not(HaveOccurred()))
+	return path
+}
+
+/*
+Render a template asset and apply it from memory
+  - @param namespace Namespace of the namespaced resources
+  - @param file Asset file
+  - @param params Typed parameters of the asset, e.g. assets.PolicyServer
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func ApplyAsset(namespace, file string, params any) {
+	manifest, err := assets.Render(file, params)
+	Expect(err).To(Not(HaveOccurred()))
+
+	GinkgoWriter.Printf("Applying %s:\n%s\n", file, manifest)
+	Expect(assets.Apply(namespace, manifest)).To(Succeed())
+}
+
+/*
+Submit the creation of an object through a server-side dry-run
+  - @param obj Object to submit, typed or unstructured
+  - @returns The admission decision or an error if the request could not be evaluated
+*/
+func Admit(obj client.Object) (*admission.Decision, error) {
+	a, err := admission.New()
+	if err != nil {
+		return nil, err
+	}
+	// Kubewarden accepts every request of its own namespace, the patch only holds the changes of the policies
+	a.BaselineNamespace = KubewardenNamespace()
+
+	ctx, cancel := context.WithTimeout(context.Background(), tools.SetTimeout(time.Minute))
+	defer cancel()
+
+	return a.Admit(ctx, obj)
+}
+
+/*
+Submit the creation of the object of a YAML file through a server-side dry-run
+  - @param path YAML file, e.g. an asset
+  - @returns The admission decision or an error if the request could not be evaluated
+*/
+func AdmitFile(path string) (*admission.Decision, error) {
+	obj, err := admission.LoadObject(path)
+	if err != nil {
+		return nil, err
+	}
+	return Admit(obj)
+}
+
+/*
+Build a pause pod in the default namespace
+  - @param name Name of the pod
+  - @param privileged Run the container as privileged
+  - @returns The pod
+*/
+func NewPod(name string, privileged bool) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:            "pause",
+				Image:           "rancher/pause:3.2",
+				SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+			}},
+		},
+	}
+}
+
+/*
+Create a Helm client for the current KUBECONFIG
+  - @returns The client
+*/
+func NewHelmClient() *helm.Client {
+	c := helm.New()
+	c.RetryTimeout = tools.SetTimeout(2 * time.Minute)
+	return c
+}
+
+/*
+Install or upgrade a Helm release, only transient errors are retried
+  - @param name Name of the release
+  - @param opts Chart options
+  - @returns The deployed release, the function will fail through Ginkgo in case of issue
+*/
+func HelmUpgrade(ctx context.Context, name string, opts helm.Options) *helm.Release {
+	r, err := NewHelmClient().Upgrade(ctx, name, opts)
+	Expect(err).To(Not(HaveOccurred()))
+
+	CheckRelease(r)
+	return r
+}
+
+/*
+Check that a Helm release is deployed
+  - @param r Release returned by an install or upgrade
+  - @returns Nothing, the function will fail through Ginkgo in case of issue
+*/
+func CheckRelease(r *helm.Release) {
+	Expect(r.Deployed()).To(BeTrue(), r.Info.Description)
+	Expect(r.FailedHooks()).To(BeEmpty())
+
+	GinkgoWriter.Printf("Release %s revision %d deployed with chart %s-%s\n",
+		r.Name, r.Revision, r.Chart.Metadata.Name, r.Chart.Metadata.Version)
 }
 
 /*
@@ -93,43 +365,42 @@ Install rancher-backup operator
   - @param k kubectl structure
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
-func InstallBackupOperator(k *kubectl.Kubectl) {
+func InstallBackupOperator(ctx context.Context, k *kubectl.Kubectl) {
 	// Default chart
 	chartRepo := "rancher-chart"
 
 	// Set specific operator version if defined
-	if backupRestoreVersion != "" {
-		chartRepo = "https://github.com/rancher/backup-restore-operator/releases/download/" + backupRestoreVersion
+	if cfg.BackupRestoreVersion != "" {
+		chartRepo = "https://github.com/rancher/backup-restore-operator/releases/download/" + cfg.BackupRestoreVersion
 	} else {
-		RunHelmCmdWithRetry("repo", "add", chartRepo, "https://charts.rancher.io")
-		RunHelmCmdWithRetry("repo", "update")
+		Expect(NewHelmClient().AddRepo(ctx, chartRepo, "https://charts.rancher.io")).To(Succeed())
 	}
 
+	// Deploy the backup target first, MinIO for the s3 storage
+	storage := NewBackupStorage()
+	Expect(storage.Prepare(ctx)).To(Succeed())
+
 	for _, chart := range []string{"rancher-backup-crd", "rancher-backup"} {
 		// Set the filename in chart if a custom version is defined
 		chartName := chart
-		if backupRestoreVersion != "" {
-			chartName = chart + "-" + strings.Trim(backupRestoreVersion, "v") + ".tgz"
+		if cfg.BackupRestoreVersion != "" {
+			chartName = chart + "-" + strings.Trim(cfg.BackupRestoreVersion, "v") + ".tgz"
 		}
 
-		// Global installation flags
-		flags := []string{
-			"upgrade", "--install", chart, chartRepo + "/" + chartName,
-			"--namespace", "cattle-resources-system",
-			"--create-namespace",
-			"--wait", "--wait-for-jobs",
+		opts := helm.Options{
+			Chart:           chartRepo + "/" + chartName,
+			Namespace:       "cattle-resources-system",
+			Install:         true,
+			CreateNamespace: true,
+			Wait:            true,
 		}
 
 		// Add specific options for the rancher-backup chart
 		if chart == "rancher-backup" {
-			flags = append(flags,
-				"--set", "persistence.enabled=true",
-				"--set", "persistence.storageClass=local-path",
-				"--set", "optionalResources.kubewarden.enabled=true",
-			)
+			opts.Set = append(storage.ChartValues(), "optionalResources.kubewarden.enabled=true")
 		}
 
-		RunHelmCmdWithRetry(flags...)
+		HelmUpgrade(ctx, chart, opts)
 
 		Eventually(func() error {
 			return rancher.CheckPod(k, [][]string{{"cattle-resources-system", "app.kubernetes.io/name=rancher-backup"}})
@@ -138,100 +409,93 @@ func InstallBackupOperator(k *kubectl.Kubectl) {
 }
 
 /*
-Install K3s
-  - @returns Nothing, the function will fail through Ginkgo in case of issue
+Create the Kubewarden install mode selected with INSTALL_MODE
+  - @returns The mode, the function will fail through Ginkgo in case of issue
 */
-func InstallK3s() {
-	// Get K3s installation script
-	fileName := "k3s-install.sh"
-	Eventually(func() error {
-		return tools.GetFileFromURL("https://get.k3s.io", fileName, true)
-	}, tools.SetTimeout(2*time.Minute), 10*time.Second).ShouldNot(HaveOccurred())
-
-	// Set command and arguments
-	installCmd := exec.Command("sh", fileName)
-	installCmd.Env = append(os.Environ(), "INSTALL_K3S_EXEC=--disable metrics-server")
-
-	// Retry in case of (sporadic) failure...
-	count := 1
-	Eventually(func() error {
-		// Execute K3s installation
-		out, err := installCmd.CombinedOutput()
-		GinkgoWriter.Printf("K3s installation loop %d:\n%s\n", count, out)
-		count++
-		return err
-	}, tools.SetTimeout(2*time.Minute), 5*time.Second).Should(Not(HaveOccurred()))
+func NewInstallMode() install.Mode {
+	m, err := install.New(cfg.InstallMode, install.Options{
+		AppCoVersion:     cfg.AppCoVersion,
+		AppCoUsername:    cfg.AppCoUsername,
+		AppCoPassword:    cfg.AppCoPassword,
+		RancherHostname:  cfg.RancherHostname,
+		RancherResources: rancherResourcesDir,
+		Timeout:          tools.SetTimeout(5 * time.Minute),
+	})
+	Expect(err).To(Not(HaveOccurred()))
+	return m
+}
+
+// KubewardenNamespace returns the namespace of the stack for the selected install mode
+func KubewardenNamespace() string {
+	return NewInstallMode().Namespace()
 }
 
 /*
 Install Kubewarden
   - @param k kubectl structure
+  - @param release Release from the version matrix, latest charts are used if nil
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
-func InstallKubewarden(k *kubectl.Kubectl) {
-	// Install Kubewarden CRDs
-	RunHelmCmdWithRetry("repo", "add", "kubewarden", "https://charts.kubewarden.io")
-	RunHelmCmdWithRetry("repo", "update")
-
-	// Default chart
-	chartRepo := "kubewarden"
-
-	for _, chart := range []string{"kubewarden-crds", "kubewarden-controller", "kubewarden-defaults"} {
-		// Set the filename in chart if a custom version is defined
-		chartName := chart
-
-		// Global installation flags
-		flags := []string{
-			"upgrade", "--install", chart, chartRepo + "/" + chartName,
-			"--namespace", "kubewarden",
-			"--create-namespace",
-			"--wait", "--wait-for-jobs",
-		}
-
-		// Add specific options for the rancher-backup chart
-		if chart == "kubewarden-controller" {
-			flags = append(flags,
-				"--set", "auditScanner.policyReporter=true",
-				"--set", "auditScanner.cronJob.schedule=*/2 * * * *",
-				"--set", "auditScanner.reportCRDsKind=openreports",
-			)
-		}
-
-		if chart == "kubewarden-defaults" {
-			flags = append(flags,
-				"--set", "recommendedPolicies.enabled=true",
-			)
-		}
-		RunHelmCmdWithRetry(flags...)
+func InstallKubewarden(ctx context.Context, k *kubectl.Kubectl, release *versions.Release) {
+	mode := NewInstallMode()
+	Expect(mode.Prepare(ctx, NewKubewardenClient().Client, NewHelmClient())).To(Succeed())
+
+	charts := mode.Charts(release, install.Values{
+		install.ChartController: {
+			"auditScanner.policyReporter=true",
+			"auditScanner.cronJob.schedule=" + auditScannerSchedule,
+			"auditScanner.reportCRDsKind=" + auditScannerReportCRDs,
+		},
+		install.ChartDefaults: {"recommendedPolicies.enabled=true"},
+	})
+	for _, chart := range charts {
+		r, err := mode.Install(ctx, NewHelmClient(), chart)
+		Expect(err).To(Not(HaveOccurred()))
+
+		CheckRelease(r)
+		CheckReleaseValues(ctx, chart.Release, chart.Options)
 	}
 
 	// Wait for all pods to be started
 	checkList := [][]string{
-		{"kubewarden", "app.kubernetes.io/name=kubewarden-controller"},
-		{"kubewarden", "app.kubernetes.io/name=policy-server"},
+		{mode.Namespace(), "app.kubernetes.io/name=kubewarden-controller"},
+		{mode.Namespace(), "app.kubernetes.io/name=policy-server"},
 	}
 	err := rancher.CheckPod(k, checkList)
 	Expect(err).To(Not(HaveOccurred()))
+
+	CheckAuditScanner(ctx, mode.Namespace())
+
+	// Same policy checks whatever the install mode
+	Expect(NewKubewardenClient().WaitPolicies(ctx, kubewarden.DefaultPolicyConditions)).To(Succeed())
 }
 
 /*
-Start K3s
-  - @returns Nothing, the function will fail through Ginkgo in case of issue
+Check that the values of a release reflect the requested overrides
+  - @param name Name of the release
+  - @param opts Chart options the release was installed or upgraded with
+  - @returns Nothing, the function will fail through Ginkgo listing the overrides not applied
 */
-func StartK3s() {
-	err := exec.Command("sudo", "systemctl", "start", "k3s").Run()
+func CheckReleaseValues(ctx context.Context, name string, opts helm.Options) {
+	values, err := NewHelmClient().Values(ctx, name, opts.Namespace, true)
 	Expect(err).To(Not(HaveOccurred()))
+	Expect(helm.DiffSet(values, opts.Set)).To(BeEmpty(), "values of release %s", name)
 }
 
 /*
-Execute RunHelmBinaryWithCustomErr within a loop with timeout
-  - @param s options to pass to RunHelmBinaryWithCustomErr command
+Check that the audit scanner runs as requested: CronJob schedule and report CRDs
+  - @param namespace Namespace of the kubewarden-controller release
   - @returns Nothing, the function will fail through Ginkgo in case of issue
 */
-func RunHelmCmdWithRetry(s ...string) {
-	Eventually(func() error {
-		return kubectl.RunHelmBinaryWithCustomErr(s...)
-	}, tools.SetTimeout(2*time.Minute), 20*time.Second).Should(Not(HaveOccurred()))
+func CheckAuditScanner(ctx context.Context, namespace string) {
+	kw := NewKubewardenClient()
+
+	schedule, err := kw.AuditScannerSchedule(ctx, namespace)
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(schedule).To(Equal(auditScannerSchedule))
+
+	// The first reports are written by the first scheduled run
+	Expect(kw.WaitReports(ctx, auditScannerReportCRDs)).To(Succeed())
 }
 
 /*
@@ -246,35 +510,116 @@ func CheckSSH(cl *tools.Client) {
 	}, tools.SetTimeout(10*time.Minute), 5*time.Second).Should(Equal("SSH_OK"))
 }
 
-func FailWithReport(message string, callerSkip ...int) {
-	// Ensures the correct line numbers are reported
-	Fail(message, callerSkip[0]+1)
+/*
+Get the number of agents of the airgap cluster
+  - @returns AIRGAP_AGENTS, 0 if not set for a single node cluster
+*/
+func AirgapAgents() int {
+	if cfg.AirgapAgents == "" {
+		return 0
+	}
+
+	agents, err := strconv.Atoi(cfg.AirgapAgents)
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(agents).To(BeNumerically(">=", 0))
+	return agents
 }
 
 /*
-Wait for K3s to start
-  - @param k kubectl structure
-  - @returns Nothing, the function will fail through Ginkgo in case of issue
+Get the libvirt network of the airgap tests
+  - @returns The network, with the fixed addresses of the VMs
 */
-func WaitForK3s(k *kubectl.Kubectl) {
-	// Check Pod(s)
-	checkList := [][]string{
-		{"kube-system", "app=local-path-provisioner"},
-		{"kube-system", "k8s-app=kube-dns"},
-		{"kube-system", "app.kubernetes.io/name=traefik"},
-		{"kube-system", "svccontroller.k3s.cattle.io/svcname=traefik"},
+func AirgapNetwork() assets.Network {
+	net := assets.Network{
+		Name:       "default",
+		Bridge:     "virbr0",
+		ForwardDev: "eth0",
+		Address:    "192.168.122.1",
+		Netmask:    "255.255.255.0",
+		DHCPStart:  "192.168.122.2",
+		DHCPEnd:    "192.168.122.191",
 	}
-	Eventually(func() error {
-		return rancher.CheckPod(k, checkList)
-	}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+	for _, v := range AirgapVMs() {
+		net.Hosts = append(net.Hosts, assets.NetworkHost{Name: v.Name, Hostname: v.Name + ".test", MAC: v.MAC, IP: v.IP})
+	}
+	return net
+}
 
-	// Check DaemonSet(s)
-	checkList = [][]string{
-		{"kube-system", "svccontroller.k3s.cattle.io/svcname=traefik"},
+/*
+Get the rancher-manager VM of the airgap tests
+  - @returns The VM, booted from ~/rancher-image.qcow2
+*/
+func RancherManagerVM() vm.Spec {
+	return vm.Spec{
+		Name:      "rancher-manager",
+		MemoryMiB: 16384,
+		VCPUs:     4,
+		Disk:      os.Getenv("HOME") + "/rancher-image.qcow2",
+		OSVariant: "opensuse-unknown",
+		Network:   "default",
+		MAC:       "52:54:00:00:00:10",
+		IP:        "192.168.122.102",
+		User:      "root",
+		Password:  "root",
 	}
-	Eventually(func() error {
-		return rancher.CheckDaemonSet(k, checkList)
-	}, tools.SetTimeout(4*time.Minute), 30*time.Second).Should(Not(HaveOccurred()))
+}
+
+/*
+Get the VMs of the airgap cluster
+  - @returns The rancher-manager VM, server of the cluster, then the agents
+*/
+func AirgapVMs() []vm.Spec {
+	server := RancherManagerVM()
+	agents := AirgapAgents()
+	if agents == 0 {
+		return []vm.Spec{server}
+	}
+
+	// The image is shared, each VM writes to its own overlay
+	image := server.Disk
+	server.BaseImage = image
+	server.Disk = os.Getenv("HOME") + "/" + server.Name + ".qcow2"
+
+	vms := []vm.Spec{server}
+	for i := 1; i <= agents; i++ {
+		agent := server
+		agent.Name = fmt.Sprintf("agent-%d", i)
+		agent.MemoryMiB = 4096
+		agent.VCPUs = 2
+		agent.Disk = os.Getenv("HOME") + "/" + agent.Name + ".qcow2"
+		agent.MAC = fmt.Sprintf("52:54:00:00:00:%02x", 0x10+i)
+		agent.IP = fmt.Sprintf("192.168.122.%d", 102+i)
+		vms = append(vms, agent)
+	}
+	return vms
+}
+
+/*
+Get the SSH client of the airgap rancher-manager VM
+  - @returns The SSH client
+*/
+func AirgapSSHClient() *tools.Client {
+	return RancherManagerVM().SSHClient()
+}
+
+/*
+Get the directory where the reports are written
+  - @returns The directory of the JUnit report if any, REPORT_DIR otherwise
+*/
+func ReportDir() string {
+	_, reporterConfig := GinkgoConfiguration()
+	if reporterConfig.JUnitReport != "" {
+		return filepath.Dir(reporterConfig.JUnitReport)
+	}
+	if cfg != nil && cfg.ReportDir != "" {
+		return cfg.ReportDir
+	}
+	return "."
+}
+
+func FailWithReport(message string, callerSkip ...int) {
+	// Ensures the correct line numbers are reported
+	Fail(message, callerSkip[0]+1)
 }
 
 func TestE2E(t *testing.T) {
@@ -283,18 +628,88 @@ func TestE2E(t *testing.T) {
 }
 
 var _ = BeforeSuite(func() {
-	auditScannerVersion = os.Getenv("AUDIT_SCANNER_VERSION")
-	allowPrivilegeEscalationPolicyVersion = os.Getenv("ALLOW_PRIVILEGE_ESCALATION_PSP_VERSION")
-	capabilitiesPolicyVersion = os.Getenv("CAPABILITIES_PSP_VERSION")
-	hostNamespacePolicyVersion = os.Getenv("HOST_NAMESPACES_PSP_VERSION")
-	hostPathsPolicyVersion = os.Getenv("HOSTPATHS_PSP_VERSION")
-	podPrivilegedPolicyVersion = os.Getenv("POD_PRIVILEGED_PSP_VERSION")
-	userGroupPolicyVersion = os.Getenv("USER_GROUP_PSP_VERSION")
-	backupRestoreVersion = os.Getenv("BACKUP_RESTORE_VERSION")
-	admControllerVersion = os.Getenv("ADM_CONTROLLER_VERSION")
-	policyServerVersion = os.Getenv("POLICY_SERVER_VERSION")
-	k3sVersion = os.Getenv("INSTALL_K3S_VERSION")
-	netDefaultFileName = "../assets/net-default-airgap.xml"
-	rancherHostname = os.Getenv("PUBLIC_FQDN")
-	testType = os.Getenv("TEST_TYPE")
+	var err error
+
+	cfg, err = config.Load(os.Getenv(config.ConfigFileEnv))
+	Expect(err).To(Not(HaveOccurred()))
+
+	// Select a consistent stack from the version matrix
+	if cfg.KubewardenRelease != "" {
+		if cfg.VersionMatrixFile == "" {
+			cfg.VersionMatrixFile = versionMatrixYaml
+		}
+
+		matrix, err := versions.Load(cfg.VersionMatrixFile)
+		Expect(err).To(Not(HaveOccurred()))
+
+		kwRelease, err = matrix.Resolve(cfg.KubewardenRelease)
+		Expect(err).To(Not(HaveOccurred()))
+
+		GinkgoWriter.Printf("Using Kubewarden release %s from %s\n", kwRelease.Version, cfg.VersionMatrixFile)
+		cfg.ApplyRelease(kwRelease)
+	}
+
+	// Shown without -v, and kept in the reports; fail early instead of deep inside a Helm command
+	AddReportEntry("Resolved suite configuration", cfg.String(), ReportEntryVisibilityAlways)
+	Expect(cfg.Validate(GinkgoLabelFilter())).To(Succeed())
+})
+
+// Collect a diagnostics bundle for each failed spec
+var _ = ReportAfterEach(func(report SpecReport) {
+	if !report.Failed() {
+		return
+	}
+
+	// Airgap cluster is only reachable from the VM
+	var runner diagnostics.Runner = diagnostics.LocalRunner{}
+	for _, label := range report.Labels() {
+		if strings.HasPrefix(label, "airgap-") {
+			runner = diagnostics.SSHRunner{Client: AirgapSSHClient()}
+		}
+	}
+
+	dir := ReportDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		GinkgoWriter.Printf("Cannot create report directory: %v\n", err)
+		return
+	}
+
+	file := filepath.Join(dir, diagnostics.FileName(report.FullText()))
+	if err := diagnostics.Collect(runner, diagnostics.DefaultCommands(KubewardenNamespace(), backup.OperatorNamespace)).WriteTarball(file); err != nil {
+		GinkgoWriter.Printf("Cannot write diagnostics bundle: %v\n", err)
+		return
+	}
+	GinkgoWriter.Printf("Diagnostics bundle written in %s\n", file)
+})
+
+// Write the JUnit/JSON reports and the timing of each By step
+var _ = ReportAfterSuite("E2E reports", func(report Report) {
+	dir := ReportDir()
+	Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+
+	// One set of reports per label filter, as each make target runs its own label
+	name := "e2e"
+	if filter := GinkgoLabelFilter(); filter != "" {
+		name += "-" + strings.Trim(regexp.MustCompile(`[^A-Za-z0-9_-]+`).ReplaceAllString(filter, "-"), "-")
+	}
+
+	// Don't overwrite the reports requested on the command line
+	_, reporterConfig := GinkgoConfiguration()
+	if reporterConfig.JUnitReport == "" {
+		Expect(reporters.GenerateJUnitReport(report, filepath.Join(dir, name+".xml"))).To(Succeed())
+	}
+	if reporterConfig.JSONReport == "" {
+		Expect(reporters.GenerateJSONReport(report, filepath.Join(dir, name+".json"))).To(Succeed())
+	}
+
+	var budgetsFile string
+	if cfg != nil {
+		budgetsFile = cfg.StepBudgetsFile
+	}
+	budgets, err := timing.LoadBudgets(budgetsFile)
+	Expect(err).To(Not(HaveOccurred()))
+
+	steps := timing.Steps(report, budgets)
+	Expect(timing.WriteJSON(steps, filepath.Join(dir, name+"-steps.json"))).To(Succeed())
+	Expect(timing.CheckBudgets(steps)).To(Succeed())
 })
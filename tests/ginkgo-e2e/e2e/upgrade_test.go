@@ -0,0 +1,147 @@
+/*
+Copyright © 2025 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/elemental/tests/e2e/helpers/admission"
+	"github.com/rancher/elemental/tests/e2e/helpers/install"
+	"github.com/rancher/elemental/tests/e2e/helpers/kubewarden"
+	"github.com/rancher/elemental/tests/e2e/helpers/versions"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	upgradePolicyServer = "upgrade"
+	upgradePolicy       = "upgrade-no-privileged-pod"
+)
+
+var _ = Describe("E2E - Upgrade Kubewarden between two releases", Label("upgrade"), func() {
+	// Create kubectl context
+	// Default timeout is too small, so New() cannot be used
+	k := &kubectl.Kubectl{
+		Namespace:    "",
+		PollTimeout:  tools.SetTimeout(300 * time.Second),
+		PollInterval: 500 * time.Millisecond,
+	}
+
+	It("Upgrade Kubewarden stack from release N-1 to release N", func(ctx SpecContext) {
+		// Other install modes pin their own versions, not the ones of the matrix
+		if cfg.InstallMode != "" && cfg.InstallMode != install.ModeUpstream {
+			Skip("upgrade between matrix releases requires the upstream install mode")
+		}
+
+		var from, to *versions.Release
+		pods := map[string]*corev1.Pod{
+			"unprivileged": NewPod("upgrade-unprivileged", false),
+			"privileged":   NewPod("upgrade-privileged", true),
+		}
+		decisions := map[string]*admission.Decision{}
+
+		By("Selecting the releases from the version matrix", func() {
+			from, to = SelectReleases()
+			GinkgoWriter.Printf("Upgrading Kubewarden from %s to %s\n", from.Version, to.Version)
+		})
+
+		By("Installing Kubewarden N-1", func() {
+			InstallKubewarden(ctx, k, from)
+		})
+
+		// Remove the custom policy-server and policy once done
+		SnapshotKubewarden(ctx)
+
+		By("Deploying a custom policy-server and its policies", func() {
+			kw := NewKubewardenClient()
+
+			ps := kubewarden.NewPolicyServer(upgradePolicyServer, "ghcr.io/kubewarden/policy-server:"+from.Images.PolicyServer, 2)
+			Expect(unstructured.SetNestedSlice(ps.Object, []any{
+				map[string]any{"name": "KUBEWARDEN_LOG_LEVEL", "value": "debug"},
+			}, "spec", "env")).To(Succeed())
+			Expect(kw.Create(ctx, ps)).To(Succeed())
+
+			policy := kubewarden.NewPodClusterPolicy(upgradePolicy, upgradePolicyServer, podPrivilegedModule)
+			Expect(kw.Create(ctx, policy)).To(Succeed())
+
+			Expect(kw.WaitPolicyServerReconciled(ctx, upgradePolicyServer)).To(Succeed())
+			Expect(kw.WaitPolicies(ctx, kubewarden.DefaultPolicyConditions)).To(Succeed())
+		})
+
+		By("Recording admission decisions before the upgrade", func() {
+			for name, pod := range pods {
+				d, err := Admit(pod)
+				Expect(err).To(Not(HaveOccurred()))
+				decisions[name] = d
+			}
+
+			// Make sure the policies are really enforced
+			Expect(decisions["unprivileged"]).To(admission.BeAllowed())
+			Expect(decisions["privileged"]).To(admission.BeDeniedBy(upgradePolicy))
+		})
+
+		By("Upgrading Kubewarden to N", func() {
+			InstallKubewarden(ctx, k, to)
+		})
+
+		By("Checking that the stack runs release N", func() {
+			kw := NewKubewardenClient()
+			for deployment, tag := range map[string]string{
+				"kubewarden-controller": to.Images.Controller,
+				"policy-server-default": to.Images.PolicyServer,
+			} {
+				Eventually(func(g Gomega) string {
+					d := &appsv1.Deployment{}
+					g.Expect(kw.Client.Get(ctx, client.ObjectKey{Namespace: KubewardenNamespace(), Name: deployment}, d)).To(Succeed())
+					g.Expect(d.Spec.Template.Spec.Containers).To(Not(BeEmpty()))
+					return d.Spec.Template.Spec.Containers[0].Image
+				}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(HaveSuffix(":" + tag))
+			}
+		})
+
+		By("Checking that every policy is still active", func() {
+			kw := NewKubewardenClient()
+			Expect(kw.WaitPolicyServerReconciled(ctx, "default")).To(Succeed())
+			Expect(kw.WaitPolicyServerReconciled(ctx, upgradePolicyServer)).To(Succeed())
+			Expect(kw.WaitPolicies(ctx, kubewarden.DefaultPolicyConditions)).To(Succeed())
+		})
+
+		By("Checking that the custom policy-server kept its settings", func() {
+			ps, err := NewKubewardenClient().GetPolicyServer(ctx, upgradePolicyServer)
+			Expect(err).To(Not(HaveOccurred()))
+
+			spec, _, _ := unstructured.NestedMap(ps.Object, "spec")
+			Expect(spec).To(HaveKeyWithValue("image", "ghcr.io/kubewarden/policy-server:"+from.Images.PolicyServer))
+			Expect(spec).To(HaveKeyWithValue("replicas", BeNumerically("==", 2)))
+			Expect(spec).To(HaveKeyWithValue("env", ContainElement(HaveKeyWithValue("value", "debug"))))
+		})
+
+		By("Checking that admission decisions did not change", func() {
+			for name, pod := range pods {
+				d, err := Admit(pod)
+				Expect(err).To(Not(HaveOccurred()))
+				Expect(d.Allowed).To(Equal(decisions[name].Allowed), name)
+				Expect(d.Webhook).To(Equal(decisions[name].Webhook), name)
+				Expect(d.Message).To(Equal(decisions[name].Message), name)
+			}
+		})
+	})
+})